@@ -21,7 +21,7 @@
 package adapters
 
 import (
-	"log"
+	"fmt"
 
 	"github.com/tnotstar/datacat/core"
 )
@@ -33,12 +33,11 @@ import (
 // The `cfg` is the global configuration object.
 // The `taskName` is the name of the task to be executed.
 // The `adapterName` is the index of the adapter to be created.
-func BuildAdapter(id int, cfg core.Configurator, taskName string, adapterName string) core.Adapter {
+func BuildAdapter(id int, cfg core.Configurator, taskName string, adapterName string) (core.Adapter, error) {
 	adapterConfig, err := cfg.GetAdapterConfig(taskName, adapterName)
 	if err != nil {
-		log.Fatalf("Error getting adapters configuration for task %s: %s", taskName, err)
+		return nil, fmt.Errorf("Error getting adapters configuration for task %s: %w", taskName, err)
 	}
-	log.Print("BuildAdapter: ************** HOOOOOLLLLLLLAAAAAA*********", adapterConfig)
 
 	if IsaCaseConversionAdapter(adapterConfig.Type) {
 		return NewCaseConversionAdapter(id, cfg, taskName, adapterName)
@@ -49,7 +48,6 @@ func BuildAdapter(id int, cfg core.Configurator, taskName string, adapterName st
 	}
 
 	if IsaCastToDatatypeAdapter(adapterConfig.Type) {
-		log.Print("IsaCastToDatatypeAdapter: ************** HOOOOOLLLLLLLAAAAAA*********", taskName, adapterName)
 		return NewCastToDatatypeAdapter(id, cfg, taskName, adapterName)
 	}
 
@@ -65,6 +63,9 @@ func BuildAdapter(id int, cfg core.Configurator, taskName string, adapterName st
 		return NewNullHandlingAdapter(id, cfg, taskName, adapterName)
 	}
 
-	log.Fatalf("Invalid adapter middlepoint type %s", adapterConfig.Type)
-	return nil
+	if IsaHttpRequestAdapter(adapterConfig.Type) {
+		return NewHttpRequestAdapter(id, cfg, taskName, adapterName)
+	}
+
+	return nil, fmt.Errorf("Invalid adapter middlepoint type %s", adapterConfig.Type)
 }
@@ -21,6 +21,7 @@
 package adapters
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"strings"
@@ -56,15 +57,18 @@ func IsaCaseConversionAdapter(adapterType string) bool {
 // The `cfg` is the global configuration object.
 // The `taskName` is the name of the task to be executed.
 // The `adapterName` is the name of the adapter to be created.
-func NewCaseConversionAdapter(id int, cfg core.Configurator, taskName string, adapterName string) core.Adapter {
+func NewCaseConversionAdapter(id int, cfg core.Configurator, taskName string, adapterName string) (core.Adapter, error) {
 	adapterConfig, _ := cfg.GetAdapterConfig(taskName, adapterName)
 
-	raws := adapterConfig.Arguments["fields"].([]any)
-	fields := make([]string, len(raws))
-	for i, field := range raws {
-		fields[i] = fmt.Sprint(field)
+	fields, err := adapterConfig.Arguments.Strings("fields")
+	if err != nil {
+		return nil, err
+	}
+
+	handling := adapterConfig.Arguments.String("handling", "")
+	if handling != "upper" && handling != "lower" && handling != "title" {
+		return nil, fmt.Errorf("Invalid case conversion type: %s", handling)
 	}
-	handling := fmt.Sprint(adapterConfig.Arguments["handling"])
 
 	return &CaseConversionAdapter{
 		id:       id,
@@ -72,20 +76,23 @@ func NewCaseConversionAdapter(id int, cfg core.Configurator, taskName string, ad
 		adapter:  adapterName,
 		fields:   fields,
 		handling: handling,
-	}
+	}, nil
 }
 
 // Returns the output channel of the case converted rows.
 //
+// The `ctx` is the context to cancel the processing.
 // The `wg` is the wait group for the goroutine.
+// The `trk` is the tracker to report errors to.
 // The `in` is the input channel of the rows to be casted.
-func (adp *CaseConversionAdapter) Run(wg *sync.WaitGroup, in <-chan core.RowMap) <-chan core.RowMap {
+func (adp *CaseConversionAdapter) Run(ctx context.Context, wg *sync.WaitGroup, trk *core.Tracker, in <-chan core.RowMap) <-chan core.RowMap {
 	log.Printf("* Creating #%d instance of case conversion adapter for task %s...", adp.id, adp.task)
 	out := make(chan core.RowMap)
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
+		defer close(out)
 
 		for row := range in {
 			for _, field := range adp.fields {
@@ -94,7 +101,6 @@ func (adp *CaseConversionAdapter) Run(wg *sync.WaitGroup, in <-chan core.RowMap)
 					continue
 				}
 
-				var err error = nil
 				var value = fmt.Sprint(raw)
 				switch adp.handling {
 				case "upper":
@@ -103,19 +109,13 @@ func (adp *CaseConversionAdapter) Run(wg *sync.WaitGroup, in <-chan core.RowMap)
 					row[field] = strings.ToLower(value)
 				case "title":
 					row[field] = titleCase(value)
-				default:
-					log.Fatalf("Invalid case conversion type: %s", adp.handling)
-				}
-
-				if err != nil {
-					log.Fatalf("Can't convert value %v for field '%s': %s", value, field, err)
 				}
 			}
 
-			out <- row
+			if !core.Send(ctx, out, row) {
+				return
+			}
 		}
-
-		close(out)
 	}()
 
 	return out
@@ -123,6 +123,9 @@ func (adp *CaseConversionAdapter) Run(wg *sync.WaitGroup, in <-chan core.RowMap)
 
 // `titleCase` returns the title case of the given string.
 func titleCase(s string) string {
+	if s == "" {
+		return s
+	}
 	tmp := []rune(strings.ToLower(s))
 	tmp[0] = unicode.ToUpper(tmp[0])
 	return string(tmp)
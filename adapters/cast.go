@@ -21,6 +21,7 @@
 package adapters
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
@@ -62,20 +63,23 @@ func IsaCastToDatatypeAdapter(adapterType string) bool {
 // The `cfg` is the global configuration object.
 // The `taskName` is the name of the task to be executed.
 // The `adapterName` is the name of the adapter to be created.
-func NewCastToDatatypeAdapter(id int, cfg core.Configurator, taskName string, adapterName string) core.Adapter {
+func NewCastToDatatypeAdapter(id int, cfg core.Configurator, taskName string, adapterName string) (core.Adapter, error) {
 	adapterConfig, _ := cfg.GetAdapterConfig(taskName, adapterName)
-	log.Print("NewCastToDatatypeAdapter: ************** HOOOOOLLLLLLLAAAAAA*********", adapterConfig)
-
-	raws := adapterConfig.Arguments["fields"].([]any)
-	log.Print("* Casting fields (raws): ", raws)
-	fields := make([]string, len(raws))
-	for i, field := range raws {
-		fields[i] = fmt.Sprint(field)
-		log.Print("* Casting field: ", fields[i])
+
+	fields, err := adapterConfig.Arguments.Strings("fields")
+	if err != nil {
+		return nil, err
+	}
+	log.Print("* Casting fields: ", fields)
+
+	datatype := adapterConfig.Arguments.String("datatype", "")
+	switch datatype {
+	case "boolean", "int64", "float64", "datetime":
+	default:
+		return nil, errors.New("Invalid datatype " + datatype)
 	}
-	datatype := fmt.Sprint(adapterConfig.Arguments["datatype"])
-	inLayout := fmt.Sprint(adapterConfig.Arguments["inlayout"])
-	outLayout := fmt.Sprint(adapterConfig.Arguments["outlayout"])
+	inLayout := adapterConfig.Arguments.String("inlayout", "")
+	outLayout := adapterConfig.Arguments.String("outlayout", "")
 
 	return &CastToDatatypeAdapter{
 		id:        id,
@@ -85,54 +89,71 @@ func NewCastToDatatypeAdapter(id int, cfg core.Configurator, taskName string, ad
 		dataType:  datatype,
 		inLayout:  inLayout,
 		outLayout: outLayout,
-	}
+	}, nil
 }
 
 // Returns the output channel of the casted rows.
 //
 // The `id` is the identifier of the goroutine.
+// The `ctx` is the context to cancel the processing.
 // The `wg` is the wait group for the goroutine.
+// The `trk` is the tracker to report errors to.
 // The `in` is the input channel of the rows to be casted.
-func (adp *CastToDatatypeAdapter) Run(wg *sync.WaitGroup, in <-chan core.RowMap) <-chan core.RowMap {
+func (adp *CastToDatatypeAdapter) Run(ctx context.Context, wg *sync.WaitGroup, trk *core.Tracker, in <-chan core.RowMap) <-chan core.RowMap {
 	log.Printf("* Creating #%d instance of casting adapter for task %s...", adp.id, adp.task)
 	out := make(chan core.RowMap)
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
+		defer close(out)
 
 		for row := range in {
-			for _, field := range adp.fields {
-				raw, ok := row[field]
-				if raw == nil || !ok {
-					continue
-				}
-
-				var err error = nil
-				var value = fmt.Sprint(raw)
-				switch adp.dataType {
-				case "boolean":
-					row[field], err = strconv.ParseBool(strings.ToLower(value))
-				case "int64":
-					row[field], err = strconv.ParseInt(value, 10, 64)
-				case "float64":
-					row[field], err = strconv.ParseFloat(value, 64)
-				case "datetime":
-					dtValue, _ := time.Parse(adp.inLayout, value)
-					row[field] = dtValue.Format(adp.outLayout)
-				default:
-					err = errors.New("Invalid datatype " + adp.dataType)
-				}
-
-				if err != nil {
-					log.Fatalf("Can't convert value %v for field '%s': %s", value, field, err)
-				}
+			if err := adp.cast(row); err != nil {
+				trk.Fail(adp.adapter, row, err)
+				continue
 			}
-			out <- row
-		}
 
-		close(out)
+			if !core.Send(ctx, out, row) {
+				return
+			}
+		}
 	}()
 
 	return out
 }
+
+// `cast` converts the configured fields of the given row in place.
+func (adp *CastToDatatypeAdapter) cast(row core.RowMap) error {
+	for _, field := range adp.fields {
+		raw, ok := row[field]
+		if raw == nil || !ok {
+			continue
+		}
+
+		var err error = nil
+		var casted any
+		var value = fmt.Sprint(raw)
+		switch adp.dataType {
+		case "boolean":
+			casted, err = strconv.ParseBool(strings.ToLower(value))
+		case "int64":
+			casted, err = strconv.ParseInt(value, 10, 64)
+		case "float64":
+			casted, err = strconv.ParseFloat(value, 64)
+		case "datetime":
+			var dtValue time.Time
+			dtValue, err = time.Parse(adp.inLayout, value)
+			casted = dtValue.Format(adp.outLayout)
+		default:
+			err = errors.New("Invalid datatype " + adp.dataType)
+		}
+
+		if err != nil {
+			return fmt.Errorf("Can't convert value %v for field '%s': %w", value, field, err)
+		}
+		row[field] = casted
+	}
+
+	return nil
+}
@@ -22,6 +22,7 @@ package adapters
 
 import (
 	"bytes"
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"encoding/base64"
@@ -64,28 +65,34 @@ func IsaCryptoAESCBCZeroAdapter(sourceType string) bool {
 // The `cfg` is the global configuration object.
 // The `taskName` is the name of the task to be executed.
 // The `adapterName` is the name of the adapter to be created.
-func NewCryptoAESCBCZeroAdapter(id int, cfg core.Configurator, taskName string, adapterName string) core.Adapter {
+func NewCryptoAESCBCZeroAdapter(id int, cfg core.Configurator, taskName string, adapterName string) (core.Adapter, error) {
 	adapterConfig, _ := cfg.GetAdapterConfig(taskName, adapterName)
 
-	raws := adapterConfig.Arguments["fields"].([]any)
-	fields := make([]string, len(raws))
-	for i, field := range raws {
-		fields[i] = fmt.Sprint(field)
+	fields, err := adapterConfig.Arguments.Strings("fields")
+	if err != nil {
+		return nil, err
 	}
 
-	direction := strings.ToLower(adapterConfig.Arguments["direction"].(string))
+	direction := strings.ToLower(adapterConfig.Arguments.String("direction", ""))
 	if direction != "encrypt" && direction != "decrypt" {
-		log.Fatalf("Invalid identifier for 'direction' parameter: %s", direction)
+		return nil, fmt.Errorf("Invalid identifier for 'direction' parameter: %s", direction)
 	}
 
-	key, err := hex.DecodeString(adapterConfig.Arguments["key"].(string))
+	key, err := hex.DecodeString(adapterConfig.Arguments.String("key", ""))
 	if err != nil {
-		log.Fatalf("Invalid hexadecimal string for 'key' parameter: %v", err)
+		return nil, fmt.Errorf("Invalid hexadecimal string for 'key' parameter: %w", err)
 	}
 
-	iv, err := hex.DecodeString(adapterConfig.Arguments["iv"].(string))
+	iv, err := hex.DecodeString(adapterConfig.Arguments.String("iv", ""))
 	if err != nil {
-		log.Fatalf("Invalid hexadecimal string for 'iv' parameter: %v", err)
+		return nil, fmt.Errorf("Invalid hexadecimal string for 'iv' parameter: %w", err)
+	}
+
+	if _, err := aes.NewCipher(key); err != nil {
+		return nil, fmt.Errorf("Invalid 'key' parameter: %w", err)
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("Invalid 'iv' parameter: length must be %d bytes", aes.BlockSize)
 	}
 
 	return &CryptoAESCBCZeroAdapter{
@@ -96,49 +103,38 @@ func NewCryptoAESCBCZeroAdapter(id int, cfg core.Configurator, taskName string,
 		direction: direction,
 		key:       key,
 		iv:        iv,
-	}
+	}, nil
 }
 
 // Returns the output channel of the encrypted/decrypted rows.
 //
+// The `ctx` is the context to cancel the processing.
 // The `wg` is the wait group for the goroutine.
+// The `trk` is the tracker to report errors to.
 // The `in` is the input channel of the rows to be casted.
-func (adp *CryptoAESCBCZeroAdapter) Run(wg *sync.WaitGroup, in <-chan core.RowMap) <-chan core.RowMap {
+func (adp *CryptoAESCBCZeroAdapter) Run(ctx context.Context, wg *sync.WaitGroup, trk *core.Tracker, in <-chan core.RowMap) <-chan core.RowMap {
 	log.Printf("* Creating #%d instance of CryptoAESCBCZero adapter for task %s...", adp.id, adp.task)
 	out := make(chan core.RowMap)
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
+		defer close(out)
 
 		log.Print(" - Reading from input channel of 'CryptoAESCBCZero' adapter...")
 		counter := 0
 		for row := range in {
-			for _, field := range adp.fields {
-				rawValue, ok := row[field].(string)
-				if !ok {
-					continue
-				}
-				if adp.direction == "decrypt" {
-					plaintxt, err := decryptAESCBCZeropad(rawValue, adp.key, adp.iv)
-					if err != nil {
-						log.Fatalf("Error decrypting field '%s' of row %v: %s", field, row, err)
-					}
-					row[field] = plaintxt
-				} else {
-					ciphertxt, err := encryptAESCBCWithZeropad(rawValue, adp.key, adp.iv)
-					if err != nil {
-						log.Fatalf("Error encrypting field '%s' of row %v: %s", field, row, err)
-					}
-					row[field] = ciphertxt
-				}
+			if err := adp.transform(row); err != nil {
+				trk.Fail(adp.adapter, row, err)
+				continue
 			}
 
 			counter += 1
-			out <- row
+			if !core.Send(ctx, out, row) {
+				break
+			}
 		}
 
-		close(out)
 		log.Printf(" - Closing output channel of CryptoAESCBCZero adapter (%d rows processed)", counter)
 	}()
 
@@ -146,6 +142,31 @@ func (adp *CryptoAESCBCZeroAdapter) Run(wg *sync.WaitGroup, in <-chan core.RowMa
 	return out
 }
 
+// `transform` encrypts or decrypts the configured fields of the given row.
+func (adp *CryptoAESCBCZeroAdapter) transform(row core.RowMap) error {
+	for _, field := range adp.fields {
+		rawValue, ok := row[field].(string)
+		if !ok {
+			continue
+		}
+		if adp.direction == "decrypt" {
+			plaintxt, err := decryptAESCBCZeropad(rawValue, adp.key, adp.iv)
+			if err != nil {
+				return fmt.Errorf("Error decrypting field '%s': %w", field, err)
+			}
+			row[field] = plaintxt
+		} else {
+			ciphertxt, err := encryptAESCBCWithZeropad(rawValue, adp.key, adp.iv)
+			if err != nil {
+				return fmt.Errorf("Error encrypting field '%s': %w", field, err)
+			}
+			row[field] = ciphertxt
+		}
+	}
+
+	return nil
+}
+
 // Implements a AES/CBC/ZeroPad block cipher encryption algorithm.
 //
 // The `plaintxt` is the plain text to be encrypted.
@@ -196,6 +217,10 @@ func decryptAESCBCZeropad(ciphertxt string, key []byte, iv []byte) (string, erro
 		return "", err
 	}
 
+	if len(decodedtxt)%aes.BlockSize() != 0 {
+		return "", fmt.Errorf("Cipher text is not a multiple of the block size")
+	}
+
 	bytestxt := make([]byte, len(decodedtxt))
 	decrypter := cipher.NewCBCDecrypter(aes, iv)
 	decrypter.CryptBlocks(bytestxt, decodedtxt)
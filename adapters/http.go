@@ -0,0 +1,203 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package adapters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/tnotstar/datacat/core"
+	"github.com/tnotstar/datacat/services"
+)
+
+// `HttpRequestAdapter` is an adapter which sends a request to a HTTP
+// service for each row, and passes the row downstream enriched with
+// the response.
+type HttpRequestAdapter struct {
+	// The `id` of the adapter.
+	id int
+	// The `task` of the task which is running into.
+	task string
+	// The name of the `adapter`.
+	adapter string
+	// The `request` template of the requests to the endpoint.
+	request *services.RequestTemplate
+	// The `endpoint` of the service to send the requests to.
+	endpoint *services.Endpoint
+	// The `statusField` receives the status code of the response.
+	statusField string
+	// The `headersField` receives the `headers` of the response.
+	headersField string
+	// The `headers` of the response to be captured.
+	headers []string
+	// The `responseField` receives the body of the response.
+	responseField string
+	// The `responsePath` is the dotted path of the value of the body to
+	// be captured, or empty for the whole body.
+	responsePath string
+	// `passErrors` passes downstream the rows with an error response
+	// instead of failing them.
+	passErrors bool
+}
+
+// `IsaHttpRequestAdapter` returns true if given adapter type
+// is HttpRequestAdapter.
+func IsaHttpRequestAdapter(adapterType string) bool {
+	return adapterType == "http-request-adapter"
+}
+
+// `NewHttpRequestAdapter` creates a new instance of the HTTP request adapter.
+//
+// The `id` is the instance of the adapter to be created.
+// The `cfg` is the global configuration object.
+// The `taskName` is the name of the task to be executed.
+// The `adapterName` is the name of the adapter to be created.
+func NewHttpRequestAdapter(id int, cfg core.Configurator, taskName string, adapterName string) (core.Adapter, error) {
+	adapterConfig, _ := cfg.GetAdapterConfig(taskName, adapterName)
+
+	endpoint, err := services.NewEndpoint(cfg, taskName, adapterConfig.Arguments)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := services.NewRequestTemplate(endpoint.BaseURL(), adapterConfig.Arguments, http.MethodPost)
+	if err != nil {
+		return nil, err
+	}
+
+	headers, err := adapterConfig.Arguments.Strings("responseheaders")
+	if err != nil {
+		return nil, err
+	}
+
+	passErrors, err := adapterConfig.Arguments.Bool("passerrors", false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &HttpRequestAdapter{
+		id:            id,
+		task:          taskName,
+		adapter:       adapterName,
+		request:       request,
+		endpoint:      endpoint,
+		statusField:   adapterConfig.Arguments.String("statusfield", "_status"),
+		headersField:  adapterConfig.Arguments.String("headersfield", "_headers"),
+		headers:       headers,
+		responseField: adapterConfig.Arguments.String("responsefield", "_response"),
+		responsePath:  adapterConfig.Arguments.String("responsepath", ""),
+		passErrors:    passErrors,
+	}, nil
+}
+
+// Returns the output channel of the enriched rows.
+//
+// The `ctx` is the context to cancel the processing.
+// The `wg` is the wait group for the goroutine.
+// The `trk` is the tracker to report errors to.
+// The `in` is the input channel of the rows to be requested.
+func (adp *HttpRequestAdapter) Run(ctx context.Context, wg *sync.WaitGroup, trk *core.Tracker, in <-chan core.RowMap) <-chan core.RowMap {
+	log.Printf("* Creating #%d instance of HTTP request adapter for task %s...", adp.id, adp.task)
+	out := make(chan core.RowMap)
+	adp.endpoint.Share(trk)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(out)
+
+		for row := range in {
+			err := adp.exchange(ctx, row)
+			if ctx.Err() != nil {
+				return
+			}
+			if errors.Is(err, services.ErrAuthorization) {
+				trk.Abort(adp.adapter, err)
+				return
+			}
+			if err != nil {
+				trk.Fail(adp.adapter, row, err)
+				continue
+			}
+
+			if !core.Send(ctx, out, row) {
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// `exchange` sends the request of the given row and stores the status,
+// headers and body of the response into the row.
+func (adp *HttpRequestAdapter) exchange(ctx context.Context, row core.RowMap) error {
+	route, err := adp.request.Route(row)
+	if err != nil {
+		return err
+	}
+	body, err := adp.request.Body(row)
+	if err != nil {
+		return fmt.Errorf("Error building request body: %w", err)
+	}
+
+	res, err := adp.endpoint.Exchange(ctx, route, body)
+	if err != nil {
+		return err
+	}
+
+	succeeded := res.Succeeded()
+	if !succeeded && !adp.passErrors {
+		return res.Err()
+	}
+
+	response, err := res.JSON()
+	switch {
+	case err == nil && succeeded:
+		value, ok := services.LookupPath(response, adp.responsePath)
+		if !ok {
+			return fmt.Errorf("Missing '%s' in response", adp.responsePath)
+		}
+		response = value
+	case err != nil && adp.responsePath == "":
+		// A body which isn't JSON is kept as text.
+		response = string(res.Data)
+	case err != nil && succeeded:
+		return err
+	}
+
+	row[adp.statusField] = res.StatusCode
+	if len(adp.headers) > 0 {
+		headers := make(map[string]any, len(adp.headers))
+		for _, name := range adp.headers {
+			if value := res.Header.Get(name); value != "" {
+				headers[name] = value
+			}
+		}
+		row[adp.headersField] = headers
+	}
+	row[adp.responseField] = response
+	return nil
+}
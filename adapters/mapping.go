@@ -21,6 +21,7 @@
 package adapters
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -59,20 +60,25 @@ func IsaConstantMappingAdapter(adapterType string) bool {
 // The `cfg` is the global configuration object.
 // The `taskName` is the name of the task to be executed.
 // The `adapterName` is the name of the adapter to be created.
-func NewConstantMappingAdapter(id int, cfg core.Configurator, taskName string, adapterName string) core.Adapter {
+func NewConstantMappingAdapter(id int, cfg core.Configurator, taskName string, adapterName string) (core.Adapter, error) {
 	adapterConfig, _ := cfg.GetAdapterConfig(taskName, adapterName)
 
-	raws := adapterConfig.Arguments["fields"].([]any)
-	fields := make([]string, len(raws))
-	for i, field := range raws {
-		fields[i] = fmt.Sprint(field)
+	fields, err := adapterConfig.Arguments.Strings("fields")
+	if err != nil {
+		return nil, err
 	}
 
-	relative := fmt.Sprint(adapterConfig.Arguments["filename"])
+	relative, err := adapterConfig.Arguments.RequiredString("filename")
+	if err != nil {
+		return nil, err
+	}
 	basePath := filepath.Dir(cfg.GetConfigFilename())
 	filename := core.ResolveFilename(basePath, relative)
-	mapName := fmt.Sprint(adapterConfig.Arguments["mapname"])
-	mapData := getMapData(filename, mapName)
+	mapName := adapterConfig.Arguments.String("mapname", "")
+	mapData, err := getMapData(filename, mapName)
+	if err != nil {
+		return nil, err
+	}
 	otherwise := fmt.Sprint(adapterConfig.Arguments["otherwise"])
 
 	return &ConstantMappingAdapter{
@@ -82,20 +88,23 @@ func NewConstantMappingAdapter(id int, cfg core.Configurator, taskName string, a
 		fields:    fields,
 		mapData:   mapData,
 		otherwise: otherwise,
-	}
+	}, nil
 }
 
 // Returns the output channel of the constant mapping rows.
 //
+// The `ctx` is the context to cancel the processing.
 // The `wg` is the wait group for the goroutine.
+// The `trk` is the tracker to report errors to.
 // The `in` is the input channel of the rows to be casted.
-func (adp *ConstantMappingAdapter) Run(wg *sync.WaitGroup, in <-chan core.RowMap) <-chan core.RowMap {
+func (adp *ConstantMappingAdapter) Run(ctx context.Context, wg *sync.WaitGroup, trk *core.Tracker, in <-chan core.RowMap) <-chan core.RowMap {
 	log.Printf("* Creating #%d instance of constant mapping adapter for task %s...", adp.id, adp.task)
 	out := make(chan core.RowMap)
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
+		defer close(out)
 
 		for row := range in {
 			for _, field := range adp.fields {
@@ -112,42 +121,42 @@ func (adp *ConstantMappingAdapter) Run(wg *sync.WaitGroup, in <-chan core.RowMap
 				}
 			}
 
-			out <- row
+			if !core.Send(ctx, out, row) {
+				return
+			}
 		}
-
-		close(out)
 	}()
 
 	return out
 }
 
 // `getMapData` returns the mapped terms from the file with given filename.
-func getMapData(filename string, mapName string) map[string]string {
+func getMapData(filename string, mapName string) (map[string]string, error) {
 	data, err := os.ReadFile(filename)
 	if err != nil {
-		log.Fatalf("Error reading mapping file '%s': %v", filename, err)
+		return nil, fmt.Errorf("Error reading mapping file '%s': %w", filename, err)
 	}
 
 	var raw map[string]any = make(map[string]any)
 
 	if err = yaml.Unmarshal(data, &raw); err != nil {
-		log.Fatalf("Error parsing mapping file '%s': %v", filename, err)
+		return nil, fmt.Errorf("Error parsing mapping file '%s': %w", filename, err)
 	}
 
-	mappings, ok := raw["mappings"]
+	mappings, ok := raw["mappings"].(map[string]any)
 	if !ok {
-		log.Fatalf("Invalid top mapping container at file '%s'", filename)
+		return nil, fmt.Errorf("Invalid top mapping container at file '%s'", filename)
 	}
 
-	mapRaw, ok := mappings.(map[string]any)[mapName]
+	mapRaw, ok := mappings[mapName].(map[string]any)
 	if !ok {
-		log.Fatalf("Invalid mapping object with name '%s'", mapName)
+		return nil, fmt.Errorf("Invalid mapping object with name '%s'", mapName)
 	}
 
 	mapData := make(map[string]string)
-	for k, v := range mapRaw.(map[string]any) {
+	for k, v := range mapRaw {
 		mapData[k] = fmt.Sprint(v)
 	}
 
-	return mapData
+	return mapData, nil
 }
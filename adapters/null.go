@@ -21,6 +21,7 @@
 package adapters
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"sync"
@@ -52,30 +53,36 @@ func IsaNullHandlingAdapter(adapterType string) bool {
 // The `cfg` is the global configuration object.
 // The `taskName` is the name of the task to be executed.
 // The `adapterName` is the name of the adapter to be created.
-func NewNullHandlingAdapter(id int, cfg core.Configurator, taskName string, adapterName string) core.Adapter {
+func NewNullHandlingAdapter(id int, cfg core.Configurator, taskName string, adapterName string) (core.Adapter, error) {
 	adapterConfig, _ := cfg.GetAdapterConfig(taskName, adapterName)
 
-	handling := fmt.Sprint(adapterConfig.Arguments["handling"])
+	handling := adapterConfig.Arguments.String("handling", "")
+	if handling != "remove" {
+		return nil, fmt.Errorf("Invalid null handling type: %s", handling)
+	}
 
 	return &NullHandlingAdapter{
 		id:       id,
 		task:     taskName,
 		adapter:  adapterName,
 		handling: handling,
-	}
+	}, nil
 }
 
 // Returns the output channel of the null handled rows.
 //
+// The `ctx` is the context to cancel the processing.
 // The `wg` is the wait group for the goroutine.
+// The `trk` is the tracker to report errors to.
 // The `in` is the input channel of the rows to be casted.
-func (adp *NullHandlingAdapter) Run(wg *sync.WaitGroup, in <-chan core.RowMap) <-chan core.RowMap {
+func (adp *NullHandlingAdapter) Run(ctx context.Context, wg *sync.WaitGroup, trk *core.Tracker, in <-chan core.RowMap) <-chan core.RowMap {
 	log.Printf("* Creating #%d instance of null handling adapter for task %s...", adp.id, adp.task)
 	out := make(chan core.RowMap)
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
+		defer close(out)
 
 		for row := range in {
 			for field, value := range row {
@@ -83,15 +90,14 @@ func (adp *NullHandlingAdapter) Run(wg *sync.WaitGroup, in <-chan core.RowMap) <
 					switch adp.handling {
 					case "remove":
 						delete(row, field)
-					default:
-						log.Fatalf("Invalid null handling type: %s", adp.handling)
 					}
 				}
 			}
-			out <- row
-		}
 
-		close(out)
+			if !core.Send(ctx, out, row) {
+				return
+			}
+		}
 	}()
 
 	return out
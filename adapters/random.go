@@ -22,6 +22,7 @@ package adapters
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"log"
 	"math/rand"
@@ -72,7 +73,7 @@ func IsaNamesRandomizerAdapter(adapterType string) bool {
 // The `cfg` is the global configuration object.
 // The `taskName` is the name of the task to be executed.
 // The `adapterName` is the name of the adapter to be created.
-func NewNamesRandomizerAdapter(id int, cfg core.Configurator, taskName string, adapterName string) core.Adapter {
+func NewNamesRandomizerAdapter(id int, cfg core.Configurator, taskName string, adapterName string) (core.Adapter, error) {
 	adapterConfig, _ := cfg.GetAdapterConfig(taskName, adapterName)
 
 	firstName := fmt.Sprint(adapterConfig.Arguments["firstname"])
@@ -81,7 +82,7 @@ func NewNamesRandomizerAdapter(id int, cfg core.Configurator, taskName string, a
 
 	randomArgs, ok := adapterConfig.Arguments["random"].(map[string]any)
 	if !ok {
-		log.Fatalf("Invalid random arguments: %v", randomArgs)
+		return nil, fmt.Errorf("Invalid random arguments: %v", adapterConfig.Arguments["random"])
 	}
 
 	basePath := filepath.Dir(cfg.GetConfigFilename())
@@ -90,9 +91,18 @@ func NewNamesRandomizerAdapter(id int, cfg core.Configurator, taskName string, a
 	femaleFilename := core.ResolveFilename(basePath, fmt.Sprint(randomArgs["femalenames"]))
 
 	rng := newRandomGenerator(fmt.Sprint(randomArgs["seed"]))
-	allData := getNamesData(allFilename)
-	maleData := getNamesData(maleFilename)
-	femaleData := getNamesData(femaleFilename)
+	allData, err := getNamesData(allFilename)
+	if err != nil {
+		return nil, err
+	}
+	maleData, err := getNamesData(maleFilename)
+	if err != nil {
+		return nil, err
+	}
+	femaleData, err := getNamesData(femaleFilename)
+	if err != nil {
+		return nil, err
+	}
 
 	return &NamesRandomizerAdapter{
 		id:         id,
@@ -105,20 +115,23 @@ func NewNamesRandomizerAdapter(id int, cfg core.Configurator, taskName string, a
 		allData:    allData,
 		maleData:   maleData,
 		femaleData: femaleData,
-	}
+	}, nil
 }
 
 // Returns the output channel of the names randomized rows.
 //
+// The `ctx` is the context to cancel the processing.
 // The `wg` is the wait group for the goroutine.
+// The `trk` is the tracker to report errors to.
 // The `in` is the input channel of the rows to be casted.
-func (adp *NamesRandomizerAdapter) Run(wg *sync.WaitGroup, in <-chan core.RowMap) <-chan core.RowMap {
+func (adp *NamesRandomizerAdapter) Run(ctx context.Context, wg *sync.WaitGroup, trk *core.Tracker, in <-chan core.RowMap) <-chan core.RowMap {
 	log.Printf("* Creating #%d instance of names randomizer adapter for task %s...", adp.id, adp.task)
 	out := make(chan core.RowMap)
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
+		defer close(out)
 
 		for row := range in {
 			if _, ok := row[adp.firstName]; ok {
@@ -134,10 +147,10 @@ func (adp *NamesRandomizerAdapter) Run(wg *sync.WaitGroup, in <-chan core.RowMap
 				row[adp.lastName] = getRandomName(&adp.allData)
 			}
 
-			out <- row
+			if !core.Send(ctx, out, row) {
+				return
+			}
 		}
-
-		close(out)
 	}()
 
 	return out
@@ -159,10 +172,10 @@ func newRandomGenerator(raw string) *rand.Rand {
 }
 
 // `getNamesData` returns the names data from a file with given filename.
-func getNamesData(filename string) []nameData {
+func getNamesData(filename string) ([]nameData, error) {
 	file, err := os.Open(filename)
 	if err != nil {
-		log.Fatalf("Error opening file %s: %v", filename, err)
+		return nil, fmt.Errorf("Error opening file %s: %w", filename, err)
 	}
 	defer file.Close()
 
@@ -192,7 +205,15 @@ func getNamesData(filename string) []nameData {
 		})
 	}
 
-	return names
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Error reading file %s: %w", filename, err)
+	}
+
+	if len(names) == 0 {
+		return nil, fmt.Errorf("No names data found in file %s", filename)
+	}
+
+	return names, nil
 }
 
 // `getRandomName` returns a random name from the given data.
@@ -21,6 +21,7 @@
 package cmd
 
 import (
+	"errors"
 	"log"
 
 	"github.com/spf13/cobra"
@@ -34,6 +35,31 @@ var cfgFile string
 // `taskName` is the name of the task to be executed.
 var taskName string
 
+// The exit codes returned by the application.
+const (
+	// `ExitOK` is returned when the command succeeded.
+	ExitOK = 0
+	// `ExitFailure` is returned when a task failed while running.
+	ExitFailure = 1
+	// `ExitUsage` is returned on configuration or command line errors.
+	ExitUsage = 2
+	// `ExitInterrupted` is returned when a task is stopped by a signal.
+	ExitInterrupted = 130
+)
+
+// `exitCode` is the exit code set by the executed command.
+var exitCode = ExitOK
+
+// An `exitError` is an error carrying the exit code of the application.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
 // `rootCmd` represents the base command line handler.
 var rootCmd = &cobra.Command{
 	Use:   "datacat",
@@ -43,8 +69,13 @@ its data to one or more local NDJSON file(s).
 
 As an API end-point caller, it reads the NDJSON file(s) and
 uploads its data to a given API server.`,
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
-		core.LoadConfig(cfgFile)
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := core.LoadConfig(cfgFile); err != nil {
+			return &exitError{code: ExitUsage, err: err}
+		}
+		return nil
 	},
 }
 
@@ -58,10 +89,18 @@ func init() {
 }
 
 // `ExecuteRoot` executes the `root` command and handles errors
-// appropriately. This function is called from `main.main()`.
-func ExecuteRoot() {
+// appropriately. This function is called from `main.main()` and returns
+// the exit code of the application.
+func ExecuteRoot() int {
 	err := rootCmd.Execute()
-	if err != nil {
-		log.Fatal(err)
+	if err == nil {
+		return exitCode
+	}
+
+	log.Print(err)
+	var exitErr *exitError
+	if errors.As(err, &exitErr) {
+		return exitErr.code
 	}
+	return ExitUsage
 }
@@ -21,7 +21,17 @@
 package cmd
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
 	"github.com/spf13/cobra"
+	"github.com/tnotstar/datacat/core"
 	"github.com/tnotstar/datacat/tasks"
 )
 
@@ -31,12 +41,69 @@ var runCmd = &cobra.Command{
 	Short: "Run the task with given name",
 	Long: `This command execute a task to retrieve data from a source,
 make some optional transformation and sent it to a target endpoint.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		tasks.RunTask(taskName)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		params, err := parseParams(runParams)
+		if err != nil {
+			return &exitError{code: ExitUsage, err: err}
+		}
+		runOptions.Params = params
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		// A second signal kills the process with the default behaviour.
+		go func() {
+			<-ctx.Done()
+			stop()
+		}()
+
+		result := tasks.RunTask(ctx, core.GetConfig(), taskName, runOptions)
+		log.Print("Summary of ", result)
+
+		switch {
+		case result.Ok():
+			exitCode = ExitOK
+		case errors.Is(result.Err, core.ErrSetup):
+			exitCode = ExitUsage
+		case errors.Is(result.Err, core.ErrInterrupted):
+			exitCode = ExitInterrupted
+		default:
+			exitCode = ExitFailure
+		}
+		return nil
 	},
 }
 
+// `runOptions` are the execution options given in the command line.
+var runOptions tasks.Options
+
+// `runParams` are the query parameters given in the command line.
+var runParams []string
+
+// `parseParams` parses a list of `key=value` query parameters.
+func parseParams(params []string) (map[string]string, error) {
+	values := make(map[string]string, len(params))
+	for _, param := range params {
+		key, value, ok := strings.Cut(param, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("Invalid query parameter '%s', expected key=value", param)
+		}
+		values[strings.TrimSpace(key)] = value
+	}
+	return values, nil
+}
+
 // `init` initializes the `run` command line handler.
 func init() {
+	runCmd.Flags().BoolVar(&runOptions.Resume, "resume", false,
+		"continue the task from its last committed checkpoint")
+	runCmd.Flags().BoolVar(&runOptions.ResetWatermark, "reset-watermark", false,
+		"discard the stored watermark and read all the rows again")
+	runCmd.Flags().StringVar(&runOptions.Watermark, "watermark", "",
+		"read only the rows beyond the given watermark value")
+	runCmd.MarkFlagsMutuallyExclusive("reset-watermark", "watermark")
+	runCmd.Flags().StringArrayVar(&runParams, "param", nil,
+		"set the value of a query parameter as key=value (repeatable)")
+
 	rootCmd.AddCommand(runCmd)
 }
@@ -0,0 +1,202 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// `Arguments` is the map of arguments given to a source, adapter or
+// target in the configuration file.
+type Arguments map[string]any
+
+// `Has` returns true if the argument with given key is present.
+func (args Arguments) Has(key string) bool {
+	value, ok := args[key]
+	return ok && value != nil
+}
+
+// `String` returns the argument with given key as a string, or the
+// `def` value if the argument is missing.
+func (args Arguments) String(key string, def string) string {
+	if !args.Has(key) {
+		return def
+	}
+	return fmt.Sprint(args[key])
+}
+
+// `RequiredString` returns the argument with given key as a string, or
+// an error if the argument is missing or empty.
+func (args Arguments) RequiredString(key string) (string, error) {
+	value := args.String(key, "")
+	if strings.TrimSpace(value) == "" {
+		return "", fmt.Errorf("Missing required argument '%s'", key)
+	}
+	return value, nil
+}
+
+// `Int` returns the argument with given key as an integer, or the
+// `def` value if the argument is missing.
+func (args Arguments) Int(key string, def int) (int, error) {
+	if !args.Has(key) {
+		return def, nil
+	}
+
+	switch value := args[key].(type) {
+	case int:
+		return value, nil
+	case int64:
+		return int(value), nil
+	case float64:
+		return int(value), nil
+	}
+
+	value, err := strconv.Atoi(strings.TrimSpace(fmt.Sprint(args[key])))
+	if err != nil {
+		return def, fmt.Errorf("Invalid integer for argument '%s': %w", key, err)
+	}
+	return value, nil
+}
+
+// `Float` returns the argument with given key as a float, or the
+// `def` value if the argument is missing.
+func (args Arguments) Float(key string, def float64) (float64, error) {
+	if !args.Has(key) {
+		return def, nil
+	}
+
+	switch value := args[key].(type) {
+	case float64:
+		return value, nil
+	case int:
+		return float64(value), nil
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimSpace(fmt.Sprint(args[key])), 64)
+	if err != nil {
+		return def, fmt.Errorf("Invalid number for argument '%s': %w", key, err)
+	}
+	return value, nil
+}
+
+// `Bool` returns the argument with given key as a boolean, or the
+// `def` value if the argument is missing.
+func (args Arguments) Bool(key string, def bool) (bool, error) {
+	if !args.Has(key) {
+		return def, nil
+	}
+
+	if value, ok := args[key].(bool); ok {
+		return value, nil
+	}
+
+	value, err := strconv.ParseBool(strings.ToLower(strings.TrimSpace(fmt.Sprint(args[key]))))
+	if err != nil {
+		return def, fmt.Errorf("Invalid boolean for argument '%s': %w", key, err)
+	}
+	return value, nil
+}
+
+// `Duration` returns the argument with given key as a time duration, or
+// the `def` value if the argument is missing. Plain numbers are taken
+// as seconds.
+func (args Arguments) Duration(key string, def time.Duration) (time.Duration, error) {
+	if !args.Has(key) {
+		return def, nil
+	}
+
+	raw := strings.TrimSpace(fmt.Sprint(args[key]))
+	if seconds, err := strconv.ParseFloat(raw, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+
+	value, err := time.ParseDuration(raw)
+	if err != nil {
+		return def, fmt.Errorf("Invalid duration for argument '%s': %w", key, err)
+	}
+	return value, nil
+}
+
+// `Strings` returns the argument with given key as a list of strings.
+// A single value is returned as a list with one element.
+func (args Arguments) Strings(key string) ([]string, error) {
+	if !args.Has(key) {
+		return []string{}, nil
+	}
+
+	switch raws := args[key].(type) {
+	case []any:
+		values := make([]string, len(raws))
+		for i, raw := range raws {
+			values[i] = fmt.Sprint(raw)
+		}
+		return values, nil
+	case []string:
+		return raws, nil
+	case map[string]any:
+		return nil, fmt.Errorf("Invalid list for argument '%s'", key)
+	}
+
+	return []string{fmt.Sprint(args[key])}, nil
+}
+
+// `Map` returns the argument with given key as a nested map of
+// arguments, or an empty map if the argument is missing.
+func (args Arguments) Map(key string) (Arguments, error) {
+	if !args.Has(key) {
+		return Arguments{}, nil
+	}
+
+	switch value := args[key].(type) {
+	case map[string]any:
+		return Arguments(value), nil
+	case Arguments:
+		return value, nil
+	}
+
+	return nil, fmt.Errorf("Invalid map for argument '%s'", key)
+}
+
+// `Char` returns the single character argument with given key, or the
+// default value. An empty string returns zero. The names `tab` and `\t`
+// are accepted for the tab character.
+func (args Arguments) Char(key string, def string) (rune, error) {
+	text := def
+	if args.Has(key) {
+		text = args.String(key, def)
+	}
+
+	switch text {
+	case "":
+		return 0, nil
+	case "tab", `\t`:
+		return '\t', nil
+	}
+	if utf8.RuneCountInString(text) != 1 {
+		return 0, fmt.Errorf("Invalid character for argument '%s': %q", key, text)
+	}
+	char, _ := utf8.DecodeRuneInString(text)
+	return char, nil
+}
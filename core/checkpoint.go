@@ -0,0 +1,233 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package core
+
+import (
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+)
+
+// The default number of processed rows between checkpoints.
+const defaultCheckpointInterval = 1000
+
+// `SequenceField` is the reserved field which carries the sequence
+// number of each row read by the source of a checkpointed task, so that
+// the row is followed up to the target. Adapters which rebuild a row
+// must keep it, and targets don't write it (see `RowMap.Data`).
+const SequenceField = "_sequence"
+
+// A `Checkpointer` follows every row from the source to the target, and
+// commits the offset of the rows processed without gaps to the state
+// store of the task. Rows are identified by their `SequenceField`.
+type Checkpointer struct {
+	// The `store` of the task state.
+	store *StateStore
+	// The `key` column to record as watermark.
+	key string
+	// The `interval` of processed rows between commits.
+	interval int64
+	// The `mutex` guards the fields below.
+	mutex sync.Mutex
+	// The number of rows still to `skip` from the source.
+	skip int64
+	// The sequence number of the `next` row read from the source.
+	next int64
+	// The sequence numbers of the `pending` rows.
+	pending map[int64]bool
+	// The `settled` rows after the offset, with their key values.
+	settled map[int64]any
+	// The `offset` of rows processed without gaps.
+	offset int64
+	// The key value of the last row before the offset.
+	lastKey any
+	// The number of rows `acknowledged` by the target.
+	acknowledged int64
+	// The sizes of the `outputs` files of the targets, by file name.
+	outputs map[string]int64
+	// The offset of the last commit.
+	committed int64
+}
+
+// `NewCheckpointer` creates a checkpointer which saves its checkpoints
+// to the given `store`.
+//
+// The `config` is the checkpoint configuration of the task.
+// The `resume` is the checkpoint to resume from, or nil to start over.
+// The `skip` is the number of source rows to be skipped on resume.
+func NewCheckpointer(store *StateStore, config *CheckpointConfig, resume *Checkpoint, skip int64) *Checkpointer {
+	interval := config.Interval
+	if interval <= 0 {
+		interval = defaultCheckpointInterval
+	}
+
+	cp := &Checkpointer{
+		store:    store,
+		key:      config.Key,
+		interval: interval,
+		skip:     skip,
+		pending:  make(map[int64]bool),
+		settled:  make(map[int64]any),
+		outputs:  make(map[string]int64),
+	}
+
+	if resume != nil {
+		cp.next = resume.Offset
+		cp.offset = resume.Offset
+		cp.committed = resume.Offset
+		cp.lastKey = resume.Key
+		cp.acknowledged = resume.Acknowledged
+		maps.Copy(cp.outputs, resume.Outputs)
+	}
+
+	return cp
+}
+
+// `read` registers a row read by the source, and tags it with its
+// sequence number. It returns false if the row was already processed by
+// a previous execution.
+func (cp *Checkpointer) read(row RowMap) bool {
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+
+	if cp.skip > 0 {
+		cp.skip--
+		return false
+	}
+
+	row[SequenceField] = cp.next
+	cp.pending[cp.next] = true
+	cp.next++
+	return true
+}
+
+// `settle` registers a row which reached the target or the dead-letter
+// output, and commits a checkpoint when the interval is completed.
+func (cp *Checkpointer) settle(row RowMap, acknowledged bool) error {
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+
+	if err := cp.settleRow(row, acknowledged); err != nil {
+		return err
+	}
+	if cp.offset-cp.committed >= cp.interval {
+		return cp.commit(false)
+	}
+	return nil
+}
+
+// `flushed` registers the rows flushed by a target, with the size of
+// its `output` file after the flush, if any, and commits a checkpoint
+// if the offset or the size has changed.
+func (cp *Checkpointer) flushed(rows []RowMap, output string, size int64) error {
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+
+	for _, row := range rows {
+		if err := cp.settleRow(row, true); err != nil {
+			return err
+		}
+	}
+
+	resized := false
+	if previous, ok := cp.outputs[output]; output != "" && (!ok || previous != size) {
+		cp.outputs[output] = size
+		resized = true
+	}
+
+	if cp.offset > cp.committed || resized {
+		return cp.commit(false)
+	}
+	return nil
+}
+
+// `outputSize` returns the size of the given output file at the last
+// checkpoint, if it's known.
+func (cp *Checkpointer) outputSize(output string) (int64, bool) {
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+	size, ok := cp.outputs[output]
+	return size, ok
+}
+
+// `settleRow` registers a settled row without locking, and moves the
+// offset past the rows settled without gaps.
+func (cp *Checkpointer) settleRow(row RowMap, acknowledged bool) error {
+	seq, ok := row[SequenceField].(int64)
+	if !ok {
+		return fmt.Errorf("Row without its %s field, dropped by an adapter", SequenceField)
+	}
+	if !cp.pending[seq] {
+		return nil
+	}
+	delete(cp.pending, seq)
+
+	if acknowledged {
+		cp.acknowledged++
+	}
+
+	var key any
+	if cp.key != "" {
+		key = row[cp.key]
+	}
+	cp.settled[seq] = key
+
+	for {
+		key, ok := cp.settled[cp.offset]
+		if !ok {
+			break
+		}
+		delete(cp.settled, cp.offset)
+		cp.lastKey = key
+		cp.offset++
+	}
+	return nil
+}
+
+// `Commit` saves the current checkpoint to the state store.
+//
+// The `completed` flag indicates that the task run to its end.
+func (cp *Checkpointer) Commit(completed bool) error {
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+	return cp.commit(completed)
+}
+
+// `commit` saves the current checkpoint without locking.
+func (cp *Checkpointer) commit(completed bool) error {
+	checkpoint := &Checkpoint{
+		Offset:       cp.offset,
+		Key:          cp.lastKey,
+		Acknowledged: cp.acknowledged,
+		Outputs:      maps.Clone(cp.outputs),
+		Completed:    completed,
+		Updated:      time.Now(),
+	}
+
+	err := cp.store.Update(func(state *TaskState) {
+		state.Checkpoint = checkpoint
+	})
+	if err == nil {
+		cp.committed = cp.offset
+	}
+	return err
+}
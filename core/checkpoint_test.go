@@ -0,0 +1,109 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package core
+
+import (
+	"testing"
+)
+
+func newTestCheckpointer(t *testing.T) *Checkpointer {
+	t.Helper()
+	cfg := &Config{StateDir: t.TempDir()}
+	store := OpenStateStore(cfg, "test")
+	return NewCheckpointer(store, &CheckpointConfig{Interval: 1}, nil, 0)
+}
+
+func TestCheckpointerSettlesRebuiltRows(t *testing.T) {
+	cp := newTestCheckpointer(t)
+
+	rows := []RowMap{{"id": 1}, {"id": 2}}
+	for _, row := range rows {
+		if !cp.read(row) {
+			t.Fatalf("row %v skipped", row)
+		}
+	}
+
+	for _, row := range rows {
+		rebuilt := make(RowMap, len(row))
+		for key, value := range row {
+			rebuilt[key] = value
+		}
+		if err := cp.settle(rebuilt, true); err != nil {
+			t.Fatalf("settle: %v", err)
+		}
+	}
+
+	if cp.offset != 2 || cp.acknowledged != 2 {
+		t.Errorf("offset %d, acknowledged %d, want 2 and 2", cp.offset, cp.acknowledged)
+	}
+	if len(cp.pending) != 0 {
+		t.Errorf("pending rows left: %v", cp.pending)
+	}
+}
+
+func TestCheckpointerRejectsRowsWithoutSequence(t *testing.T) {
+	cp := newTestCheckpointer(t)
+
+	row := RowMap{"id": 1}
+	cp.read(row)
+	if err := cp.settle(RowMap{"id": 1}, true); err == nil {
+		t.Error("settle of a row without sequence number succeeded")
+	}
+}
+
+func TestRowMapData(t *testing.T) {
+	row := RowMap{"id": 1, SequenceField: int64(0)}
+	data := row.Data()
+	if _, ok := data[SequenceField]; ok || len(data) != 1 {
+		t.Errorf("Data() = %v, want only the id", data)
+	}
+	if _, ok := row[SequenceField]; !ok {
+		t.Error("Data() modified the row")
+	}
+}
+
+func TestCheckpointerCommitsFlushedRows(t *testing.T) {
+	cfg := &Config{StateDir: t.TempDir()}
+	store := OpenStateStore(cfg, "test")
+	cp := NewCheckpointer(store, &CheckpointConfig{Interval: 1000}, nil, 0)
+
+	rows := []RowMap{{"id": 1}, {"id": 2}, {"id": 3}}
+	for _, row := range rows {
+		cp.read(row)
+	}
+	if err := cp.flushed(rows[:2], "output.jsonl", 42); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkpoint := state.Checkpoint
+	if checkpoint == nil || checkpoint.Offset != 2 || checkpoint.Acknowledged != 2 || checkpoint.Outputs["output.jsonl"] != 42 {
+		t.Fatalf("Checkpoint = %+v, want offset 2 and output size 42", checkpoint)
+	}
+
+	resumed := NewCheckpointer(store, &CheckpointConfig{}, checkpoint, checkpoint.Offset)
+	if size, ok := resumed.outputSize("output.jsonl"); !ok || size != 42 {
+		t.Errorf("outputSize() = %d, %v after resume, want 42", size, ok)
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package core
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// The compression formats of the files.
+const (
+	CompressionAuto  = "auto"
+	CompressionNone  = "none"
+	CompressionGzip  = "gzip"
+	CompressionZstd  = "zstd"
+	CompressionBzip2 = "bzip2"
+)
+
+// The `compressionExtensions` are the file extensions of each
+// compression format.
+var compressionExtensions = map[string]string{
+	".gz":    CompressionGzip,
+	".gzip":  CompressionGzip,
+	".zst":   CompressionZstd,
+	".zstd":  CompressionZstd,
+	".bz2":   CompressionBzip2,
+	".bzip2": CompressionBzip2,
+}
+
+// `DetectCompression` returns the compression format of the file with
+// the given name: the given format, or the one of its extension if it's
+// empty or `auto`.
+func DetectCompression(fileName string, compression string) (string, error) {
+	switch strings.ToLower(compression) {
+	case "", CompressionAuto:
+		if format, ok := compressionExtensions[strings.ToLower(filepath.Ext(fileName))]; ok {
+			return format, nil
+		}
+		return CompressionNone, nil
+	case CompressionNone, CompressionGzip, CompressionZstd, CompressionBzip2:
+		return strings.ToLower(compression), nil
+	}
+	return "", fmt.Errorf("Invalid compression format: %s", compression)
+}
+
+// `TrimCompressionExt` returns the given file name without the
+// extension of its compression format, if any.
+func TrimCompressionExt(fileName string) string {
+	ext := filepath.Ext(fileName)
+	if _, ok := compressionExtensions[strings.ToLower(ext)]; ok {
+		return strings.TrimSuffix(fileName, ext)
+	}
+	return fileName
+}
+
+// `NewDecompressor` returns a reader of the uncompressed data of the
+// given reader, compressed in the given format.
+func NewDecompressor(reader io.Reader, compression string) (io.ReadCloser, error) {
+	switch compression {
+	case CompressionGzip:
+		return gzip.NewReader(reader)
+	case CompressionZstd:
+		decoder, err := zstd.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	case CompressionBzip2:
+		return io.NopCloser(bzip2.NewReader(reader)), nil
+	}
+	return io.NopCloser(reader), nil
+}
+
+// A `Compressor` compresses the data written to it. `Flush` ends the
+// compressed stream of the pending data (a gzip member or a zstd frame),
+// so that it can be read back and the file can be cut after it and
+// appended to, and `Close` ends the last stream, without closing the
+// underlying writer.
+type Compressor interface {
+	io.Writer
+	Flush() error
+	Close() error
+}
+
+// `nopCompressor` is the compressor of the uncompressed files.
+type nopCompressor struct {
+	io.Writer
+}
+
+func (nopCompressor) Flush() error { return nil }
+func (nopCompressor) Close() error { return nil }
+
+// `NewCompressor` returns a compressor in the given format which writes
+// to the given writer. The `level` is specific to the format, or 0 for
+// its default level.
+func NewCompressor(writer io.Writer, compression string, level int) (Compressor, error) {
+	switch compression {
+	case CompressionGzip:
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		stream, err := gzip.NewWriterLevel(writer, level)
+		if err != nil {
+			return nil, err
+		}
+		return &streamCompressor{writer: writer, stream: stream}, nil
+	case CompressionZstd:
+		var options []zstd.EOption
+		if level != 0 {
+			options = append(options, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		}
+		stream, err := zstd.NewWriter(writer, options...)
+		if err != nil {
+			return nil, err
+		}
+		return &streamCompressor{writer: writer, stream: stream}, nil
+	case CompressionBzip2:
+		return nil, fmt.Errorf("Compression format %s is read-only", compression)
+	}
+	return nopCompressor{writer}, nil
+}
+
+// A `resettableStream` is a compressed stream which can be restarted
+// on a writer, like the gzip and zstd writers.
+type resettableStream interface {
+	io.WriteCloser
+	Reset(writer io.Writer)
+}
+
+// A `streamCompressor` writes a sequence of compressed streams, one for
+// the data written between flushes, which are read back as a single
+// one.
+type streamCompressor struct {
+	// The underlying `writer`.
+	writer io.Writer
+	// The current compressed `stream`.
+	stream resettableStream
+	// `pending` is true if data has been written to the current stream.
+	pending bool
+	// `ended` is true if a stream has already been ended.
+	ended bool
+}
+
+// `Write` implements the `io.Writer` interface.
+func (comp *streamCompressor) Write(data []byte) (int, error) {
+	comp.pending = true
+	return comp.stream.Write(data)
+}
+
+// `Flush` ends the current stream, if it has pending data, and starts a
+// new one.
+func (comp *streamCompressor) Flush() error {
+	if !comp.pending {
+		return nil
+	}
+	if err := comp.stream.Close(); err != nil {
+		return err
+	}
+	comp.stream.Reset(comp.writer)
+	comp.pending, comp.ended = false, true
+	return nil
+}
+
+// `Close` ends the current stream, unless it's empty and follows
+// another one.
+func (comp *streamCompressor) Close() error {
+	if !comp.pending && comp.ended {
+		return nil
+	}
+	comp.pending, comp.ended = false, true
+	return comp.stream.Close()
+}
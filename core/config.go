@@ -22,10 +22,15 @@ package core
 
 import (
 	"errors"
-	"log"
+	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/spf13/viper"
@@ -40,19 +45,75 @@ type Config struct {
 	Services map[string]ServiceConfig `mapstructure:"services"`
 
 	// A map with all task configurations.
-	Tasks map[string]struct {
-		// Specifies the configuration for the source endpoint.
-		Source SourceConfig `mapstructure:"source"`
-		// Specifies the configuration of the adapters array.
-		Adapters map[string]AdapterConfig `mapstructure:"adapters"`
-		// Specifies the configuration of the target endpoint.
-		Target TargetConfig `mapstructure:"target"`
-	}
+	Tasks map[string]TaskConfig `mapstructure:"tasks"`
+
+	// The directory where the state of the tasks is stored.
+	StateDir string `mapstructure:"statedir"`
 
 	// The name of the configuration file loaded from.
 	configFilename string
 }
 
+// `TaskConfig` specifies the configuration of a task.
+type TaskConfig struct {
+	// Specifies the configuration for the source endpoint.
+	Source SourceConfig `mapstructure:"source"`
+	// Specifies the configuration of the adapters array.
+	Adapters map[string]AdapterConfig `mapstructure:"adapters"`
+	// Specifies the configuration of the target endpoint.
+	Target TargetConfig `mapstructure:"target"`
+	// Specifies the `Shutdown` behaviour when the task is interrupted.
+	Shutdown ShutdownConfig `mapstructure:"shutdown"`
+	// A flag to indicate that rows must reach the target in the same
+	// order as they were read by the source.
+	Ordered bool `mapstructure:"ordered"`
+	// Specifies the `DeadLetter` output for the rows which fail.
+	DeadLetter *DeadLetterConfig `mapstructure:"deadletter"`
+	// Specifies the `Checkpoint` settings to resume the task.
+	Checkpoint *CheckpointConfig `mapstructure:"checkpoint"`
+}
+
+// `CheckpointConfig` specifies how the progress of a task is recorded.
+type CheckpointConfig struct {
+	// The `Key` column of the source rows to record as watermark. The
+	// source must return the rows ordered by this column.
+	Key string `mapstructure:"key"`
+	// The `Interval` of processed rows between checkpoints (default 1000),
+	// besides the checkpoints committed when a target flushes its rows.
+	Interval int64 `mapstructure:"interval"`
+}
+
+// `DeadLetterConfig` specifies where failed rows are sent and how many
+// of them are tolerated before the task is aborted.
+type DeadLetterConfig struct {
+	// Specifies the configuration of the dead-letter target endpoint.
+	Target TargetConfig `mapstructure:"target"`
+	// The maximum number of failed rows (0 means no limit).
+	MaxErrors int64 `mapstructure:"maxerrors"`
+	// The maximum ratio of failed to read rows (0 means no limit).
+	MaxRatio float64 `mapstructure:"maxratio"`
+	// The minimum number of read rows before the ratio is checked while
+	// running (default 1000). The ratio is always checked at the end.
+	MinRows int64 `mapstructure:"minrows"`
+}
+
+// The supported modes to handle in-flight rows on shutdown.
+const (
+	// `ShutdownDrain` lets in-flight rows reach the target endpoint.
+	ShutdownDrain = "drain"
+	// `ShutdownDiscard` drops in-flight rows as soon as possible.
+	ShutdownDiscard = "discard"
+)
+
+// `ShutdownConfig` specifies how a task is stopped when interrupted. In
+// any case the source endpoint stops reading new rows immediately.
+type ShutdownConfig struct {
+	// The `Mode` to handle in-flight rows: `drain` (default) or `discard`.
+	Mode string `mapstructure:"mode"`
+	// The `Timeout` for draining, after which pending rows are discarded.
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
 // `DatabaseConfig` specifies the configuration for a database connection.
 type DatabaseConfig struct {
 	// The database `driver` identifier.
@@ -71,6 +132,152 @@ type DatabaseConfig struct {
 	Password string `mapstructure:"password"`
 	// The connection `parameters`.
 	Parameters map[string]string `mapstructure:"parameters"`
+	// The `path` of the file of an embedded database, like SQLite.
+	Path string `mapstructure:"path"`
+	// The full data source name `dsn`, used instead of the settings above.
+	DSN string `mapstructure:"dsn"`
+	// The connection `Pool` settings.
+	Pool PoolConfig `mapstructure:"pool"`
+	// The `ConnectTimeout` for opening each connection.
+	ConnectTimeout time.Duration `mapstructure:"connecttimeout"`
+	// The `QueryTimeout` for executing each query or batch of statements.
+	QueryTimeout time.Duration `mapstructure:"querytimeout"`
+	// The session `Init` statements executed on every new connection.
+	Init []string `mapstructure:"init"`
+}
+
+// `PoolConfig` specifies the pool of connections to a database. Zero
+// values keep the defaults of the `database/sql` package.
+type PoolConfig struct {
+	// The `MaxOpen` number of open connections.
+	MaxOpen int `mapstructure:"maxopen"`
+	// The `MaxIdle` number of idle connections.
+	MaxIdle int `mapstructure:"maxidle"`
+	// The `MaxLifetime` of a connection before it's closed.
+	MaxLifetime time.Duration `mapstructure:"maxlifetime"`
+	// The `MaxIdleTime` of a connection before it's closed.
+	MaxIdleTime time.Duration `mapstructure:"maxidletime"`
+}
+
+// The `defaultSchemes` of the database URLs by driver.
+var defaultSchemes = map[string]string{
+	"oracle":    "oracle",
+	"sqlserver": "sqlserver",
+	"mssql":     "sqlserver",
+	"pgx":       "postgres",
+}
+
+// `GetDataSourceName` returns the configured data source name, or else
+// the URL to connect to the database, or the path of its file, with the
+// connection parameters. MySQL takes a data source name of its own format.
+func (db *DatabaseConfig) GetDataSourceName() string {
+	if db.DSN != "" {
+		return db.DSN
+	}
+	if db.Path != "" {
+		return db.getFileDataSourceName()
+	}
+	if db.Driver == "mysql" {
+		return db.getMySQLDataSourceName()
+	}
+
+	hostname := db.Host
+	if db.Port > 0 {
+		hostname = net.JoinHostPort(hostname, strconv.Itoa(db.Port))
+	}
+
+	scheme := db.Scheme
+	if scheme == "" {
+		scheme = defaultSchemes[db.Driver]
+	}
+
+	uri := &url.URL{
+		Scheme: scheme,
+		User:   url.UserPassword(db.Username, db.Password),
+		Host:   hostname,
+	}
+
+	if db.Service != "" {
+		uri.Path = url.PathEscape(db.Service)
+	}
+
+	if len(db.Parameters) > 0 {
+		query := uri.Query()
+		for key, value := range db.Parameters {
+			query.Add(strings.TrimSpace(key), strings.TrimSpace(value))
+		}
+		uri.RawQuery = query.Encode()
+	}
+
+	return uri.String()
+}
+
+// `getMySQLDataSourceName` returns the data source name of a MySQL
+// database, `user:password@tcp(host:port)/database?parameters`. Dates
+// and times are read as times unless the `parseTime` parameter says
+// otherwise.
+func (db *DatabaseConfig) getMySQLDataSourceName() string {
+	var dsn strings.Builder
+	if db.Username != "" || db.Password != "" {
+		dsn.WriteString(db.Username)
+		if db.Password != "" {
+			dsn.WriteString(":" + db.Password)
+		}
+		dsn.WriteString("@")
+	}
+
+	dsn.WriteString("tcp")
+	address := db.Host
+	if db.Port > 0 {
+		address = net.JoinHostPort(db.Host, strconv.Itoa(db.Port))
+	}
+	if address != "" {
+		dsn.WriteString("(" + address + ")")
+	}
+	dsn.WriteString("/" + url.PathEscape(db.Service))
+
+	query := url.Values{"parseTime": {"true"}}
+	for key, value := range db.Parameters {
+		key = strings.TrimSpace(key)
+		if name, ok := mysqlParameters[strings.ToLower(key)]; ok {
+			key = name
+		}
+		query.Set(key, strings.TrimSpace(value))
+	}
+	dsn.WriteString("?" + query.Encode())
+	return dsn.String()
+}
+
+// The `mysqlParameters` of the MySQL driver by their lowercase names,
+// since the configuration keys are read in lowercase. Other parameters
+// are system variables.
+var mysqlParameters = map[string]string{}
+
+func init() {
+	for _, name := range []string{
+		"allowAllFiles", "allowCleartextPasswords", "allowFallbackToPlaintext",
+		"allowNativePasswords", "allowOldPasswords", "charset", "checkConnLiveness",
+		"clientFoundRows", "collation", "columnsWithAlias", "connectionAttributes",
+		"interpolateParams", "loc", "maxAllowedPacket", "multiStatements",
+		"parseTime", "readTimeout", "rejectReadOnly", "serverPubKey", "timeout",
+		"tls", "writeTimeout",
+	} {
+		mysqlParameters[strings.ToLower(name)] = name
+	}
+}
+
+// `getFileDataSourceName` returns the path of the file of an embedded
+// database, with the connection parameters as its query.
+func (db *DatabaseConfig) getFileDataSourceName() string {
+	if len(db.Parameters) == 0 {
+		return db.Path
+	}
+
+	query := url.Values{}
+	for key, value := range db.Parameters {
+		query.Add(strings.TrimSpace(key), strings.TrimSpace(value))
+	}
+	return db.Path + "?" + query.Encode()
 }
 
 // `ServiceConfig` specifies the configuration for an HTTP endpoint.
@@ -83,8 +290,50 @@ type ServiceConfig struct {
 	Parameters map[string]string `mapstructure:"parameters"`
 	// The name of the authorization service to use.
 	WithAuthz string `mapstructure:"withauthz"`
+	// The `type` of authorization provider, when the service is used
+	// as an authorization service: `legacy` (default), `oauth2`,
+	// `bearer`, `apikey` or `basic`.
+	Type string `mapstructure:"type"`
 	// A flag to indicate if the certificate must be trusted.
 	TrustCert bool `mapstructure:"trustcert"`
+	// The `tls` settings of the connections to the endpoint.
+	TLS TLSConfig `mapstructure:"tls"`
+	// The `retry` policy of the requests to the endpoint.
+	Retry RetryConfig `mapstructure:"retry"`
+}
+
+// `TLSConfig` specifies the TLS settings of the connections to a service.
+// Relative file names are resolved from the configuration file folder.
+type TLSConfig struct {
+	// The PEM file with the CA certificates to verify the server, in
+	// addition to the system ones.
+	CAFile string `mapstructure:"cafile"`
+	// The PEM file with the client certificate for mutual TLS.
+	CertFile string `mapstructure:"certfile"`
+	// The PEM file with the client private key for mutual TLS.
+	KeyFile string `mapstructure:"keyfile"`
+	// The minimum TLS version: `1.0`, `1.1`, `1.2` (default) or `1.3`.
+	MinVersion string `mapstructure:"minversion"`
+	// The `servername` to verify, instead of the host of the URL.
+	ServerName string `mapstructure:"servername"`
+}
+
+// `RetryConfig` specifies the retry policy of the requests to a service.
+type RetryConfig struct {
+	// The maximum number of attempts of a request, 1 by default.
+	MaxAttempts int `mapstructure:"maxattempts"`
+	// The `backoff` before the first retry, 1s by default.
+	Backoff time.Duration `mapstructure:"backoff"`
+	// The maximum backoff between retries, 30s by default.
+	MaxBackoff time.Duration `mapstructure:"maxbackoff"`
+	// The `multiplier` of the backoff after each retry, 2 by default.
+	Multiplier float64 `mapstructure:"multiplier"`
+	// The `jitter` is the random fraction of the backoff added to or
+	// subtracted from it, 0.2 by default.
+	Jitter *float64 `mapstructure:"jitter"`
+	// The response `statuses` which are retried, by default 429 and
+	// every 5xx status.
+	Statuses []int `mapstructure:"statuses"`
 }
 
 // `SourceConfig` specifies the configuration of a source endpoint.
@@ -92,7 +341,7 @@ type SourceConfig struct {
 	// The type of source endpoint.
 	Type string `mapstructure:"type"`
 	// The arguments for the source driver.
-	Arguments map[string]any `mapstructure:"arguments"`
+	Arguments Arguments `mapstructure:"arguments"`
 }
 
 // `AdaptersConfig` specifies the configuration of an adapter middlepoint.
@@ -101,16 +350,36 @@ type AdapterConfig struct {
 	Type string `mapstructure:"type"`
 	// The execution `order` of the adapter in the chain.
 	Order int `mapstructure:"order"`
+	// The number of adapter instances running in `parallel` (default 1).
+	Parallelism int `mapstructure:"parallelism"`
 	// The arguments for the adapter driver.
-	Arguments map[string]any `mapstructure:"arguments"`
+	Arguments Arguments `mapstructure:"arguments"`
 }
 
 // `TargetConfig` specifies the configuration of the target endpoint.
 type TargetConfig struct {
 	// The type of source endpoint.
 	Type string `mapstructure:"type"`
+	// The number of target instances running in `parallel` (default 1).
+	Parallelism int `mapstructure:"parallelism"`
 	// The name or pattern for the output to target.
-	Arguments map[string]any `mapstructure:"arguments"`
+	Arguments Arguments `mapstructure:"arguments"`
+}
+
+// `GetParallelism` returns the number of instances of the adapter.
+func (adapter *AdapterConfig) GetParallelism() int {
+	if adapter.Parallelism < 1 {
+		return 1
+	}
+	return adapter.Parallelism
+}
+
+// `GetParallelism` returns the number of instances of the target.
+func (target *TargetConfig) GetParallelism() int {
+	if target.Parallelism < 1 {
+		return 1
+	}
+	return target.Parallelism
 }
 
 // `cfg` is the global configuration instance.
@@ -121,6 +390,16 @@ func GetConfig() *Config {
 	return &cfg
 }
 
+// `GetTaskConfig` method implementation.
+func (cfg *Config) GetTaskConfig(name string) (*TaskConfig, error) {
+	task, ok := cfg.Tasks[name]
+	if !ok {
+		return nil, errors.New("Missing configuration for task: " + name)
+	}
+
+	return &task, nil
+}
+
 // `GetDatabaseConfig` method implementation.
 func (cfg *Config) GetDatabaseConfig(name string) (*DatabaseConfig, error) {
 	database, ok := cfg.Databases[name]
@@ -199,11 +478,32 @@ func (cfg *Config) GetConfigFilename() string {
 	return cfg.configFilename
 }
 
+// The default directory for the state files, relative to the
+// configuration file.
+const defaultStateDir = ".datacat"
+
+// `GetStateFilename` method implementation.
+func (cfg *Config) GetStateFilename(name string) string {
+	stateDir := cfg.StateDir
+	if stateDir == "" {
+		stateDir = defaultStateDir
+	}
+
+	basePath := filepath.Dir(cfg.configFilename)
+	return filepath.Join(ResolveFilename(basePath, stateDir), name+".state.json")
+}
+
 // The default environment variable prefix.
 const defaultEnvPrefix = "SQL2API"
 
+// `LookupEnvParameter` returns the value of the query parameter with the
+// given name from the environment (e.g. `SQL2API_PARAM_FROM_DATE`).
+func LookupEnvParameter(name string) (string, bool) {
+	return os.LookupEnv(defaultEnvPrefix + "_PARAM_" + strings.ToUpper(name))
+}
+
 // `LoadConfig` initializes the global configuration instance.
-func LoadConfig(cfgfile string) {
+func LoadConfig(cfgfile string) error {
 	env := os.Getenv(defaultEnvPrefix + "_ENV")
 	if env == "" {
 		env = "development"
@@ -221,7 +521,7 @@ func LoadConfig(cfgfile string) {
 	viper.SetConfigFile(cfgfile)
 
 	if err := viper.ReadInConfig(); err != nil {
-		log.Fatalf("Error reading config file: %s", err)
+		return fmt.Errorf("Error reading config file: %w", err)
 	}
 
 	viper.AutomaticEnv()
@@ -229,8 +529,9 @@ func LoadConfig(cfgfile string) {
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 
 	if err := viper.Unmarshal(&cfg); err != nil {
-		log.Fatalf("Error unmarshalling config file: %s", err)
+		return fmt.Errorf("Error unmarshalling config file: %w", err)
 	}
 
 	cfg.configFilename = viper.ConfigFileUsed()
+	return nil
 }
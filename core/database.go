@@ -0,0 +1,181 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package core
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func init() {
+	// The `go-ora` driver takes named placeholders, unknown to `sqlx`.
+	sqlx.BindDriver("oracle", sqlx.NAMED)
+}
+
+// `OpenDatabase` opens the pool of connections to the given database,
+// with its pool settings, and checks that it can be reached. Every new
+// connection runs the session init statements of the database.
+func OpenDatabase(ctx context.Context, config *DatabaseConfig) (*sqlx.DB, error) {
+	connector, err := newConnector(config)
+	if err != nil {
+		return nil, err
+	}
+
+	db := sqlx.NewDb(sql.OpenDB(connector), config.Driver)
+	if config.Pool.MaxOpen > 0 {
+		db.SetMaxOpenConns(config.Pool.MaxOpen)
+	}
+	if config.Pool.MaxIdle > 0 {
+		db.SetMaxIdleConns(config.Pool.MaxIdle)
+	}
+	if config.Pool.MaxLifetime > 0 {
+		db.SetConnMaxLifetime(config.Pool.MaxLifetime)
+	}
+	if config.Pool.MaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(config.Pool.MaxIdleTime)
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// `newConnector` returns the connector of the database driver, wrapped
+// to apply the connect timeout and the session init statements.
+func newConnector(config *DatabaseConfig) (driver.Connector, error) {
+	dataSourceName := config.GetDataSourceName()
+
+	// The registered drivers are only reachable through a pool.
+	db, err := sql.Open(config.Driver, dataSourceName)
+	if err != nil {
+		return nil, err
+	}
+	drv := db.Driver()
+	db.Close()
+
+	var connector driver.Connector
+	if drvCtx, ok := drv.(driver.DriverContext); ok {
+		if connector, err = drvCtx.OpenConnector(dataSourceName); err != nil {
+			return nil, err
+		}
+	} else {
+		connector = &dsnConnector{driver: drv, dataSourceName: dataSourceName}
+	}
+
+	return &sessionConnector{
+		Connector:  connector,
+		timeout:    config.ConnectTimeout,
+		statements: config.Init,
+	}, nil
+}
+
+// A `dsnConnector` opens the connections of a driver without its own
+// connector.
+type dsnConnector struct {
+	driver         driver.Driver
+	dataSourceName string
+}
+
+// `Connect` implements the `driver.Connector` interface.
+func (c *dsnConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dataSourceName)
+}
+
+// `Driver` implements the `driver.Connector` interface.
+func (c *dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// A `sessionConnector` opens the connections of a database with a
+// timeout, and prepares their sessions with the init statements.
+type sessionConnector struct {
+	driver.Connector
+	timeout    time.Duration
+	statements []string
+}
+
+// `Connect` implements the `driver.Connector` interface.
+func (c *sessionConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, statement := range c.statements {
+		if err := execSession(ctx, conn, statement); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("Error executing session statement '%s': %w", statement, err)
+		}
+	}
+	return conn, nil
+}
+
+// `execSession` executes the given statement, without arguments, on a
+// new connection.
+func execSession(ctx context.Context, conn driver.Conn, statement string) error {
+	if execer, ok := conn.(driver.ExecerContext); ok {
+		_, err := execer.ExecContext(ctx, statement, nil)
+		if !errors.Is(err, driver.ErrSkip) {
+			return err
+		}
+	}
+
+	var stmt driver.Stmt
+	var err error
+	if preparer, ok := conn.(driver.ConnPrepareContext); ok {
+		stmt, err = preparer.PrepareContext(ctx, statement)
+	} else {
+		stmt, err = conn.Prepare(statement)
+	}
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	if execer, ok := stmt.(driver.StmtExecContext); ok {
+		_, err = execer.ExecContext(ctx, nil)
+	} else {
+		_, err = stmt.Exec(nil)
+	}
+	return err
+}
+
+// `WithQueryTimeout` returns a context which is canceled after the query
+// timeout of the database, if any.
+func (db *DatabaseConfig) WithQueryTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if db.QueryTimeout > 0 {
+		return context.WithTimeout(ctx, db.QueryTimeout)
+	}
+	return context.WithCancel(ctx)
+}
@@ -0,0 +1,189 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package core
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestOpenDatabaseAppliesPoolSettings(t *testing.T) {
+	config := &DatabaseConfig{
+		Driver: "sqlite3",
+		Path:   filepath.Join(t.TempDir(), "pool.db"),
+		Pool:   PoolConfig{MaxOpen: 3, MaxIdle: 1},
+	}
+	db, err := OpenDatabase(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if got := db.Stats().MaxOpenConnections; got != 3 {
+		t.Errorf("MaxOpenConnections = %d, want 3", got)
+	}
+
+	// The idle connections above the limit are closed when released.
+	ctx := context.Background()
+	first, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.Close()
+	second.Close()
+	if got := db.Stats().Idle; got != 1 {
+		t.Errorf("Idle = %d, want 1", got)
+	}
+}
+
+func TestOpenDatabaseRunsInitOnEveryConnection(t *testing.T) {
+	config := &DatabaseConfig{
+		Driver: "sqlite3",
+		Path:   filepath.Join(t.TempDir(), "init.db"),
+		Init: []string{
+			"CREATE TEMP TABLE session (name TEXT)",
+			"INSERT INTO session VALUES ('ready')",
+		},
+	}
+	db, err := OpenDatabase(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Temporary tables belong to a connection, so each one must have
+	// run the statements of its own session.
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		var name string
+		if err := conn.QueryRowContext(ctx, "SELECT name FROM session").Scan(&name); err != nil {
+			t.Fatalf("connection %d: %v", i, err)
+		}
+		if name != "ready" {
+			t.Errorf("connection %d: name = %q, want %q", i, name, "ready")
+		}
+	}
+	if got := db.Stats().OpenConnections; got != 3 {
+		t.Errorf("OpenConnections = %d, want 3", got)
+	}
+}
+
+func TestOpenDatabaseFailsOnInitError(t *testing.T) {
+	config := &DatabaseConfig{
+		Driver: "sqlite3",
+		Path:   filepath.Join(t.TempDir(), "fail.db"),
+		Init:   []string{"SELECT * FROM missing"},
+	}
+	db, err := OpenDatabase(context.Background(), config)
+	if err == nil {
+		db.Close()
+		t.Fatal("expected an error from the init statement")
+	}
+	if !strings.Contains(err.Error(), "SELECT * FROM missing") {
+		t.Errorf("error %q doesn't name the init statement", err)
+	}
+}
+
+func TestOpenDatabaseTakesDSN(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dsn.db")
+	config := &DatabaseConfig{
+		Driver: "sqlite3",
+		Path:   filepath.Join(t.TempDir(), "ignored.db"),
+		DSN:    path + "?_busy_timeout=5000",
+	}
+	db, err := OpenDatabase(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var file string
+	if err := db.QueryRow("SELECT file FROM pragma_database_list WHERE name = 'main'").Scan(&file); err != nil {
+		t.Fatal(err)
+	}
+	if file != path {
+		t.Errorf("database file = %q, want %q", file, path)
+	}
+	var timeout int
+	if err := db.QueryRow("PRAGMA busy_timeout").Scan(&timeout); err != nil {
+		t.Fatal(err)
+	}
+	if timeout != 5000 {
+		t.Errorf("busy_timeout = %d, want 5000", timeout)
+	}
+}
+
+// A `blockingConnector` never opens a connection until it's canceled.
+type blockingConnector struct {
+	driver.Connector
+}
+
+// `Connect` implements the `driver.Connector` interface.
+func (c *blockingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestSessionConnectorTimesOut(t *testing.T) {
+	connector := &sessionConnector{Connector: &blockingConnector{}, timeout: 50 * time.Millisecond}
+
+	start := time.Now()
+	_, err := connector.Connect(context.Background())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Connect() = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Connect() took %v", elapsed)
+	}
+}
+
+func TestWithQueryTimeout(t *testing.T) {
+	config := &DatabaseConfig{QueryTimeout: time.Minute}
+	ctx, cancel := config.WithQueryTimeout(context.Background())
+	defer cancel()
+	if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > time.Minute {
+		t.Errorf("Deadline() = %v, %v, want within a minute", deadline, ok)
+	}
+
+	config.QueryTimeout = 0
+	ctx, cancel = config.WithQueryTimeout(context.Background())
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("Deadline() is set without a query timeout")
+	}
+}
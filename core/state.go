@@ -0,0 +1,207 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// `TaskState` is the persistent state of a task between executions.
+type TaskState struct {
+	// The last `Checkpoint` committed by the task, if any.
+	Checkpoint *Checkpoint `json:"checkpoint,omitempty"`
+	// The `Watermark` of the last successful execution, if any.
+	Watermark *Watermark `json:"watermark,omitempty"`
+}
+
+// A `Watermark` records the highest value of a column read by a task,
+// so that the next execution only reads the rows beyond it.
+type Watermark struct {
+	// The `Column` name of the watermark.
+	Column string `json:"column"`
+	// The highest `Value` of the column.
+	Value any `json:"value"`
+	// The time when the watermark was `Updated`.
+	Updated time.Time `json:"updated"`
+}
+
+// A `Checkpoint` records the progress of a task.
+type Checkpoint struct {
+	// The `Offset` is the number of source rows processed, counted from
+	// the first row, without gaps.
+	Offset int64 `json:"offset"`
+	// The `Key` value of the last processed row, if the checkpoint is
+	// configured with a key column.
+	Key any `json:"key,omitempty"`
+	// The number of rows `Acknowledged` by the target endpoint.
+	Acknowledged int64 `json:"acknowledged"`
+	// The sizes of the `Outputs` files of the targets, by file name,
+	// when the rows before the offset were flushed to them.
+	Outputs map[string]int64 `json:"outputs,omitempty"`
+	// A flag to indicate that the task run to its end.
+	Completed bool `json:"completed"`
+	// The time when the checkpoint was `Updated`.
+	Updated time.Time `json:"updated"`
+}
+
+// A `StateStore` saves the state of a task in a local JSON file.
+type StateStore struct {
+	// The `fileName` of the state file.
+	fileName string
+	// The `mutex` serializes the updates of the state file.
+	mutex sync.Mutex
+}
+
+// `stateStores` holds a single store per state file, so that updates
+// from different parts of a task are serialized.
+var stateStores sync.Map
+
+// `OpenStateStore` returns the state store of the task with given name.
+func OpenStateStore(cfg Configurator, taskName string) *StateStore {
+	fileName := cfg.GetStateFilename(taskName)
+	store, _ := stateStores.LoadOrStore(fileName, &StateStore{fileName: fileName})
+	return store.(*StateStore)
+}
+
+// `Load` reads the state from the state file. A missing file is an
+// empty state.
+func (st *StateStore) Load() (*TaskState, error) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	return st.load()
+}
+
+// `Update` reads the state, applies the given function to it and
+// writes it back to the state file atomically.
+func (st *StateStore) Update(apply func(state *TaskState)) error {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	state, err := st.load()
+	if err != nil {
+		return err
+	}
+
+	apply(state)
+	return st.save(state)
+}
+
+// `load` reads the state file without locking.
+func (st *StateStore) load() (*TaskState, error) {
+	state := &TaskState{}
+
+	data, err := os.ReadFile(st.fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error reading state file %s: %w", st.fileName, err)
+	}
+
+	// Numbers are kept as `json.Number`, so that key values of large
+	// integer columns keep their precision.
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(state); err != nil {
+		return nil, fmt.Errorf("Error parsing state file %s: %w", st.fileName, err)
+	}
+	return state, nil
+}
+
+// `save` writes the state file through a temporary file, so that a
+// crash never leaves a truncated state behind.
+func (st *StateStore) save(state *TaskState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Error marshalling state: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(st.fileName), 0o755); err != nil {
+		return fmt.Errorf("Error creating state directory: %w", err)
+	}
+
+	tmpName := st.fileName + ".tmp"
+	if err := os.WriteFile(tmpName, data, 0o644); err != nil {
+		return fmt.Errorf("Error writing state file %s: %w", tmpName, err)
+	}
+
+	if err := os.Rename(tmpName, st.fileName); err != nil {
+		return fmt.Errorf("Error replacing state file %s: %w", st.fileName, err)
+	}
+	return nil
+}
+
+// `CompareValues` returns a negative number, zero or a positive number
+// when `a` is less than, equal to or greater than `b`. Numbers and times
+// are compared by value, any other value by its textual representation.
+// Numeric strings are compared as numbers.
+func CompareValues(a, b any) int {
+	if x, ok := ToFloat(a); ok {
+		if y, ok := ToFloat(b); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	if x, ok := a.(time.Time); ok {
+		if y, ok := b.(time.Time); ok {
+			return x.Compare(y)
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// `ToFloat` converts a numeric value to a float, if possible.
+func ToFloat(value any) (float64, bool) {
+	switch value := value.(type) {
+	case int64:
+		return float64(value), true
+	case int32:
+		return float64(value), true
+	case int:
+		return float64(value), true
+	case float64:
+		return value, true
+	case float32:
+		return float64(value), true
+	case json.Number:
+		number, err := value.Float64()
+		return number, err == nil
+	case string:
+		// Decimal columns are usually scanned as text.
+		number, err := strconv.ParseFloat(value, 64)
+		return number, err == nil
+	}
+	return 0, false
+}
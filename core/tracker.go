@@ -0,0 +1,349 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// `ErrSetup` is wrapped by the errors raised while a task is being built,
+// before any row has been processed.
+var ErrSetup = errors.New("Task setup failed")
+
+// `ErrInterrupted` is reported when a task is stopped by a signal or by
+// the cancellation of its parent context.
+var ErrInterrupted = errors.New("Task interrupted")
+
+// `ErrBudgetExceeded` is reported when the failed rows of a task exceed
+// the error budget of its dead-letter configuration.
+var ErrBudgetExceeded = errors.New("Error budget exceeded")
+
+// The fields added to the rows sent to the dead-letter target.
+const (
+	// `DeadLetterError` is the field with the error message.
+	DeadLetterError = "_error"
+	// `DeadLetterStage` is the field with the name of the failed stage.
+	DeadLetterStage = "_stage"
+	// `DeadLetterTimestamp` is the field with the time of the failure.
+	DeadLetterTimestamp = "_timestamp"
+)
+
+// The default number of rows read before the error ratio is checked.
+const defaultMinRows = 1000
+
+// A `StageError` is an error reported by one of the stages of a task.
+type StageError struct {
+	// The `Stage` name which reported the error.
+	Stage string
+	// The underlying `Err` error.
+	Err error
+}
+
+// `Error` returns the error message prefixed by the stage name.
+func (e *StageError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Stage, e.Err)
+}
+
+// `Unwrap` returns the underlying error.
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+// A `Result` is the summary of a task execution.
+type Result struct {
+	// The `Task` name.
+	Task string
+	// The number of rows `Read` by the source endpoint.
+	Read int64
+	// The number of rows `Written` by the target endpoint(s).
+	Written int64
+	// The number of rows `Failed` in any stage.
+	Failed int64
+	// The number of failed rows written to the `DeadLettered` target.
+	DeadLettered int64
+	// The first error reported by any stage, if any.
+	Err error
+	// The `Elapsed` time of the execution.
+	Elapsed time.Duration
+}
+
+// `Ok` returns true if the task finished without errors.
+func (res *Result) Ok() bool {
+	return res.Err == nil
+}
+
+// `String` returns a one-line summary of the result.
+func (res *Result) String() string {
+	summary := fmt.Sprintf("task '%s': %d read, %d written, %d failed, %d dead-lettered (%s elapsed)",
+		res.Task, res.Read, res.Written, res.Failed, res.DeadLettered, res.Elapsed)
+	if res.Err != nil {
+		summary += fmt.Sprintf(": %s", res.Err)
+	}
+	return summary
+}
+
+// A `Tracker` collects the counters and the errors reported by the
+// stages of a running task. It's safe for concurrent use.
+type Tracker struct {
+	// The `task` name.
+	task string
+	// The `start` time of the task.
+	start time.Time
+	// The `read`, `written` and `failed` row counters.
+	read, written, failed atomic.Int64
+	// The `mutex` guards the first error.
+	mutex sync.Mutex
+	// The first `err` reported by a stage.
+	err error
+	// The `cancel` function stops the whole pipeline.
+	cancel context.CancelFunc
+	// The `interrupted` flag is set when the task is interrupted.
+	interrupted atomic.Bool
+	// The `deadLetter` channel receives the failed rows, if any.
+	deadLetter chan<- RowMap
+	// The `deadLetterCtx` is cancelled when the dead-letter target stops.
+	deadLetterCtx context.Context
+	// The `budget` of failed rows tolerated by the dead-letter output.
+	budget DeadLetterConfig
+	// The number of rows written to the dead-letter target.
+	deadLettered atomic.Int64
+	// The `checkpointer` which records the progress of the task, if any.
+	checkpointer *Checkpointer
+	// The `resuming` flag is set when the task resumes a previous run.
+	resuming bool
+	// The `shared` values of the stages of the task execution, by key.
+	shared sync.Map
+}
+
+// `NewTracker` creates a new tracker for the task with given name.
+//
+// The `cancel` function is called to stop the pipeline of the task
+// when a fatal error is reported.
+func NewTracker(taskName string, cancel context.CancelFunc) *Tracker {
+	return &Tracker{
+		task:   taskName,
+		start:  time.Now(),
+		cancel: cancel,
+	}
+}
+
+// `SetCheckpointer` records the progress of the task with the given
+// checkpointer. The `resuming` flag indicates that the task continues
+// a previous execution. It must be called before the task starts.
+func (trk *Tracker) SetCheckpointer(cp *Checkpointer, resuming bool) {
+	trk.checkpointer = cp
+	trk.resuming = resuming
+}
+
+// `Shared` returns the value shared by the stages of the running task
+// under the given key, created by the first caller with `create`. It
+// lets the instances of an endpoint coordinate, like partitioned sources,
+// and it's discarded with the tracker, so a new execution of the task
+// starts afresh.
+func (trk *Tracker) Shared(key string, create func() any) any {
+	if value, ok := trk.shared.Load(key); ok {
+		return value
+	}
+	value, _ := trk.shared.LoadOrStore(key, create())
+	return value
+}
+
+// `Resuming` returns true if the task continues a previous execution,
+// so that targets can append to their previous output.
+func (trk *Tracker) Resuming() bool {
+	return trk.resuming
+}
+
+// `Read` counts a row read by the source endpoint. It must be called
+// before the row is sent to the next stage. It returns false if the row
+// must be skipped because it was processed by a previous execution.
+func (trk *Tracker) Read(row RowMap) bool {
+	if trk.checkpointer != nil && !trk.checkpointer.read(row) {
+		return false
+	}
+
+	trk.read.Add(1)
+	return true
+}
+
+// `Flushed` counts the rows written by a target endpoint in a batch,
+// once the target has flushed them, and commits a checkpoint, so that a
+// resumed execution doesn't send them again. A file target gives the
+// name and the size of its `output` file after the flush, which is cut
+// back to that size on resume; other targets give an empty name.
+func (trk *Tracker) Flushed(rows []RowMap, output string, size int64) {
+	trk.written.Add(int64(len(rows)))
+	if trk.checkpointer == nil {
+		return
+	}
+
+	if err := trk.checkpointer.flushed(rows, output, size); err != nil {
+		trk.Abort("checkpoint", err)
+	}
+}
+
+// `OutputSize` returns the size of the given output file at the
+// checkpoint resumed by the task, if it's known.
+func (trk *Tracker) OutputSize(output string) (int64, bool) {
+	if !trk.resuming || trk.checkpointer == nil {
+		return 0, false
+	}
+	return trk.checkpointer.outputSize(output)
+}
+
+// `Dropped` counts a row deliberately dropped by an adapter, like by a
+// filter, which is processed without reaching the target.
+func (trk *Tracker) Dropped(row RowMap) {
+	trk.settle(row, false)
+}
+
+// `settle` reports to the checkpointer a row which has been processed.
+func (trk *Tracker) settle(row RowMap, acknowledged bool) {
+	if trk.checkpointer == nil {
+		return
+	}
+
+	if err := trk.checkpointer.settle(row, acknowledged); err != nil {
+		trk.Abort("checkpoint", err)
+	}
+}
+
+// `SetDeadLetter` routes the failed rows to the `out` channel, which is
+// consumed by a dead-letter target, instead of aborting the task. The
+// `ctx` is cancelled if that target stops. It must be called before
+// the task starts.
+func (trk *Tracker) SetDeadLetter(ctx context.Context, out chan<- RowMap, budget DeadLetterConfig) {
+	if budget.MinRows <= 0 {
+		budget.MinRows = defaultMinRows
+	}
+
+	trk.deadLetter = out
+	trk.deadLetterCtx = ctx
+	trk.budget = budget
+}
+
+// `DeadLettered` counts a row written by the dead-letter target.
+func (trk *Tracker) DeadLettered(count int64) {
+	trk.deadLettered.Add(count)
+}
+
+// `Fail` reports a `row` that the given `stage` couldn't process. The
+// row is sent to the dead-letter output, if any, and the task goes on
+// while the error budget allows it. Otherwise, the task is aborted.
+func (trk *Tracker) Fail(stage string, row RowMap, err error) {
+	failed := trk.failed.Add(1)
+	if trk.deadLetter == nil {
+		trk.Abort(stage, err)
+		return
+	}
+
+	record := make(RowMap, len(row)+3)
+	for key, value := range row.Data() {
+		record[key] = value
+	}
+	record[DeadLetterError] = err.Error()
+	record[DeadLetterStage] = stage
+	record[DeadLetterTimestamp] = time.Now().Format(time.RFC3339Nano)
+
+	if !Send(trk.deadLetterCtx, trk.deadLetter, record) {
+		trk.Abort(stage, fmt.Errorf("Dead-letter target is stopped: %w", err))
+		return
+	}
+	trk.settle(row, false)
+
+	if trk.budget.MaxErrors > 0 && failed > trk.budget.MaxErrors {
+		trk.Abort(stage, fmt.Errorf("%w (%d failed rows), last error: %w", ErrBudgetExceeded, failed, err))
+		return
+	}
+
+	if read := trk.read.Load(); read >= trk.budget.MinRows && trk.ratioExceeded(failed, read) {
+		trk.Abort(stage, fmt.Errorf("%w (%d failed of %d read rows), last error: %w", ErrBudgetExceeded, failed, read, err))
+	}
+}
+
+// `CheckBudget` verifies the ratio of failed rows at the end of a task.
+func (trk *Tracker) CheckBudget() {
+	if trk.deadLetter == nil {
+		return
+	}
+
+	failed, read := trk.failed.Load(), trk.read.Load()
+	if trk.ratioExceeded(failed, read) {
+		trk.Abort("task", fmt.Errorf("%w (%d failed of %d read rows)", ErrBudgetExceeded, failed, read))
+	}
+}
+
+// `ratioExceeded` returns true if the ratio of failed rows is over budget.
+func (trk *Tracker) ratioExceeded(failed int64, read int64) bool {
+	if trk.budget.MaxRatio <= 0 || read == 0 {
+		return false
+	}
+	return float64(failed)/float64(read) > trk.budget.MaxRatio
+}
+
+// `Abort` reports a fatal error in the given `stage` and stops the
+// task. Only the first reported error is kept.
+func (trk *Tracker) Abort(stage string, err error) {
+	trk.mutex.Lock()
+	if trk.err == nil {
+		trk.err = &StageError{Stage: stage, Err: err}
+	}
+	trk.mutex.Unlock()
+
+	if trk.cancel != nil {
+		trk.cancel()
+	}
+}
+
+// `Interrupt` records that the task has been interrupted. Unlike `Abort`
+// it doesn't stop the pipeline, so that in-flight rows may be drained.
+func (trk *Tracker) Interrupt() {
+	trk.interrupted.Store(true)
+}
+
+// `Err` returns the first error reported by a stage, if any. An
+// interrupted task without other errors reports `ErrInterrupted`.
+func (trk *Tracker) Err() error {
+	trk.mutex.Lock()
+	defer trk.mutex.Unlock()
+	if trk.err == nil && trk.interrupted.Load() {
+		return ErrInterrupted
+	}
+	return trk.err
+}
+
+// `Result` returns the summary of the task execution so far.
+func (trk *Tracker) Result() *Result {
+	return &Result{
+		Task:         trk.task,
+		Read:         trk.read.Load(),
+		Written:      trk.written.Load(),
+		Failed:       trk.failed.Load(),
+		DeadLettered: trk.deadLettered.Load(),
+		Err:          trk.Err(),
+		Elapsed:      time.Since(trk.start),
+	}
+}
@@ -20,11 +20,20 @@
 
 package core
 
-import "sync"
+import (
+	"context"
+	"sync"
+)
 
 // `Configurator` is an interface for the objects that provide the
 // configuration for each element of the application.
 type Configurator interface {
+	// `GetTaskConfig` returns the configuration of the task with the
+	// given name in the global configuration instance.
+	//
+	// The `name` is the key of the configuration to be returned.
+	GetTaskConfig(name string) (*TaskConfig, error)
+
 	// `GetDatabaseConfig` returns the configuration of the database
 	// with the given name in the global configuration instance.
 	//
@@ -63,28 +72,97 @@ type Configurator interface {
 
 	// `GetConfigFilename` returns the name of the configuration file.
 	GetConfigFilename() string
+
+	// `GetStateFilename` returns the name of the file where the state
+	// of the given task is stored between executions.
+	//
+	// The `name` is the task key of the state file to be returned.
+	GetStateFilename(name string) string
 }
 
 // A `RowMap` represents a row of data moving through a task.
 type RowMap map[string]any
 
+// `Data` returns the row without its reserved `SequenceField`, to be
+// written by the targets. The row itself is returned if it has none.
+func (row RowMap) Data() RowMap {
+	if _, ok := row[SequenceField]; !ok {
+		return row
+	}
+
+	data := make(RowMap, len(row)-1)
+	for key, value := range row {
+		if key != SequenceField {
+			data[key] = value
+		}
+	}
+	return data
+}
+
 // A `Source` endpoint is a subtask which retrieves data from a specialized
 // type of data source.
 type Source interface {
-	// Run creates a `goroutine` to execute the retrieval procedure.
-	Run(*sync.WaitGroup) <-chan RowMap
+	// Run creates a `goroutine` to execute the retrieval procedure. Errors
+	// are reported to the given `Tracker`. The source stops reading and
+	// closes its output channel when the context is cancelled.
+	Run(context.Context, *sync.WaitGroup, *Tracker) <-chan RowMap
 }
 
 // An `Adapter` middlepoint is a subtask which applies a transformation
 // to a each row of data retrieved from the previous stage in a task.
 type Adapter interface {
-	// Run creates a `goroutine` to execute the adapter procedure.
-	Run(*sync.WaitGroup, <-chan RowMap) <-chan RowMap
+	// Run creates a `goroutine` to execute the adapter procedure. Errors
+	// are reported to the given `Tracker`. The adapter discards its
+	// pending rows when the context is cancelled.
+	Run(context.Context, *sync.WaitGroup, *Tracker, <-chan RowMap) <-chan RowMap
 }
 
 // A `Target` endpoint is a subtask which sends data to a specialized
 // type of data target.
 type Target interface {
-	// Run creates a `goroutine` to execute the sending procedure.
-	Run(*sync.WaitGroup, <-chan RowMap)
+	// Run creates a `goroutine` to execute the sending procedure. Errors
+	// are reported to the given `Tracker`. The target discards its
+	// pending rows, flushes and closes its output when the context is
+	// cancelled.
+	Run(context.Context, *sync.WaitGroup, *Tracker, <-chan RowMap)
+}
+
+// A `Resumable` source can restart its reading after the row with a
+// given key value, instead of skipping the rows already processed.
+type Resumable interface {
+	// ResumeAfter makes the source return its rows ordered by the `key`
+	// column and, unless `value` is nil, restricted to the rows whose
+	// key is greater than `value`.
+	ResumeAfter(key string, value any) error
+}
+
+// A `Parameterized` source takes named parameters given at run time.
+type Parameterized interface {
+	// SetParameters resolves the values of the named parameters, taking
+	// the given overrides before the environment and the configuration
+	// defaults. It fails if any parameter is unknown or has no value.
+	SetParameters(overrides map[string]string) error
+}
+
+// A `Watermarker` source records the highest value of a column among
+// the rows it has read, to be stored as the watermark of the task.
+type Watermarker interface {
+	// Watermark returns the watermark column and its highest value read,
+	// or a nil value if no row has been read.
+	Watermark() (column string, value any)
+}
+
+// `Send` sends the `row` to the `out` channel. It returns false, without
+// sending, if the context is cancelled before the row is accepted.
+func Send(ctx context.Context, out chan<- RowMap, row RowMap) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	select {
+	case out <- row:
+		return true
+	case <-ctx.Done():
+		return false
+	}
 }
@@ -21,10 +21,12 @@
 package main
 
 import (
-	"github.com/tnotstar/sqltoapi/cmd"
+	"os"
+
+	"github.com/tnotstar/datacat/cmd"
 )
 
 // `main` is the entry point of the application.
 func main() {
-	cmd.ExecuteRoot()
+	os.Exit(cmd.ExecuteRoot())
 }
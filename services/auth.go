@@ -0,0 +1,367 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tnotstar/datacat/core"
+)
+
+// The types of authorization providers.
+const (
+	// `AuthLegacy` requests a token with a GET request, passing the
+	// `client` and `credential` parameters in the query, and reads it
+	// from the `token` field of the response.
+	AuthLegacy = "legacy"
+	// `AuthOAuth2` requests a token with the OAuth2 client credentials
+	// grant, and refreshes it before it expires.
+	AuthOAuth2 = "oauth2"
+	// `AuthBearer` sends a static bearer token.
+	AuthBearer = "bearer"
+	// `AuthAPIKey` sends a static key in a request header.
+	AuthAPIKey = "apikey"
+	// `AuthBasic` sends a username and password with HTTP basic
+	// authentication.
+	AuthBasic = "basic"
+)
+
+// `ErrAuthorization` is returned when a request can't be authorized.
+var ErrAuthorization = errors.New("Authorization failed")
+
+// `refreshMargin` is the time before its expiration when a token is
+// refreshed, at most a tenth of its lifetime.
+const refreshMargin = 30 * time.Second
+
+// `defaultTokenLifetime` is the time after which a token without an
+// expiration time is requested again.
+const defaultTokenLifetime = time.Hour
+
+// An `Authorizer` adds the credentials of a service to its requests.
+type Authorizer interface {
+	// Authorize sets the credentials of the given request, requesting
+	// a new token when needed. Errors wrap `ErrAuthorization`.
+	Authorize(ctx context.Context, req *http.Request) error
+	// Invalidate discards the credentials of the given request, which
+	// have been rejected by the service. It returns true if the next
+	// requests get new credentials.
+	Invalidate(req *http.Request) bool
+}
+
+// `NewAuthorizer` returns a new authorizer of the authorization service
+// with given name, or nil if the name is empty.
+//
+// The `cfg` is the global configuration object.
+// The `name` is the name of the authorization service.
+func NewAuthorizer(cfg core.Configurator, name string) (Authorizer, error) {
+	if name == "" {
+		return nil, nil
+	}
+
+	config, err := cfg.GetServiceConfig(name)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting configuration for authz service %s: %w", name, err)
+	}
+
+	return newAuthorizer(cfg, name, config)
+}
+
+// `newAuthorizer` creates the authorizer for the given service.
+func newAuthorizer(cfg core.Configurator, name string, config *core.ServiceConfig) (Authorizer, error) {
+	param := func(key string) string {
+		return config.Parameters[key]
+	}
+
+	lifetime := defaultTokenLifetime
+	if value := param("token_lifetime"); value != "" {
+		var err error
+		if lifetime, err = time.ParseDuration(value); err != nil || lifetime <= 0 {
+			return nil, fmt.Errorf("Invalid parameter 'token_lifetime' for authz service %s: %s", name, value)
+		}
+	}
+
+	switch config.Type {
+	case "", AuthLegacy:
+		client, err := NewClient(cfg, config)
+		if err != nil {
+			return nil, err
+		}
+		return &tokenAuthorizer{name: name, fetch: legacyToken(client, config), lifetime: lifetime}, nil
+	case AuthOAuth2:
+		if param("client_id") == "" {
+			return nil, fmt.Errorf("Missing parameter 'client_id' for authz service %s", name)
+		}
+		client, err := NewClient(cfg, config)
+		if err != nil {
+			return nil, err
+		}
+		return &tokenAuthorizer{name: name, fetch: oauth2Token(client, config), lifetime: lifetime}, nil
+	case AuthBearer:
+		if param("token") == "" {
+			return nil, fmt.Errorf("Missing parameter 'token' for authz service %s", name)
+		}
+		return &headerAuthorizer{header: "Authorization", value: "Bearer " + param("token")}, nil
+	case AuthAPIKey:
+		if param("key") == "" {
+			return nil, fmt.Errorf("Missing parameter 'key' for authz service %s", name)
+		}
+		header := param("header")
+		if header == "" {
+			header = "X-API-Key"
+		}
+		return &headerAuthorizer{header: header, value: param("key")}, nil
+	case AuthBasic:
+		return &basicAuthorizer{username: param("username"), password: param("password")}, nil
+	}
+
+	return nil, fmt.Errorf("Invalid type of authz service %s: %s", name, config.Type)
+}
+
+// A `headerAuthorizer` sets a static header.
+type headerAuthorizer struct {
+	header string
+	value  string
+}
+
+// `Authorize` implements the `Authorizer` interface.
+func (auth *headerAuthorizer) Authorize(ctx context.Context, req *http.Request) error {
+	req.Header.Set(auth.header, auth.value)
+	return nil
+}
+
+// `Invalidate` implements the `Authorizer` interface. A static header
+// can't be renewed.
+func (auth *headerAuthorizer) Invalidate(req *http.Request) bool {
+	return false
+}
+
+// A `basicAuthorizer` sets the HTTP basic authentication.
+type basicAuthorizer struct {
+	username string
+	password string
+}
+
+// `Authorize` implements the `Authorizer` interface.
+func (auth *basicAuthorizer) Authorize(ctx context.Context, req *http.Request) error {
+	req.SetBasicAuth(auth.username, auth.password)
+	return nil
+}
+
+// `Invalidate` implements the `Authorizer` interface. Static credentials
+// can't be renewed.
+func (auth *basicAuthorizer) Invalidate(req *http.Request) bool {
+	return false
+}
+
+// A `tokenFetcher` requests a new token, and returns it with its
+// expiration time, or a zero time if it doesn't expire.
+type tokenFetcher func(ctx context.Context) (string, time.Time, error)
+
+// A `tokenAuthorizer` sets a bearer token, requested when it's first
+// needed and refreshed before it expires, or after its `lifetime` if it
+// doesn't expire.
+type tokenAuthorizer struct {
+	name     string
+	fetch    tokenFetcher
+	lifetime time.Duration
+
+	mutex   sync.Mutex
+	token   string
+	refresh time.Time
+}
+
+// `Authorize` implements the `Authorizer` interface.
+func (auth *tokenAuthorizer) Authorize(ctx context.Context, req *http.Request) error {
+	token, err := auth.getToken(ctx)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// `Invalidate` implements the `Authorizer` interface. The token is
+// discarded unless it has already been replaced.
+func (auth *tokenAuthorizer) Invalidate(req *http.Request) bool {
+	auth.mutex.Lock()
+	defer auth.mutex.Unlock()
+
+	if auth.token != "" && req.Header.Get("Authorization") == "Bearer "+auth.token {
+		log.Printf("Token rejected by the service, discarding token of authz service %s", auth.name)
+		auth.token = ""
+	}
+	return true
+}
+
+// `getToken` returns the current token, requesting a new one if there
+// isn't any or it's about to expire.
+func (auth *tokenAuthorizer) getToken(ctx context.Context) (string, error) {
+	auth.mutex.Lock()
+	defer auth.mutex.Unlock()
+
+	if auth.token != "" && time.Now().Before(auth.refresh) {
+		return auth.token, nil
+	}
+
+	log.Printf("Requesting token from authz service %s...", auth.name)
+	token, expires, err := auth.fetch(ctx)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrAuthorization, err)
+	}
+
+	if expires.IsZero() {
+		log.Printf("Token received from authz service %s", auth.name)
+		auth.token, auth.refresh = token, time.Now().Add(auth.lifetime)
+		return token, nil
+	}
+
+	log.Printf("Token received from authz service %s, expires at %s", auth.name, expires.Format(time.RFC3339))
+	margin := min(time.Until(expires)/10, refreshMargin)
+	auth.token, auth.refresh = token, expires.Add(-margin)
+	return token, nil
+}
+
+// `legacyToken` returns the fetcher of the legacy token flow. The
+// expiration is taken from the token, if it's a JWT.
+func legacyToken(client *http.Client, config *core.ServiceConfig) tokenFetcher {
+	retrier := NewRetrier(config.Retry)
+
+	return func(ctx context.Context) (string, time.Time, error) {
+		uri, err := url.Parse(config.BaseURL)
+		if err != nil {
+			return "", time.Time{}, fmt.Errorf("Error parsing authz URI: %w", err)
+		}
+
+		query := uri.Query()
+		query.Set("client", config.Parameters["client"])
+		query.Set("credential", config.Parameters["credential"])
+		uri.RawQuery = query.Encode()
+
+		body, err := requestToken(ctx, client, retrier, func() (*http.Request, error) {
+			return http.NewRequestWithContext(ctx, http.MethodGet, uri.String(), nil)
+		})
+		if err != nil {
+			return "", time.Time{}, err
+		}
+
+		token, ok := body["token"].(string)
+		if !ok || token == "" {
+			return "", time.Time{}, errors.New("Missing token in authz response")
+		}
+		return token, jwtExpiration(token), nil
+	}
+}
+
+// `oauth2Token` returns the fetcher of the OAuth2 client credentials
+// grant, posting the client credentials in the form.
+func oauth2Token(client *http.Client, config *core.ServiceConfig) tokenFetcher {
+	retrier := NewRetrier(config.Retry)
+
+	return func(ctx context.Context) (string, time.Time, error) {
+		form := url.Values{}
+		form.Set("grant_type", "client_credentials")
+		for _, key := range []string{"client_id", "client_secret", "scope", "audience"} {
+			if value := config.Parameters[key]; value != "" {
+				form.Set(key, value)
+			}
+		}
+
+		body, err := requestToken(ctx, client, retrier, func() (*http.Request, error) {
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.BaseURL, strings.NewReader(form.Encode()))
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Set("Accept", "application/json")
+			return req, nil
+		})
+		if err != nil {
+			return "", time.Time{}, err
+		}
+
+		token, ok := body["access_token"].(string)
+		if !ok || token == "" {
+			return "", time.Time{}, errors.New("Missing access_token in authz response")
+		}
+
+		var expires time.Time
+		if seconds, ok := core.ToFloat(body["expires_in"]); ok && seconds > 0 {
+			expires = time.Now().Add(time.Duration(seconds * float64(time.Second)))
+		} else {
+			expires = jwtExpiration(token)
+		}
+		return token, expires, nil
+	}
+}
+
+// `requestToken` sends a token request and returns the decoded body of
+// its response.
+func requestToken(ctx context.Context, client *http.Client, retrier *Retrier, build func() (*http.Request, error)) (map[string]any, error) {
+	res, err := retrier.Do(ctx, client, build)
+	if err != nil {
+		return nil, fmt.Errorf("Error requesting authz: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, StatusError(res)
+	}
+
+	var body map[string]any
+	decoder := json.NewDecoder(res.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&body); err != nil {
+		return nil, fmt.Errorf("Error decoding authz response: %w", err)
+	}
+	return body, nil
+}
+
+// `jwtExpiration` returns the expiration time of a JWT token, or a zero
+// time if it isn't a JWT or it doesn't expire. The token isn't verified.
+func jwtExpiration(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}
+	}
+
+	var claims struct {
+		Expiration float64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Expiration <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(claims.Expiration), 0)
+}
@@ -0,0 +1,175 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tnotstar/datacat/core"
+)
+
+// `newAuthzServer` starts an OAuth2 authorization server which issues
+// the tokens `token-1`, `token-2`... and counts them.
+func newAuthzServer(t *testing.T, tokens *atomic.Int32) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token": "token-%d", "expires_in": 3600}`, tokens.Add(1))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// `newAuthorizedEndpoint` returns the endpoint of the given API server,
+// authorized by the given authorization server.
+func newAuthorizedEndpoint(t *testing.T, api *httptest.Server, authz *httptest.Server) *Endpoint {
+	t.Helper()
+	cfg := &core.Config{Services: map[string]core.ServiceConfig{
+		"api":   {BaseURL: api.URL, WithAuthz: "authz"},
+		"authz": {Type: AuthOAuth2, BaseURL: authz.URL, Parameters: map[string]string{"client_id": "datacat"}},
+	}}
+	endpoint, err := NewEndpoint(cfg, "test", core.Arguments{"service": "api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return endpoint
+}
+
+func TestTokenAuthorizerRefreshesToken(t *testing.T) {
+	for _, lifetime := range []time.Duration{0, 50 * time.Millisecond} {
+		var fetched int
+		auth := &tokenAuthorizer{name: "authz", lifetime: lifetime, fetch: func(ctx context.Context) (string, time.Time, error) {
+			fetched++
+			if lifetime > 0 {
+				return fmt.Sprintf("token-%d", fetched), time.Time{}, nil
+			}
+			return fmt.Sprintf("token-%d", fetched), time.Now().Add(50 * time.Millisecond), nil
+		}}
+
+		authorize := func() string {
+			req, _ := http.NewRequest(http.MethodGet, "http://localhost", nil)
+			if err := auth.Authorize(context.Background(), req); err != nil {
+				t.Fatal(err)
+			}
+			return req.Header.Get("Authorization")
+		}
+		if first, second := authorize(), authorize(); first != "Bearer token-1" || second != first {
+			t.Errorf("Tokens with lifetime %s = %q, %q, want the first one twice", lifetime, first, second)
+		}
+		time.Sleep(60 * time.Millisecond)
+		if token := authorize(); token != "Bearer token-2" {
+			t.Errorf("Token with lifetime %s after expiration = %q, want a new one", lifetime, token)
+		}
+	}
+}
+
+func TestEndpointRenewsRejectedToken(t *testing.T) {
+	var tokens, requests atomic.Int32
+	authz := newAuthzServer(t, &tokens)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Header.Get("Authorization") != "Bearer token-2" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer api.Close()
+
+	endpoint := newAuthorizedEndpoint(t, api, authz)
+	route := &Route{Method: http.MethodGet, URL: api.URL}
+	res, err := endpoint.Exchange(context.Background(), route, nil)
+	if err != nil || !res.Succeeded() {
+		t.Fatalf("Exchange() = %v, %v", res.Status, err)
+	}
+	if tokens.Load() != 2 || requests.Load() != 2 {
+		t.Errorf("Sent %d request(s) with %d token(s), want 2 with 2", requests.Load(), tokens.Load())
+	}
+
+	// A request rejected with a renewed token isn't sent again.
+	endpoint = newAuthorizedEndpoint(t, api, authz)
+	res, err = endpoint.Exchange(context.Background(), route, nil)
+	if err != nil || res.StatusCode != http.StatusUnauthorized || tokens.Load() != 4 || requests.Load() != 4 {
+		t.Errorf("Exchange() = %v, %v with %d request(s) and %d token(s), want 401 with 4 and 4", res.Status, err, requests.Load(), tokens.Load())
+	}
+}
+
+func TestEndpointStaticCredentialsAreNotRetried(t *testing.T) {
+	var requests atomic.Int32
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer api.Close()
+
+	cfg := &core.Config{Services: map[string]core.ServiceConfig{
+		"api":   {BaseURL: api.URL, WithAuthz: "authz"},
+		"authz": {Type: AuthBearer, Parameters: map[string]string{"token": "secret"}},
+	}}
+	endpoint, err := NewEndpoint(cfg, "test", core.Arguments{"service": "api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := endpoint.Exchange(context.Background(), &Route{Method: http.MethodGet, URL: api.URL}, nil)
+	if err != nil || res.StatusCode != http.StatusUnauthorized || requests.Load() != 1 {
+		t.Errorf("Exchange() = %v, %v with %d request(s), want 401 with 1", res.Status, err, requests.Load())
+	}
+}
+
+func TestEndpointsShareAuthorizerOfTask(t *testing.T) {
+	var tokens atomic.Int32
+	authz := newAuthzServer(t, &tokens)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer api.Close()
+
+	run := func() {
+		trk := core.NewTracker("test", nil)
+		for i := 0; i < 2; i++ {
+			endpoint := newAuthorizedEndpoint(t, api, authz)
+			endpoint.Share(trk)
+			if _, err := endpoint.Exchange(context.Background(), &Route{Method: http.MethodGet, URL: api.URL}, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	run()
+	if tokens.Load() != 1 {
+		t.Errorf("Endpoints of a task requested %d token(s), want 1", tokens.Load())
+	}
+	run()
+	if tokens.Load() != 2 {
+		t.Errorf("Endpoints of two tasks requested %d token(s), want 2", tokens.Load())
+	}
+}
+
+func TestInvalidTokenLifetime(t *testing.T) {
+	cfg := &core.Config{Services: map[string]core.ServiceConfig{
+		"authz": {BaseURL: "http://localhost", Parameters: map[string]string{"token_lifetime": "forever"}},
+	}}
+	if _, err := NewAuthorizer(cfg, "authz"); err == nil {
+		t.Error("NewAuthorizer succeeded with an invalid token lifetime")
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package services
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/tnotstar/datacat/core"
+)
+
+// `tlsVersions` are the supported TLS versions by name.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// `NewClient` creates the HTTP client of the given service, with its
+// TLS settings. Server certificates are verified unless the service
+// sets `trustcert`.
+//
+// The `cfg` is the global configuration object.
+// The `config` is the configuration of the service.
+func NewClient(cfg core.Configurator, config *core.ServiceConfig) (*http.Client, error) {
+	tlsConfig, err := newTLSConfig(cfg, config)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: transport}, nil
+}
+
+// `newTLSConfig` returns the TLS settings of the given service.
+func newTLSConfig(cfg core.Configurator, config *core.ServiceConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: config.TrustCert,
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         config.TLS.ServerName,
+	}
+
+	if config.TLS.MinVersion != "" {
+		version, ok := tlsVersions[config.TLS.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("Invalid minimum TLS version: %s", config.TLS.MinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	basePath := filepath.Dir(cfg.GetConfigFilename())
+	if config.TLS.CAFile != "" {
+		fileName := core.ResolveFilename(basePath, config.TLS.CAFile)
+		certs, err := os.ReadFile(fileName)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading CA file: %w", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(certs) {
+			return nil, fmt.Errorf("No certificates found in CA file %s", fileName)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if config.TLS.CertFile != "" || config.TLS.KeyFile != "" {
+		if config.TLS.CertFile == "" || config.TLS.KeyFile == "" {
+			return nil, fmt.Errorf("Mutual TLS needs both a certificate and a key file")
+		}
+
+		cert, err := tls.LoadX509KeyPair(
+			core.ResolveFilename(basePath, config.TLS.CertFile),
+			core.ResolveFilename(basePath, config.TLS.KeyFile))
+		if err != nil {
+			return nil, fmt.Errorf("Error loading client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,200 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tnotstar/datacat/core"
+)
+
+// `writePEM` writes a PEM file of the given type and content in the
+// given directory, and returns its name.
+func writePEM(t *testing.T, dir string, name string, kind string, data []byte) string {
+	t.Helper()
+	fileName := filepath.Join(dir, name)
+	if err := os.WriteFile(fileName, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: data}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return fileName
+}
+
+// `newClientCertificate` writes a self-signed client certificate and its
+// key in the given directory. It returns the certificate, and the names
+// of the certificate and key files.
+func newClientCertificate(t *testing.T, dir string) (*x509.Certificate, string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "datacat"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, writePEM(t, dir, "client.pem", "CERTIFICATE", der), writePEM(t, dir, "client.key", "EC PRIVATE KEY", keyDER)
+}
+
+// `getWithClient` sends a request to the given server with the client
+// of a service with the given settings.
+func getWithClient(t *testing.T, server *httptest.Server, config core.ServiceConfig) error {
+	t.Helper()
+	client, err := NewClient(&core.Config{}, &config)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	res, err := client.Get(server.URL)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+func TestClientVerifiesServerCertificate(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	caFile := writePEM(t, t.TempDir(), "ca.pem", "CERTIFICATE", server.Certificate().Raw)
+
+	for _, test := range []struct {
+		name   string
+		config core.ServiceConfig
+		ok     bool
+	}{
+		{"system CA pool", core.ServiceConfig{}, false},
+		{"trustcert", core.ServiceConfig{TrustCert: true}, true},
+		{"cafile", core.ServiceConfig{TLS: core.TLSConfig{CAFile: caFile}}, true},
+		// The certificate of the test server is issued for `example.com`.
+		{"servername", core.ServiceConfig{TLS: core.TLSConfig{CAFile: caFile, ServerName: "example.com"}}, true},
+		{"wrong servername", core.ServiceConfig{TLS: core.TLSConfig{CAFile: caFile, ServerName: "api.internal"}}, false},
+	} {
+		if err := getWithClient(t, server, test.config); (err == nil) != test.ok {
+			t.Errorf("Request with %s = %v, want success %v", test.name, err, test.ok)
+		}
+	}
+}
+
+func TestClientMinVersion(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	server.StartTLS()
+	defer server.Close()
+
+	if err := getWithClient(t, server, core.ServiceConfig{TrustCert: true}); err != nil {
+		t.Errorf("Request with TLS 1.2 failed: %v", err)
+	}
+	if err := getWithClient(t, server, core.ServiceConfig{TrustCert: true, TLS: core.TLSConfig{MinVersion: "1.3"}}); err == nil {
+		t.Error("Request with minimum version 1.3 to a TLS 1.2 server succeeded")
+	}
+
+	if _, err := NewClient(&core.Config{}, &core.ServiceConfig{TLS: core.TLSConfig{MinVersion: "1.4"}}); err == nil {
+		t.Error("NewClient succeeded with an invalid minimum version")
+	}
+}
+
+func TestClientMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	cert, certFile, keyFile := newClientCertificate(t, dir)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(cert)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+
+	if err := getWithClient(t, server, core.ServiceConfig{TrustCert: true}); err == nil {
+		t.Error("Request without a client certificate succeeded")
+	}
+	if err := getWithClient(t, server, core.ServiceConfig{TrustCert: true, TLS: core.TLSConfig{CertFile: certFile, KeyFile: keyFile}}); err != nil {
+		t.Errorf("Request with a client certificate failed: %v", err)
+	}
+
+	for _, config := range []core.TLSConfig{
+		{CertFile: certFile},
+		{CertFile: certFile, KeyFile: filepath.Join(dir, "missing.key")},
+		{CAFile: keyFile},
+	} {
+		if _, err := NewClient(&core.Config{}, &core.ServiceConfig{TLS: config}); err == nil {
+			t.Errorf("NewClient succeeded with %+v", config)
+		}
+	}
+}
+
+func TestAuthorizerUsesTLSOfAuthzService(t *testing.T) {
+	var tokens atomic.Int32
+	authz := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokens.Add(1)
+		w.Write([]byte(`{"token": "secret"}`))
+	}))
+	defer authz.Close()
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer api.Close()
+
+	for _, authzTrust := range []bool{false, true} {
+		cfg := &core.Config{Services: map[string]core.ServiceConfig{
+			"api":   {BaseURL: api.URL, WithAuthz: "authz", TrustCert: true},
+			"authz": {BaseURL: authz.URL, TrustCert: authzTrust},
+		}}
+		endpoint, err := NewEndpoint(cfg, "test", core.Arguments{"service": "api"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = endpoint.Exchange(context.Background(), &Route{Method: http.MethodGet, URL: api.URL}, nil)
+		if (err == nil) != authzTrust {
+			t.Errorf("Exchange() with trustcert %v of the authz service = %v", authzTrust, err)
+		}
+	}
+	if tokens.Load() != 1 {
+		t.Errorf("Authz service issued %d token(s), want 1", tokens.Load())
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/tnotstar/datacat/core"
+)
+
+// An `Endpoint` sends the requests of a task to a configured service,
+// with the client, the authorization and the retry policy of the
+// service.
+type Endpoint struct {
+	// The `baseURL` of the service.
+	baseURL string
+	// The `client` to send the requests with.
+	client *http.Client
+	// The `authz` name of the authorization service, if any.
+	authz string
+	// The `authorizer` of the requests, or nil if they aren't authorized.
+	authorizer Authorizer
+	// The `retrier` of the requests to the service.
+	retrier *Retrier
+}
+
+// `NewEndpoint` creates the endpoint of the service named by the
+// `service` argument.
+//
+// The `cfg` is the global configuration object.
+// The `taskName` is the name of the task to be executed.
+// The `args` are the arguments of the source, adapter or target.
+func NewEndpoint(cfg core.Configurator, taskName string, args core.Arguments) (*Endpoint, error) {
+	serviceName, err := args.RequiredString("service")
+	if err != nil {
+		return nil, err
+	}
+
+	serviceConfig, err := cfg.GetServiceConfig(serviceName)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting configuration for service %s in task %s: %w", serviceName, taskName, err)
+	}
+
+	client, err := NewClient(cfg, serviceConfig)
+	if err != nil {
+		return nil, fmt.Errorf("Error configuring client for service %s: %w", serviceName, err)
+	}
+
+	authorizer, err := NewAuthorizer(cfg, serviceConfig.WithAuthz)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Endpoint{
+		baseURL:    serviceConfig.BaseURL,
+		client:     client,
+		authz:      serviceConfig.WithAuthz,
+		authorizer: authorizer,
+		retrier:    NewRetrier(serviceConfig.Retry),
+	}, nil
+}
+
+// `BaseURL` returns the base URL of the service.
+func (ep *Endpoint) BaseURL() string {
+	return ep.baseURL
+}
+
+// `Share` makes the endpoint use the authorizer shared by all the
+// endpoints of the running task with the same authorization service, so
+// that their tokens are requested once. It must be called before the
+// endpoint sends any request.
+func (ep *Endpoint) Share(trk *core.Tracker) {
+	if ep.authorizer == nil {
+		return
+	}
+	authorizer := ep.authorizer
+	ep.authorizer = trk.Shared("authz:"+ep.authz, func() any { return authorizer }).(Authorizer)
+}
+
+// A `Response` of a service, with its body already read.
+type Response struct {
+	*http.Response
+	// The `Data` of the body of the response.
+	Data []byte
+}
+
+// `Exchange` sends a request with the given route and JSON body, if
+// any, and returns its response, whatever its status. The request is
+// authorized and retried by the settings of the service. A request
+// rejected with a 401 status is sent once again with new credentials, if
+// they can be renewed. Authorization errors wrap `ErrAuthorization`.
+func (ep *Endpoint) Exchange(ctx context.Context, route *Route, body []byte) (*Response, error) {
+	res, err := ep.send(ctx, route, body)
+	if err == nil && res.StatusCode == http.StatusUnauthorized && ep.authorizer != nil && ep.authorizer.Invalidate(res.Request) {
+		res, err = ep.send(ctx, route, body)
+	}
+	return res, err
+}
+
+// `send` sends a request with the given route and JSON body, retried by
+// the settings of the service, and returns its response.
+func (ep *Endpoint) send(ctx context.Context, route *Route, body []byte) (*Response, error) {
+	res, err := ep.retrier.Do(ctx, ep.client, func() (*http.Request, error) {
+		var reader io.Reader
+		if len(body) > 0 {
+			reader = bytes.NewReader(body)
+		}
+		req, err := http.NewRequestWithContext(ctx, route.Method, route.URL, reader)
+		if err != nil {
+			return nil, fmt.Errorf("Error creating request: %w", err)
+		}
+		for name, values := range route.Header {
+			req.Header[name] = values
+		}
+		if len(body) > 0 && req.Header.Get("Content-Type") == "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if ep.authorizer != nil {
+			if err := ep.authorizer.Authorize(ctx, req); err != nil {
+				return nil, err
+			}
+		}
+		return req, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error sending request: %w", err)
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading response: %w", err)
+	}
+	return &Response{Response: res, Data: data}, nil
+}
+
+// `Succeeded` returns true if the response has a successful status.
+func (res *Response) Succeeded() bool {
+	return res.StatusCode >= 200 && res.StatusCode <= 299
+}
+
+// `Err` returns the error of an unexpected response status, or nil if
+// the response succeeded.
+func (res *Response) Err() error {
+	if res.Succeeded() {
+		return nil
+	}
+	return statusError(res.Status, res.Data)
+}
+
+// `JSON` decodes the body of the response, keeping its numbers as
+// `json.Number`. An empty body decodes to nil.
+func (res *Response) JSON() (any, error) {
+	return DecodeJSON(bytes.NewReader(res.Data))
+}
@@ -0,0 +1,100 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tnotstar/datacat/core"
+)
+
+// `newTestEndpoint` returns the endpoint of the given server, retried
+// up to the given attempts.
+func newTestEndpoint(t *testing.T, server *httptest.Server, attempts int) *Endpoint {
+	t.Helper()
+	cfg := &core.Config{Services: map[string]core.ServiceConfig{
+		"api": {BaseURL: server.URL, Retry: core.RetryConfig{MaxAttempts: attempts, Backoff: time.Millisecond}},
+	}}
+	endpoint, err := NewEndpoint(cfg, "test", core.Arguments{"service": "api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return endpoint
+}
+
+func TestEndpointExchangeRetries(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get("Content-Type") != "application/json" || string(body) != `{"id":1}` {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"total": 12345678901234567890}`))
+	}))
+	defer server.Close()
+
+	route := &Route{Method: http.MethodPost, URL: server.URL}
+	res, err := newTestEndpoint(t, server, 2).Exchange(context.Background(), route, []byte(`{"id":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := res.Err(); err != nil {
+		t.Fatalf("Response after %d request(s): %v", requests.Load(), err)
+	}
+	response, err := res.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total := response.(map[string]any)["total"]; fmt.Sprint(total) != "12345678901234567890" {
+		t.Errorf("Decoded total = %v", total)
+	}
+}
+
+func TestEndpointExchangeStatusError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field: " + strings.Repeat("x", 1000)))
+	}))
+	defer server.Close()
+
+	route := &Route{Method: http.MethodGet, URL: server.URL}
+	res, err := newTestEndpoint(t, server, 1).Exchange(context.Background(), route, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = res.Err()
+	if res.Succeeded() || err == nil || !strings.Contains(err.Error(), "400 Bad Request: missing field") || len(err.Error()) > 600 {
+		t.Errorf("Err() = %v", err)
+	}
+}
@@ -0,0 +1,277 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/tnotstar/datacat/core"
+)
+
+// The `templateFuncs` are the functions available to the templates of
+// a request, in addition to the standard ones.
+var templateFuncs = template.FuncMap{
+	"json": func(value any) (string, error) {
+		buffer, err := json.Marshal(value)
+		return string(buffer), err
+	},
+	"urlescape": urlEscape,
+}
+
+// `urlEscape` returns the given value escaped to be used in any part
+// of a URL. A null value is empty.
+func urlEscape(value any) string {
+	if value == nil {
+		return ""
+	}
+	return strings.ReplaceAll(url.QueryEscape(fmt.Sprint(value)), "+", "%20")
+}
+
+// A `Route` is the method, URL and headers of a request.
+type Route struct {
+	Method string
+	URL    string
+	Header http.Header
+}
+
+// A `RequestTemplate` builds the requests to a service endpoint from
+// data rows. Its method, path, headers and body are Go templates which
+// may use the fields of the row, like `/customers/{{.id}}`.
+type RequestTemplate struct {
+	// The `baseURL` of the service.
+	baseURL string
+	// The `url` of the endpoint, if its path isn't a template.
+	url string
+	// The `path` template of the endpoint, if it uses the row fields.
+	path *template.Template
+	// The `method` template.
+	method *template.Template
+	// The `headers` templates, by header name.
+	headers map[string]*template.Template
+	// The `body` template, or nil to send the row itself.
+	body *template.Template
+	// `noBody` is true if the requests have no body.
+	noBody bool
+	// `perRow` is true if the route depends on the row fields.
+	perRow bool
+}
+
+// `NewRequestTemplate` creates the request template of the endpoint
+// configured by the `method`, `path`, `headers` and `body` arguments.
+//
+// The `baseURL` is the base URL of the service.
+// The `args` are the arguments of the endpoint.
+// The `method` is the default method.
+func NewRequestTemplate(baseURL string, args core.Arguments, method string) (*RequestTemplate, error) {
+	rt := &RequestTemplate{baseURL: baseURL, headers: make(map[string]*template.Template)}
+
+	var err error
+	rt.method, err = parseTemplate("method", args.String("method", method))
+	if err != nil {
+		return nil, err
+	}
+	rt.perRow = isTemplate(args.String("method", method))
+
+	path := args.String("path", "")
+	if isTemplate(path) {
+		if rt.path, err = parseTemplate("path", path); err == nil {
+			escapeActions(rt.path)
+		}
+		rt.perRow = true
+	} else {
+		rt.url, err = url.JoinPath(baseURL, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing endpoint URI: %w", err)
+	}
+
+	headers, err := args.Map("headers")
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range headers {
+		text := fmt.Sprint(value)
+		if rt.headers[name], err = parseTemplate("header "+name, text); err != nil {
+			return nil, err
+		}
+		rt.perRow = rt.perRow || isTemplate(text)
+	}
+
+	if args.Has("body") {
+		text := args.String("body", "")
+		if rt.body, err = parseTemplate("body", text); err != nil {
+			return nil, err
+		}
+		rt.noBody = strings.TrimSpace(text) == ""
+	}
+
+	return rt, nil
+}
+
+// `PerRow` returns true if the method, path or headers of the requests
+// depend on the fields of the row.
+func (rt *RequestTemplate) PerRow() bool {
+	return rt.perRow
+}
+
+// `Route` returns the method, URL and headers of the request for the
+// given row. Empty headers aren't sent.
+func (rt *RequestTemplate) Route(row core.RowMap) (*Route, error) {
+	method, err := execute(rt.method, row)
+	if err != nil {
+		return nil, err
+	}
+	route := &Route{
+		Method: strings.ToUpper(strings.TrimSpace(method)),
+		URL:    rt.url,
+		Header: make(http.Header),
+	}
+	if route.Method == "" {
+		return nil, fmt.Errorf("Empty request method")
+	}
+
+	if rt.path != nil {
+		path, err := execute(rt.path, row)
+		if err != nil {
+			return nil, err
+		}
+		route.URL = strings.TrimRight(rt.baseURL, "/") + "/" + strings.TrimLeft(path, "/")
+		if _, err := url.Parse(route.URL); err != nil {
+			return nil, fmt.Errorf("Error parsing endpoint URI: %w", err)
+		}
+	}
+
+	for name, tmpl := range rt.headers {
+		value, err := execute(tmpl, row)
+		if err != nil {
+			return nil, err
+		}
+		if value != "" {
+			route.Header.Set(name, value)
+		}
+	}
+
+	return route, nil
+}
+
+// `Body` returns the body of the request for the given row: the row
+// itself as JSON, or the output of the body template, which must be
+// valid JSON. It returns an empty body if the template's output is
+// blank.
+func (rt *RequestTemplate) Body(row core.RowMap) ([]byte, error) {
+	if rt.body == nil {
+		return json.Marshal(row.Data())
+	}
+	if rt.noBody {
+		return nil, nil
+	}
+
+	text, err := execute(rt.body, row)
+	if err != nil {
+		return nil, err
+	}
+	body := bytes.TrimSpace([]byte(text))
+	if len(body) > 0 && !json.Valid(body) {
+		return nil, fmt.Errorf("Invalid JSON from body template: %s", body)
+	}
+	return body, nil
+}
+
+// `isTemplate` returns true if the given text has template actions.
+func isTemplate(text string) bool {
+	return strings.Contains(text, "{{")
+}
+
+// `parseTemplate` parses the given template text. A template fails on
+// the fields missing from the row.
+func parseTemplate(name string, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing %s template: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// `execute` executes the given template with the given row.
+func execute(tmpl *template.Template, row core.RowMap) (string, error) {
+	var buffer strings.Builder
+	if err := tmpl.Execute(&buffer, row); err != nil {
+		return "", fmt.Errorf("Error executing %s template: %w", tmpl.Name(), err)
+	}
+	return buffer.String(), nil
+}
+
+// `escapeActions` URL-escapes the output of the actions of the given
+// template, by appending the `urlescape` function to their pipelines.
+// The fields keep their types, so they can be compared in conditions.
+func escapeActions(tmpl *template.Template) {
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			escapeNode(t.Tree.Root)
+		}
+	}
+}
+
+// `escapeNode` URL-escapes the output of the actions of the given node
+// of a template tree.
+func escapeNode(node parse.Node) {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node != nil {
+			for _, child := range node.Nodes {
+				escapeNode(child)
+			}
+		}
+	case *parse.IfNode:
+		escapeNode(node.List)
+		escapeNode(node.ElseList)
+	case *parse.RangeNode:
+		escapeNode(node.List)
+		escapeNode(node.ElseList)
+	case *parse.WithNode:
+		escapeNode(node.List)
+		escapeNode(node.ElseList)
+	case *parse.ActionNode:
+		// Declarations output nothing, and escaped pipelines are kept.
+		pipe := node.Pipe
+		if len(pipe.Decl) > 0 || isEscaped(pipe) {
+			return
+		}
+		escape := &parse.CommandNode{NodeType: parse.NodeCommand, Pos: node.Pos}
+		escape.Args = []parse.Node{parse.NewIdentifier("urlescape").SetPos(node.Pos)}
+		pipe.Cmds = append(pipe.Cmds, escape)
+	}
+}
+
+// `isEscaped` returns true if the given pipeline ends with a function
+// which escapes its output for a URL.
+func isEscaped(pipe *parse.PipeNode) bool {
+	last := pipe.Cmds[len(pipe.Cmds)-1]
+	identifier, ok := last.Args[0].(*parse.IdentifierNode)
+	return ok && (identifier.Ident == "urlescape" || identifier.Ident == "urlquery")
+}
@@ -0,0 +1,95 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/tnotstar/datacat/core"
+)
+
+func TestRequestTemplateRoute(t *testing.T) {
+	for _, test := range []struct {
+		path string
+		row  core.RowMap
+		want string
+	}{
+		{"items/{{.id}}", core.RowMap{"id": "a b/c?d"}, "http://api/items/a%20b%2Fc%3Fd"},
+		{"items/{{.id}}", core.RowMap{"id": json.Number("12")}, "http://api/items/12"},
+		{"items/{{if gt .n 0}}{{.n}}{{else}}none{{end}}", core.RowMap{"n": 3}, "http://api/items/3"},
+		{"items/{{if gt .n 0}}{{.n}}{{else}}none{{end}}", core.RowMap{"n": -1}, "http://api/items/none"},
+		{"items/{{if .active}}on{{end}}/{{.missing}}", core.RowMap{"active": true, "missing": nil}, "http://api/items/on/"},
+		{"items/{{.id | urlquery}}", core.RowMap{"id": "a&b"}, "http://api/items/a%26b"},
+		{"items/{{$id := .id}}{{$id}}", core.RowMap{"id": "a&b"}, "http://api/items/a%26b"},
+		{"items/{{range .ids}}{{.}},{{end}}", core.RowMap{"ids": []any{"a/b", 2}}, "http://api/items/a%2Fb,2,"},
+	} {
+		rt, err := NewRequestTemplate("http://api", core.Arguments{"path": test.path}, http.MethodGet)
+		if err != nil {
+			t.Fatalf("NewRequestTemplate(%q): %v", test.path, err)
+		}
+		route, err := rt.Route(test.row)
+		if err != nil {
+			t.Errorf("Route(%q, %v): %v", test.path, test.row, err)
+			continue
+		}
+		if route.URL != test.want {
+			t.Errorf("Route(%q, %v) = %s, want %s", test.path, test.row, route.URL, test.want)
+		}
+	}
+}
+
+func TestRequestTemplateMissingField(t *testing.T) {
+	rt, err := NewRequestTemplate("http://api", core.Arguments{"path": "items/{{.id}}"}, http.MethodGet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rt.Route(core.RowMap{}); err == nil {
+		t.Error("Route of a row without the path field succeeded")
+	}
+}
+
+func TestRequestTemplateBody(t *testing.T) {
+	args := core.Arguments{
+		"method": "{{if .deleted}}DELETE{{else}}PUT{{end}}",
+		"body":   `{{if not .deleted}}{"id": {{json .id}}, "big": {{gt .n 10}}}{{end}}`,
+	}
+	rt, err := NewRequestTemplate("http://api", args, http.MethodPost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	row := core.RowMap{"id": "a/b", "n": 12, "deleted": false}
+	route, err := rt.Route(row)
+	if err != nil || route.Method != http.MethodPut {
+		t.Errorf("Route() = %+v, %v, want a PUT", route, err)
+	}
+	body, err := rt.Body(row)
+	if err != nil || string(body) != `{"id": "a/b", "big": true}` {
+		t.Errorf("Body() = %s, %v", body, err)
+	}
+
+	row["deleted"] = true
+	if body, err := rt.Body(row); err != nil || body != nil {
+		t.Errorf("Body() of a deleted row = %s, %v, want none", body, err)
+	}
+}
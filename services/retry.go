@@ -0,0 +1,190 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tnotstar/datacat/core"
+)
+
+// The default retry policy values.
+const (
+	defaultMaxAttempts = 1
+	defaultBackoff     = time.Second
+	defaultMaxBackoff  = 30 * time.Second
+	defaultMultiplier  = 2.0
+	defaultJitter      = 0.2
+)
+
+// A `Retrier` sends requests to a service, retrying them according to
+// the retry policy of the service.
+type Retrier struct {
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	multiplier  float64
+	jitter      float64
+	statuses    map[int]bool
+}
+
+// `NewRetrier` creates a new retrier with the given policy, filling in
+// the missing values with the defaults.
+func NewRetrier(config core.RetryConfig) *Retrier {
+	rt := &Retrier{
+		maxAttempts: config.MaxAttempts,
+		backoff:     config.Backoff,
+		maxBackoff:  config.MaxBackoff,
+		multiplier:  config.Multiplier,
+		jitter:      defaultJitter,
+	}
+	if rt.maxAttempts < 1 {
+		rt.maxAttempts = defaultMaxAttempts
+	}
+	if rt.backoff <= 0 {
+		rt.backoff = defaultBackoff
+	}
+	if rt.maxBackoff <= 0 {
+		rt.maxBackoff = defaultMaxBackoff
+	}
+	if rt.multiplier < 1 {
+		rt.multiplier = defaultMultiplier
+	}
+	if config.Jitter != nil {
+		rt.jitter = math.Min(math.Max(*config.Jitter, 0), 1)
+	}
+	if len(config.Statuses) > 0 {
+		rt.statuses = make(map[int]bool, len(config.Statuses))
+		for _, status := range config.Statuses {
+			rt.statuses[status] = true
+		}
+	}
+	return rt
+}
+
+// `Do` sends the request created by `build` with the given client. The
+// request is built again and retried after a transport error or a
+// retryable response status, until the maximum number of attempts. The
+// last response is returned, whatever its status; the caller must close
+// its body.
+func (rt *Retrier) Do(ctx context.Context, client *http.Client, build func() (*http.Request, error)) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		req, err := build()
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := client.Do(req)
+		if ctx.Err() != nil {
+			if err == nil {
+				res.Body.Close()
+			}
+			return nil, ctx.Err()
+		}
+		if attempt >= rt.maxAttempts || err == nil && !rt.isRetryable(res.StatusCode) {
+			return res, err
+		}
+
+		delay := rt.delay(attempt)
+		if err != nil {
+			log.Printf("Retrying request to %s in %s after error: %s", req.URL.Redacted(), delay, err)
+		} else {
+			if after, ok := retryAfter(res); ok && after > delay {
+				delay = after
+			}
+			log.Printf("Retrying request to %s in %s after status: %s", req.URL.Redacted(), delay, res.Status)
+			io.Copy(io.Discard, io.LimitReader(res.Body, 1<<16))
+			res.Body.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// `isRetryable` returns true if a response with the given status code
+// must be retried.
+func (rt *Retrier) isRetryable(status int) bool {
+	if rt.statuses != nil {
+		return rt.statuses[status]
+	}
+	return status == http.StatusTooManyRequests || status >= 500 && status <= 599
+}
+
+// `delay` returns the backoff before the retry of the given attempt,
+// growing exponentially, with a random jitter.
+func (rt *Retrier) delay(attempt int) time.Duration {
+	backoff := float64(rt.backoff) * math.Pow(rt.multiplier, float64(attempt-1))
+	backoff = math.Min(backoff, float64(rt.maxBackoff))
+	backoff *= 1 + rt.jitter*(2*rand.Float64()-1)
+	return time.Duration(backoff)
+}
+
+// `retryAfter` returns the delay requested by the `Retry-After` header
+// of the response, given in seconds or as a date.
+func retryAfter(res *http.Response) (time.Duration, bool) {
+	header := res.Header.Get("Retry-After")
+	if header == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		// A date in the past asks for no delay.
+		return max(time.Until(date), 0), true
+	}
+	return 0, false
+}
+
+// `StatusError` returns the error of an unexpected response status,
+// with the beginning of the response body.
+func StatusError(res *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(res.Body, statusErrorBytes))
+	return statusError(res.Status, body)
+}
+
+// The maximum number of bytes of a response body in a status error.
+const statusErrorBytes = 512
+
+// `statusError` returns the error of an unexpected response status, with
+// the beginning of the given response body.
+func statusError(status string, body []byte) error {
+	if len(body) > statusErrorBytes {
+		body = body[:statusErrorBytes]
+	}
+	if text := strings.TrimSpace(string(body)); text != "" {
+		return fmt.Errorf("Unexpected response status: %s: %s", status, text)
+	}
+	return fmt.Errorf("Unexpected response status: %s", status)
+}
@@ -0,0 +1,154 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tnotstar/datacat/core"
+)
+
+// `newStatusServer` starts a test server which answers the given status
+// codes in turn, repeating the last one, and counts the requests.
+func newStatusServer(t *testing.T, requests *atomic.Int32, statuses ...int) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(requests.Add(1))
+		w.WriteHeader(statuses[min(n, len(statuses))-1])
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// `doRequest` sends a GET request to the given server with the given
+// retrier, and returns the status of the last response.
+func doRequest(ctx context.Context, rt *Retrier, server *httptest.Server) (int, error) {
+	res, err := rt.Do(ctx, server.Client(), func() (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	})
+	if err != nil {
+		return 0, err
+	}
+	res.Body.Close()
+	return res.StatusCode, nil
+}
+
+func TestRetrierAttempts(t *testing.T) {
+	var requests atomic.Int32
+	server := newStatusServer(t, &requests, http.StatusServiceUnavailable)
+	rt := NewRetrier(core.RetryConfig{MaxAttempts: 3, Backoff: time.Millisecond})
+
+	status, err := doRequest(context.Background(), rt, server)
+	if err != nil || status != http.StatusServiceUnavailable || requests.Load() != 3 {
+		t.Errorf("Got status %d and error %v after %d request(s), want 503 after 3", status, err, requests.Load())
+	}
+}
+
+func TestRetrierSucceedsAfterRetry(t *testing.T) {
+	var requests atomic.Int32
+	server := newStatusServer(t, &requests, http.StatusTooManyRequests, http.StatusOK)
+	rt := NewRetrier(core.RetryConfig{MaxAttempts: 3, Backoff: time.Millisecond})
+
+	status, err := doRequest(context.Background(), rt, server)
+	if err != nil || status != http.StatusOK || requests.Load() != 2 {
+		t.Errorf("Got status %d and error %v after %d request(s), want 200 after 2", status, err, requests.Load())
+	}
+}
+
+func TestRetrierStatuses(t *testing.T) {
+	config := core.RetryConfig{MaxAttempts: 3, Backoff: time.Millisecond, Statuses: []int{http.StatusConflict}}
+
+	// A status out of the list isn't retried, even if it's a 5xx.
+	var requests atomic.Int32
+	server := newStatusServer(t, &requests, http.StatusServiceUnavailable)
+	if status, _ := doRequest(context.Background(), NewRetrier(config), server); status != http.StatusServiceUnavailable || requests.Load() != 1 {
+		t.Errorf("Got status %d after %d request(s), want 503 after 1", status, requests.Load())
+	}
+
+	requests.Store(0)
+	server = newStatusServer(t, &requests, http.StatusConflict, http.StatusOK)
+	if status, _ := doRequest(context.Background(), NewRetrier(config), server); status != http.StatusOK || requests.Load() != 2 {
+		t.Errorf("Got status %d after %d request(s), want 200 after 2", status, requests.Load())
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	for _, test := range []struct {
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{"", 0, false},
+		{"3", 3 * time.Second, true},
+		{"soon", 0, false},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, true},
+	} {
+		res := &http.Response{Header: http.Header{"Retry-After": {test.header}}}
+		if got, ok := retryAfter(res); got != test.want || ok != test.ok {
+			t.Errorf("retryAfter(%q) = %v, %v, want %v, %v", test.header, got, ok, test.want, test.ok)
+		}
+	}
+
+	res := &http.Response{Header: http.Header{"Retry-After": {time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)}}}
+	if got, ok := retryAfter(res); !ok || got < 58*time.Second || got > time.Minute {
+		t.Errorf("retryAfter() of a date in a minute = %v, %v", got, ok)
+	}
+}
+
+func TestRetrierHonoursRetryAfter(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	rt := NewRetrier(core.RetryConfig{MaxAttempts: 2, Backoff: time.Millisecond})
+
+	start := time.Now()
+	if status, err := doRequest(context.Background(), rt, server); err != nil || status != http.StatusOK {
+		t.Fatalf("Got status %d and error %v", status, err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("Retried after %v, want at least the 1s of Retry-After", elapsed)
+	}
+}
+
+func TestRetrierCancelledDuringBackoff(t *testing.T) {
+	var requests atomic.Int32
+	server := newStatusServer(t, &requests, http.StatusServiceUnavailable)
+	rt := NewRetrier(core.RetryConfig{MaxAttempts: 3, Backoff: time.Hour, MaxBackoff: time.Hour})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := doRequest(ctx, rt, server)
+	if !errors.Is(err, context.DeadlineExceeded) || time.Since(start) > 5*time.Second || requests.Load() != 1 {
+		t.Errorf("Got error %v after %v and %d request(s)", err, time.Since(start), requests.Load())
+	}
+}
@@ -21,7 +21,7 @@
 package sources
 
 import (
-	"log"
+	"fmt"
 
 	"github.com/tnotstar/datacat/core"
 )
@@ -32,10 +32,10 @@ import (
 // The `id` is the index of the adapter to be created.
 // The `cfg` is the global configuration object.
 // The `taskName` is the name of the task to be executed.
-func BuildSource(id int, cfg core.Configurator, taskName string) core.Source {
+func BuildSource(id int, cfg core.Configurator, taskName string) (core.Source, error) {
 	sourceConfig, err := cfg.GetSourceConfig(taskName)
 	if err != nil {
-		log.Fatalf("Error getting source configuration for task %s: %s", taskName, err)
+		return nil, fmt.Errorf("Error getting source configuration for task %s: %w", taskName, err)
 	}
 
 	if IsaDatabaseQuerySource(sourceConfig.Type) {
@@ -46,6 +46,21 @@ func BuildSource(id int, cfg core.Configurator, taskName string) core.Source {
 		return NewJSONLFileSource(id, cfg, taskName)
 	}
 
-	log.Fatalf("Invalid source endpoint type %s", sourceConfig.Type)
-	return nil
+	if IsaCSVFileSource(sourceConfig.Type) {
+		return NewCSVFileSource(id, cfg, taskName)
+	}
+
+	if IsaXLSXFileSource(sourceConfig.Type) {
+		return NewXLSXFileSource(id, cfg, taskName)
+	}
+
+	if IsaParquetFileSource(sourceConfig.Type) {
+		return NewParquetFileSource(id, cfg, taskName)
+	}
+
+	if IsaHttpRequestSource(sourceConfig.Type) {
+		return NewHttpRequestSource(id, cfg, taskName)
+	}
+
+	return nil, fmt.Errorf("Invalid source endpoint type %s", sourceConfig.Type)
 }
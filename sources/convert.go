@@ -0,0 +1,682 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sources
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tnotstar/datacat/core"
+)
+
+// The types into which the values of a database column are converted.
+const (
+	// `ColumnAuto` converts the values by the type of the column.
+	ColumnAuto = "auto"
+	// `ColumnRaw` keeps the values as returned by the driver.
+	ColumnRaw = "raw"
+	// `ColumnString` converts the values to text.
+	ColumnString = "string"
+	// `ColumnNumber` converts the values to exact `json.Number` values.
+	ColumnNumber = "number"
+	// `ColumnDecimal` converts the values to exact numbers or text, as
+	// set by the `decimals` argument.
+	ColumnDecimal = "decimal"
+	// `ColumnInteger` converts the values to integers.
+	ColumnInteger = "integer"
+	// `ColumnFloat` converts the values to floats.
+	ColumnFloat = "float"
+	// `ColumnBoolean` converts the values to booleans.
+	ColumnBoolean = "boolean"
+	// `ColumnTime` converts the values to times.
+	ColumnTime = "time"
+	// `ColumnDate` converts the values to dates, as `2006-01-02` text.
+	ColumnDate = "date"
+	// `ColumnGUID` converts the values to GUID text.
+	ColumnGUID = "guid"
+	// `ColumnJSON` decodes the values as JSON documents.
+	ColumnJSON = "json"
+	// `ColumnBinary` converts the values to bytes, or their text as set
+	// by the `binary` argument.
+	ColumnBinary = "binary"
+)
+
+// The encodings of binary values.
+const (
+	// `BinaryRaw` keeps the bytes, which are written as base64 to JSON.
+	BinaryRaw = "raw"
+	// `BinaryBase64` converts the bytes to base64 text.
+	BinaryBase64 = "base64"
+	// `BinaryHex` converts the bytes to hexadecimal text.
+	BinaryHex = "hex"
+)
+
+// The `columnTypes` of the databases by their type names, when the type
+// name is shared by several of them.
+var columnTypes = map[string]string{
+	"TINYINT":          ColumnInteger,
+	"SMALLINT":         ColumnInteger,
+	"MEDIUMINT":        ColumnInteger,
+	"INT":              ColumnInteger,
+	"INTEGER":          ColumnInteger,
+	"BIGINT":           ColumnInteger,
+	"INT2":             ColumnInteger,
+	"INT4":             ColumnInteger,
+	"INT8":             ColumnInteger,
+	"YEAR":             ColumnInteger,
+	"REAL":             ColumnFloat,
+	"FLOAT":            ColumnFloat,
+	"FLOAT4":           ColumnFloat,
+	"FLOAT8":           ColumnFloat,
+	"DOUBLE":           ColumnFloat,
+	"BFLOAT":           ColumnFloat,
+	"BDOUBLE":          ColumnFloat,
+	"IBFLOAT":          ColumnFloat,
+	"IBDOUBLE":         ColumnFloat,
+	"DECIMAL":          ColumnDecimal,
+	"NUMERIC":          ColumnDecimal,
+	"NUMBER":           ColumnDecimal,
+	"MONEY":            ColumnDecimal,
+	"SMALLMONEY":       ColumnDecimal,
+	"BOOL":             ColumnBoolean,
+	"BOOLEAN":          ColumnBoolean,
+	"DATE":             ColumnTime,
+	"DATETIME":         ColumnTime,
+	"DATETIME2":        ColumnTime,
+	"SMALLDATETIME":    ColumnTime,
+	"DATETIMEOFFSET":   ColumnTime,
+	"TIMESTAMP":        ColumnTime,
+	"TIMESTAMPTZ":      ColumnTime,
+	"TIMESTAMPDTY":     ColumnTime,
+	"TIMESTAMPTZ_DTY":  ColumnTime,
+	"TIMESTAMPLTZ_DTY": ColumnTime,
+	"TIMESTAMPELTZ":    ColumnTime,
+	"UNIQUEIDENTIFIER": ColumnGUID,
+	"UUID":             ColumnGUID,
+	"JSON":             ColumnJSON,
+	"JSONB":            ColumnJSON,
+	"CHAR":             ColumnString,
+	"NCHAR":            ColumnString,
+	"VARCHAR":          ColumnString,
+	"NVARCHAR":         ColumnString,
+	"BPCHAR":           ColumnString,
+	"TEXT":             ColumnString,
+	"NTEXT":            ColumnString,
+	"TINYTEXT":         ColumnString,
+	"MEDIUMTEXT":       ColumnString,
+	"LONGTEXT":         ColumnString,
+	"CLOB":             ColumnString,
+	"NCLOB":            ColumnString,
+	"OCICLOBLOCATOR":   ColumnString,
+	"LONG":             ColumnString,
+	"LONGVARCHAR":      ColumnString,
+	"XML":              ColumnString,
+	"BINARY":           ColumnBinary,
+	"VARBINARY":        ColumnBinary,
+	"IMAGE":            ColumnBinary,
+	"BYTEA":            ColumnBinary,
+	"TINYBLOB":         ColumnBinary,
+	"BLOB":             ColumnBinary,
+	"MEDIUMBLOB":       ColumnBinary,
+	"LONGBLOB":         ColumnBinary,
+	"RAW":              ColumnBinary,
+	"LONGRAW":          ColumnBinary,
+	"OCIBLOBLOCATOR":   ColumnBinary,
+}
+
+// The `driverColumnTypes` of the databases whose type names differ from
+// the shared ones, by driver.
+var driverColumnTypes = map[string]map[string]string{
+	"mysql": {
+		"BIT":      ColumnBinary,
+		"GEOMETRY": ColumnBinary,
+	},
+}
+
+// A `columnConverter` converts a value of a column, as returned by the
+// database driver, into the type of the field of a row.
+type columnConverter func(value any) (any, error)
+
+// A `normalization` converts the values of the columns returned by the
+// database drivers into predictable types.
+type normalization struct {
+	// `decimals` is the type of decimal values: a number or a string.
+	decimals string
+	// `binary` is the encoding of binary values.
+	binary string
+	// `location` is the time zone of the times, or nil to keep them.
+	location *time.Location
+	// `types` are the overridden types of the columns, by their names
+	// in lowercase.
+	types map[string]string
+}
+
+// `getNormalization` returns the normalization configured by the given
+// source arguments.
+func getNormalization(args core.Arguments) (*normalization, error) {
+	norm := &normalization{
+		decimals: strings.ToLower(args.String("decimals", ColumnNumber)),
+		binary:   strings.ToLower(args.String("binary", BinaryRaw)),
+		types:    map[string]string{},
+	}
+	if norm.decimals != ColumnNumber && norm.decimals != ColumnString {
+		return nil, fmt.Errorf("Invalid type of decimal values: %s", norm.decimals)
+	}
+	if norm.binary != BinaryRaw && norm.binary != BinaryBase64 && norm.binary != BinaryHex {
+		return nil, fmt.Errorf("Invalid encoding of binary values: %s", norm.binary)
+	}
+
+	if zone := args.String("timezone", ""); zone != "" {
+		location, err := time.LoadLocation(zone)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid time zone '%s': %w", zone, err)
+		}
+		norm.location = location
+	}
+
+	types, err := args.Map("types")
+	if err != nil {
+		return nil, err
+	}
+	for column := range types {
+		columnType := strings.ToLower(types.String(column, ""))
+		if !isColumnType(columnType) {
+			return nil, fmt.Errorf("Invalid type of column '%s': %s", column, columnType)
+		}
+		norm.types[strings.ToLower(column)] = columnType
+	}
+	return norm, nil
+}
+
+// `isColumnType` returns true if the given name is a type of column.
+func isColumnType(name string) bool {
+	switch name {
+	case ColumnAuto, ColumnRaw, ColumnString, ColumnNumber, ColumnDecimal, ColumnInteger,
+		ColumnFloat, ColumnBoolean, ColumnTime, ColumnDate, ColumnGUID, ColumnJSON, ColumnBinary:
+		return true
+	}
+	return false
+}
+
+// `converters` returns the converter of each column of a query result
+// of the given driver, or nil for the columns whose values are kept as
+// returned by the driver.
+func (norm *normalization) converters(driver string, columnTypes []*sql.ColumnType) []columnConverter {
+	converters := make([]columnConverter, len(columnTypes))
+	for i, columnType := range columnTypes {
+		// Some drivers give the declared types, like `DECIMAL(10,2)`.
+		typeName, _, _ := strings.Cut(strings.ToUpper(columnType.DatabaseTypeName()), "(")
+		typeName = strings.TrimPrefix(strings.TrimSpace(typeName), "UNSIGNED ")
+
+		kind, ok := norm.types[strings.ToLower(columnType.Name())]
+		if !ok || kind == ColumnAuto {
+			kind = getColumnType(driver, typeName)
+		}
+		if kind == ColumnRaw {
+			continue
+		}
+		converters[i] = norm.newConverter(kind, typeName)
+	}
+	return converters
+}
+
+// `readsNumber` returns true if the values of the given column are
+// converted into numbers or text when they are numbers, by default or
+// by its configured type.
+func (norm *normalization) readsNumber(column string) bool {
+	switch norm.types[strings.ToLower(column)] {
+	case "", ColumnAuto, ColumnNumber, ColumnDecimal, ColumnString:
+		return true
+	}
+	return false
+}
+
+// `getColumnType` returns the type into which the values of a column of
+// the given database type are converted.
+func getColumnType(driver string, typeName string) string {
+	if kind, ok := driverColumnTypes[driver][typeName]; ok {
+		return kind
+	}
+	if kind, ok := columnTypes[typeName]; ok {
+		return kind
+	}
+	if driver == "mysql" {
+		// MySQL returns the values of other types, like `ENUM`, as text.
+		return ColumnString
+	}
+	return ""
+}
+
+// `newConverter` returns the converter into the given type of the values
+// of a column of the given database type.
+func (norm *normalization) newConverter(kind string, typeName string) columnConverter {
+	var convert columnConverter
+	switch kind {
+	case ColumnString:
+		convert = convertString
+	case ColumnNumber:
+		convert = convertNumber
+	case ColumnDecimal:
+		convert = convertNumber
+		if norm.decimals == ColumnString {
+			convert = convertDecimalString
+		}
+	case ColumnInteger:
+		convert = convertInteger
+	case ColumnFloat:
+		convert = convertFloat
+	case ColumnBoolean:
+		convert = convertBoolean
+	case ColumnTime:
+		convert = norm.convertTime
+	case ColumnDate:
+		convert = norm.convertDate
+	case ColumnGUID:
+		// SQL Server stores the first groups of its GUIDs little-endian.
+		convert = guidConverter(typeName == "UNIQUEIDENTIFIER")
+	case ColumnJSON:
+		convert = convertJSON
+	case ColumnBinary:
+		convert = norm.convertBinary
+	default:
+		convert = keepValue
+	}
+
+	// Times without a time zone are given in the configured one, while
+	// the ones with a time zone are converted to it.
+	zoned := strings.Contains(typeName, "TZ") || strings.Contains(typeName, "OFFSET")
+	return func(value any) (any, error) {
+		if valuer, ok := value.(driver.Valuer); ok {
+			// Like the large objects of some drivers.
+			var err error
+			if value, err = valuer.Value(); err != nil {
+				return nil, err
+			}
+		}
+		if value == nil {
+			return nil, nil
+		}
+		if timestamp, ok := value.(time.Time); ok {
+			value = norm.localize(timestamp, zoned)
+		}
+		return convert(value)
+	}
+}
+
+// `convertRow` converts the values of the given row with the converters
+// of its columns.
+func convertRow(row map[string]any, columns []string, converters []columnConverter) error {
+	for i, column := range columns {
+		if converters[i] == nil {
+			continue
+		}
+		value, err := converters[i](row[column])
+		if err != nil {
+			return fmt.Errorf("Error converting value of column '%s': %w", column, err)
+		}
+		row[column] = value
+	}
+	return nil
+}
+
+// `localize` returns the given time in the configured time zone, if any.
+func (norm *normalization) localize(timestamp time.Time, zoned bool) time.Time {
+	if norm.location == nil {
+		return timestamp
+	}
+	if zoned {
+		return timestamp.In(norm.location)
+	}
+	year, month, day := timestamp.Date()
+	hour, minute, second := timestamp.Clock()
+	return time.Date(year, month, day, hour, minute, second, timestamp.Nanosecond(), norm.location)
+}
+
+// `keepValue` keeps the given value.
+func keepValue(value any) (any, error) {
+	return value, nil
+}
+
+// `convertString` converts the given value to text.
+func convertString(value any) (any, error) {
+	switch value := value.(type) {
+	case string:
+		return value, nil
+	case []byte:
+		return string(value), nil
+	case time.Time:
+		return value.Format(time.RFC3339Nano), nil
+	case float64, float32:
+		number, err := convertNumber(value)
+		if err != nil {
+			return nil, err
+		}
+		return number.(json.Number).String(), nil
+	}
+	return fmt.Sprint(value), nil
+}
+
+// `convertNumber` converts the given value to an exact `json.Number`.
+func convertNumber(value any) (any, error) {
+	switch value := value.(type) {
+	case json.Number:
+		return value, nil
+	case []byte:
+		return parseNumber(string(value))
+	case string:
+		return parseNumber(value)
+	case bool:
+		if value {
+			return json.Number("1"), nil
+		}
+		return json.Number("0"), nil
+	case int64, int32, int16, int8, int, uint64, uint32, uint16, uint8, uint, float64, float32:
+		// Floats are written with the shortest text which reads them back.
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		return json.Number(data), nil
+	}
+	return nil, fmt.Errorf("Invalid number: %v", value)
+}
+
+// `parseNumber` returns the given text as a `json.Number`, if it's a
+// valid number.
+func parseNumber(text string) (json.Number, error) {
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, ".") {
+		text = "0" + text
+	} else if strings.HasPrefix(text, "-.") {
+		text = "-0" + text[1:]
+	}
+
+	var number any
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+	if err := decoder.Decode(&number); err != nil || decoder.More() {
+		return "", fmt.Errorf("Invalid number: %s", text)
+	}
+	if number, ok := number.(json.Number); ok {
+		return number, nil
+	}
+	return "", fmt.Errorf("Invalid number: %s", text)
+}
+
+// `convertDecimalString` converts the given value to the text of an
+// exact number.
+func convertDecimalString(value any) (any, error) {
+	number, err := convertNumber(value)
+	if err != nil {
+		return nil, err
+	}
+	return number.(json.Number).String(), nil
+}
+
+// `convertInteger` converts the given value to an integer, unsigned if
+// it doesn't fit a signed one.
+func convertInteger(value any) (any, error) {
+	switch value := value.(type) {
+	case int64, uint64:
+		return value, nil
+	case int32:
+		return int64(value), nil
+	case int16:
+		return int64(value), nil
+	case int8:
+		return int64(value), nil
+	case int:
+		return int64(value), nil
+	case uint32:
+		return int64(value), nil
+	case uint16:
+		return int64(value), nil
+	case uint8:
+		return int64(value), nil
+	case bool:
+		if value {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	case float64:
+		if value == float64(int64(value)) {
+			return int64(value), nil
+		}
+	case float32:
+		if value == float32(int64(value)) {
+			return int64(value), nil
+		}
+	case []byte:
+		return parseInteger(string(value))
+	case string:
+		return parseInteger(value)
+	case json.Number:
+		return parseInteger(value.String())
+	}
+	return nil, fmt.Errorf("Invalid integer: %v", value)
+}
+
+// `parseInteger` converts the given text to an integer, unsigned if it
+// doesn't fit a signed one.
+func parseInteger(text string) (any, error) {
+	text = strings.TrimSpace(text)
+	number, err := strconv.ParseInt(text, 10, 64)
+	if err == nil {
+		return number, nil
+	}
+	return strconv.ParseUint(text, 10, 64)
+}
+
+// `convertFloat` converts the given value to a float.
+func convertFloat(value any) (any, error) {
+	switch value := value.(type) {
+	case float64:
+		return value, nil
+	case float32:
+		// Through its text, to avoid spurious digits.
+		return strconv.ParseFloat(strconv.FormatFloat(float64(value), 'g', -1, 32), 64)
+	case []byte:
+		return strconv.ParseFloat(strings.TrimSpace(string(value)), 64)
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(value), 64)
+	case json.Number:
+		return value.Float64()
+	}
+	if number, ok := core.ToFloat(value); ok {
+		return number, nil
+	}
+	number, err := convertInteger(value)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid float: %v", value)
+	}
+	if number, ok := number.(int64); ok {
+		return float64(number), nil
+	}
+	return float64(number.(uint64)), nil
+}
+
+// `convertBoolean` converts the given value to a boolean.
+func convertBoolean(value any) (any, error) {
+	switch value := value.(type) {
+	case bool:
+		return value, nil
+	case []byte:
+		return strconv.ParseBool(strings.TrimSpace(string(value)))
+	case string:
+		return strconv.ParseBool(strings.TrimSpace(value))
+	}
+	number, err := convertFloat(value)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid boolean: %v", value)
+	}
+	return number.(float64) != 0, nil
+}
+
+// The `timeLayouts` of the times given as text.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02",
+}
+
+// `convertTime` converts the given value to a time. Times given as text
+// without a time zone are in the configured one, or else in UTC.
+func (norm *normalization) convertTime(value any) (any, error) {
+	var text string
+	switch value := value.(type) {
+	case time.Time:
+		return value, nil
+	case []byte:
+		text = strings.TrimSpace(string(value))
+	case string:
+		text = strings.TrimSpace(value)
+	default:
+		return nil, fmt.Errorf("Invalid time: %v", value)
+	}
+
+	location := norm.location
+	if location == nil {
+		location = time.UTC
+	}
+	for _, layout := range timeLayouts {
+		if timestamp, err := time.ParseInLocation(layout, text, location); err == nil {
+			if norm.location != nil {
+				timestamp = timestamp.In(norm.location)
+			}
+			return timestamp, nil
+		}
+	}
+	return nil, fmt.Errorf("Invalid time: %s", text)
+}
+
+// `convertDate` converts the given value to the text of a date.
+func (norm *normalization) convertDate(value any) (any, error) {
+	timestamp, err := norm.convertTime(value)
+	if err != nil {
+		return nil, err
+	}
+	return timestamp.(time.Time).Format(time.DateOnly), nil
+}
+
+// `guidConverter` returns a converter of GUIDs. The GUIDs of SQL Server,
+// given as bytes, have their first three groups in little-endian order,
+// and they're written in uppercase, like SQL Server does.
+func guidConverter(mixedEndian bool) columnConverter {
+	return func(value any) (any, error) {
+		var data []byte
+		switch value := value.(type) {
+		case []byte:
+			data = value
+		case [16]byte:
+			data = value[:]
+		case string:
+			return formatGUIDText(value)
+		default:
+			return nil, fmt.Errorf("Invalid GUID: %v", value)
+		}
+
+		if len(data) != 16 {
+			// GUIDs given as text.
+			return formatGUIDText(string(data))
+		}
+		guid := make([]byte, 16)
+		copy(guid, data)
+		if mixedEndian {
+			guid[0], guid[1], guid[2], guid[3] = guid[3], guid[2], guid[1], guid[0]
+			guid[4], guid[5] = guid[5], guid[4]
+			guid[6], guid[7] = guid[7], guid[6]
+		}
+
+		text := fmt.Sprintf("%x-%x-%x-%x-%x", guid[0:4], guid[4:6], guid[6:8], guid[8:10], guid[10:16])
+		if mixedEndian {
+			text = strings.ToUpper(text)
+		}
+		return text, nil
+	}
+}
+
+// `formatGUIDText` returns the given GUID text in its canonical form,
+// without braces.
+func formatGUIDText(text string) (any, error) {
+	text = strings.Trim(strings.TrimSpace(text), "{}")
+	data, err := hex.DecodeString(strings.ReplaceAll(text, "-", ""))
+	if err != nil || len(data) != 16 {
+		return nil, fmt.Errorf("Invalid GUID: %s", text)
+	}
+	if len(text) == 32 {
+		text = fmt.Sprintf("%s-%s-%s-%s-%s", text[0:8], text[8:12], text[12:16], text[16:20], text[20:32])
+	}
+	return text, nil
+}
+
+// `convertJSON` decodes the given JSON value, keeping its numbers as
+// `json.Number`.
+func convertJSON(value any) (any, error) {
+	var data []byte
+	switch value := value.(type) {
+	case []byte:
+		data = value
+	case string:
+		data = []byte(value)
+	default:
+		return value, nil
+	}
+
+	var decoded any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&decoded); err != nil {
+		return nil, err
+	}
+	return decoded, nil
+}
+
+// `convertBinary` converts the given value to bytes, or to their text
+// in the configured encoding.
+func (norm *normalization) convertBinary(value any) (any, error) {
+	var data []byte
+	switch value := value.(type) {
+	case []byte:
+		data = value
+	case string:
+		data = []byte(value)
+	default:
+		return nil, fmt.Errorf("Invalid binary value: %v", value)
+	}
+
+	switch norm.binary {
+	case BinaryBase64:
+		return base64.StdEncoding.EncodeToString(data), nil
+	case BinaryHex:
+		return hex.EncodeToString(data), nil
+	}
+	return data, nil
+}
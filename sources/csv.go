@@ -0,0 +1,472 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sources
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/ianaindex"
+
+	"github.com/tnotstar/datacat/core"
+)
+
+// `CSVFileSource` is the concrete implementation of the source interface
+// for delimited text files (CSV, TSV...). It reads the records of the
+// given file and sends each one, as a row, to the output channel.
+type CSVFileSource struct {
+	// The `id` of the source.
+	id int
+	// The `task` of the task which is running into.
+	task string
+	// The `fileName` of the file to be read.
+	fileName string
+	// The `dialect` of the file.
+	dialect csvDialect
+	// The `encoding` name of the file.
+	encoding string
+	// The number of leading lines to be skipped.
+	skipLines int
+	// `header` is true if the first record holds the column names.
+	header bool
+	// The `columns` names, overriding the header.
+	columns []string
+	// `inferTypes` converts the fields to numbers, booleans and nulls.
+	inferTypes bool
+	// The `nullValues` converted to null when inferring types.
+	nullValues map[string]bool
+	// The `compression` format of the file.
+	compression string
+}
+
+// A `csvDialect` specifies the special characters of a delimited file.
+type csvDialect struct {
+	// The `delimiter` between fields.
+	delimiter rune
+	// The `quote` around fields, or zero if fields aren't quoted.
+	quote rune
+	// The `escape` before a special character. If it's the quote, a
+	// quote is escaped by doubling it.
+	escape rune
+}
+
+// `IsaCSVFileSource` returns true if given source type is
+// a delimited text file.
+func IsaCSVFileSource(sourceType string) bool {
+	return sourceType == "csv-file-source"
+}
+
+// `NewCSVFileSource` creates a new instance of the CSV source endpoint.
+//
+// The `id` is the instance of the adapter to be created.
+// The `cfg` is the global configuration object.
+// The `taskName` is the name of the task to be executed.
+func NewCSVFileSource(id int, cfg core.Configurator, taskName string) (core.Source, error) {
+	sourceConfig, _ := cfg.GetSourceConfig(taskName)
+	args := sourceConfig.Arguments
+
+	fileName, err := args.RequiredString("filename")
+	if err != nil {
+		return nil, err
+	}
+
+	defaultDelimiter := ","
+	if strings.EqualFold(filepath.Ext(core.TrimCompressionExt(fileName)), ".tsv") {
+		defaultDelimiter = "\t"
+	}
+
+	var dialect csvDialect
+	if dialect.delimiter, err = args.Char("delimiter", defaultDelimiter); err != nil {
+		return nil, err
+	}
+	if dialect.quote, err = args.Char("quote", `"`); err != nil {
+		return nil, err
+	}
+	if dialect.escape, err = args.Char("escape", string(dialect.quote)); err != nil {
+		return nil, err
+	}
+	if dialect.delimiter == 0 || dialect.delimiter == dialect.quote || dialect.delimiter == '\n' || dialect.delimiter == '\r' {
+		return nil, fmt.Errorf("Invalid delimiter for task '%s': %q", taskName, dialect.delimiter)
+	}
+
+	encoding := args.String("encoding", "utf-8")
+	if _, err := lookupEncoding(encoding); err != nil {
+		return nil, err
+	}
+
+	skipLines, err := args.Int("skiplines", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := args.Bool("header", true)
+	if err != nil {
+		return nil, err
+	}
+
+	columns, err := args.Strings("columns")
+	if err != nil {
+		return nil, err
+	}
+	if !header && len(columns) == 0 {
+		return nil, fmt.Errorf("Missing required argument 'columns' for a file without header")
+	}
+
+	inferTypes, err := args.Bool("infertypes", false)
+	if err != nil {
+		return nil, err
+	}
+
+	nulls := []string{""}
+	if args.Has("nullvalues") {
+		if nulls, err = args.Strings("nullvalues"); err != nil {
+			return nil, err
+		}
+	}
+	nullValues := make(map[string]bool, len(nulls))
+	for _, null := range nulls {
+		nullValues[null] = true
+	}
+
+	compression, err := core.DetectCompression(fileName, args.String("compression", core.CompressionAuto))
+	if err != nil {
+		return nil, err
+	}
+
+	return &CSVFileSource{
+		id:          id,
+		task:        taskName,
+		fileName:    fileName,
+		dialect:     dialect,
+		encoding:    encoding,
+		skipLines:   skipLines,
+		header:      header,
+		columns:     columns,
+		inferTypes:  inferTypes,
+		nullValues:  nullValues,
+		compression: compression,
+	}, nil
+}
+
+// `Run` creates a goroutine that reads the records of the file and sends
+// them to an output channel. It returns a channel that will receive the
+// rows read from the file.
+func (src *CSVFileSource) Run(ctx context.Context, wg *sync.WaitGroup, trk *core.Tracker) <-chan core.RowMap {
+	log.Printf("Starting CSV source for task %s...", src.task)
+	out := make(chan core.RowMap)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(out)
+
+		log.Printf("Reading input file: %s\n", src.fileName)
+		file, err := os.Open(src.fileName)
+		if err != nil {
+			trk.Abort("source", fmt.Errorf("Error opening file %s: %w", src.fileName, err))
+			return
+		}
+		defer file.Close()
+
+		decompressor, err := core.NewDecompressor(file, src.compression)
+		if err != nil {
+			trk.Abort("source", fmt.Errorf("Error opening file %s: %w", src.fileName, err))
+			return
+		}
+		defer decompressor.Close()
+
+		encoding, _ := lookupEncoding(src.encoding)
+		reader := newCSVReader(encoding.NewDecoder().Reader(decompressor), src.dialect)
+		if err := reader.skipLines(src.skipLines); err != nil {
+			trk.Abort("source", fmt.Errorf("Error reading file %s: %w", src.fileName, err))
+			return
+		}
+
+		columns := src.columns
+		if src.header {
+			names, err := reader.read()
+			if err != nil && !errors.Is(err, io.EOF) {
+				trk.Abort("source", fmt.Errorf("Error reading header of file %s: %w", src.fileName, err))
+				return
+			}
+			if len(columns) == 0 {
+				columns = names
+			}
+		}
+		if err := checkColumns(columns); err != nil {
+			trk.Abort("source", fmt.Errorf("Invalid columns of file %s: %w", src.fileName, err))
+			return
+		}
+
+		counter := 0
+		log.Println("Reading data from the input file")
+		for {
+			line := reader.line + 1
+			fields, err := reader.read()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				trk.Abort("source", fmt.Errorf("Error reading file %s at line %d: %w", src.fileName, line, err))
+				return
+			}
+
+			row := make(core.RowMap, len(columns))
+			for i, field := range fields {
+				if i < len(columns) {
+					row[columns[i]] = src.value(field)
+				}
+			}
+
+			if !trk.Read(row) {
+				continue
+			}
+			if len(fields) != len(columns) {
+				trk.Fail("source", row, fmt.Errorf("Found %d field(s) instead of %d at line %d", len(fields), len(columns), line))
+				continue
+			}
+			if !core.Send(ctx, out, row) {
+				break
+			}
+			counter += 1
+		}
+
+		log.Printf("Read %d row(s) from the input file", counter)
+	}()
+
+	log.Println("CSV source for task:", src.task, ", started")
+	return out
+}
+
+// `value` returns the value of a field, converted to a number, boolean
+// or null if types are inferred.
+func (src *CSVFileSource) value(field string) any {
+	if !src.inferTypes {
+		return field
+	}
+	if src.nullValues[field] {
+		return nil
+	}
+	return inferValue(field)
+}
+
+// `inferValue` converts the given text to an integer, float or boolean
+// value, if it looks like one. Numbers with leading zeros are kept as
+// text, since they're usually codes.
+func inferValue(text string) any {
+	switch strings.ToLower(text) {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+
+	digits := strings.TrimPrefix(text, "-")
+	if digits == "" || digits[0] < '0' || digits[0] > '9' {
+		return text
+	}
+	if len(digits) > 1 && digits[0] == '0' && digits[1] != '.' {
+		return text
+	}
+
+	if number, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return number
+	}
+	if number, err := strconv.ParseFloat(text, 64); err == nil && !strings.ContainsAny(text, "xXpP_") {
+		return number
+	}
+	return text
+}
+
+// `checkColumns` verifies that the column names are present and unique.
+func checkColumns(columns []string) error {
+	if len(columns) == 0 {
+		return errors.New("no columns found")
+	}
+
+	seen := make(map[string]bool, len(columns))
+	for i, column := range columns {
+		if column == "" {
+			return fmt.Errorf("column #%d has no name", i+1)
+		}
+		if seen[column] {
+			return fmt.Errorf("duplicate column name '%s'", column)
+		}
+		seen[column] = true
+	}
+	return nil
+}
+
+// `encodingAliases` are common names of encodings missing from the IANA index.
+var encodingAliases = map[string]string{
+	"utf8":   "utf-8",
+	"cp1252": "windows-1252",
+}
+
+// `lookupEncoding` returns the text encoding with given name.
+func lookupEncoding(name string) (encoding.Encoding, error) {
+	if alias, ok := encodingAliases[strings.ToLower(name)]; ok {
+		name = alias
+	}
+
+	enc, err := ianaindex.IANA.Encoding(name)
+	if err != nil || enc == nil {
+		return nil, fmt.Errorf("Unsupported encoding: %s", name)
+	}
+	return enc, nil
+}
+
+// A `csvReader` reads the records of a delimited text file.
+type csvReader struct {
+	reader  *bufio.Reader
+	dialect csvDialect
+	// The `line` number of the last line read.
+	line int
+}
+
+// `newCSVReader` creates a new reader of records in the given dialect.
+// A leading byte order mark, written by tools like Excel, is skipped.
+func newCSVReader(reader io.Reader, dialect csvDialect) *csvReader {
+	rd := &csvReader{
+		reader:  bufio.NewReader(reader),
+		dialect: dialect,
+	}
+	if r, _, err := rd.reader.ReadRune(); err == nil && r != '\ufeff' {
+		rd.reader.UnreadRune()
+	}
+	return rd
+}
+
+// `skipLines` skips the given number of lines, as they are.
+func (rd *csvReader) skipLines(count int) error {
+	for ; count > 0; count-- {
+		if _, err := rd.reader.ReadString('\n'); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		rd.line++
+	}
+	return nil
+}
+
+// `read` returns the fields of the next record, skipping blank lines.
+// It returns `io.EOF` at the end of the file.
+func (rd *csvReader) read() ([]string, error) {
+	for {
+		fields, blank, err := rd.readRecord()
+		if err != nil || !blank {
+			return fields, err
+		}
+	}
+}
+
+// `readRecord` returns the fields of the next record, and true if it was
+// a blank line.
+func (rd *csvReader) readRecord() ([]string, bool, error) {
+	var fields []string
+	var field strings.Builder
+	quoted, wasQuoted, empty := false, false, true
+
+	for {
+		char, _, err := rd.reader.ReadRune()
+		if errors.Is(err, io.EOF) {
+			if quoted {
+				return nil, false, errors.New("unterminated quoted field")
+			}
+			if empty {
+				return nil, false, io.EOF
+			}
+			rd.line++
+			return append(fields, field.String()), false, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		empty = false
+
+		if quoted {
+			switch {
+			case char == rd.dialect.escape && rd.dialect.escape != 0 && rd.dialect.escape != rd.dialect.quote:
+				next, _, err := rd.reader.ReadRune()
+				if err != nil {
+					return nil, false, errors.New("unterminated quoted field")
+				}
+				field.WriteRune(next)
+			case char == rd.dialect.quote:
+				if rd.dialect.escape == rd.dialect.quote && rd.peek() == rd.dialect.quote {
+					rd.reader.ReadRune()
+					field.WriteRune(char)
+				} else {
+					quoted = false
+				}
+			default:
+				if char == '\n' {
+					rd.line++
+				}
+				field.WriteRune(char)
+			}
+			continue
+		}
+
+		switch {
+		case char == rd.dialect.quote && rd.dialect.quote != 0 && field.Len() == 0 && !wasQuoted:
+			quoted, wasQuoted = true, true
+		case char == rd.dialect.escape && rd.dialect.escape != 0 && rd.dialect.escape != rd.dialect.quote:
+			next, _, err := rd.reader.ReadRune()
+			if err == nil {
+				field.WriteRune(next)
+			}
+		case char == rd.dialect.delimiter:
+			fields = append(fields, field.String())
+			field.Reset()
+			wasQuoted = false
+		case char == '\r' && rd.peek() == '\n':
+		case char == '\n':
+			rd.line++
+			blank := len(fields) == 0 && field.Len() == 0 && !wasQuoted
+			return append(fields, field.String()), blank, nil
+		default:
+			field.WriteRune(char)
+		}
+	}
+}
+
+// `peek` returns the next character without reading it, or zero.
+func (rd *csvReader) peek() rune {
+	char, _, err := rd.reader.ReadRune()
+	if err != nil {
+		return 0
+	}
+	rd.reader.UnreadRune()
+	return char
+}
@@ -0,0 +1,48 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sources
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCSVReaderSkipsByteOrderMark(t *testing.T) {
+	dialect := csvDialect{delimiter: ',', quote: '"', escape: '"'}
+	for _, input := range []string{"\ufeffname,age\nann,30\n", "name,age\nann,30\n"} {
+		reader := newCSVReader(strings.NewReader(input), dialect)
+		header, err := reader.read()
+		if err != nil {
+			t.Fatalf("read(%q) failed: %v", input, err)
+		}
+		if want := []string{"name", "age"}; !reflect.DeepEqual(header, want) {
+			t.Errorf("read(%q) = %q, want %q", input, header, want)
+		}
+	}
+}
+
+func TestCSVReaderEmptyInput(t *testing.T) {
+	reader := newCSVReader(strings.NewReader(""), csvDialect{delimiter: ','})
+	if _, err := reader.read(); err == nil {
+		t.Error("read of an empty input didn't fail")
+	}
+}
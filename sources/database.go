@@ -21,17 +21,25 @@
 package sources
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
-	"net"
-	"net/url"
-	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/tnotstar/datacat/core"
 
 	_ "github.com/denisenkom/go-mssqldb"
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "github.com/mattn/go-sqlite3"
 	_ "github.com/sijms/go-ora/v2"
 )
 
@@ -47,12 +55,41 @@ type DatabaseQuerySource struct {
 	database string
 	// `driver` is the name of the database driver to be used.
 	driver string
-	// `uri` is a string containing the connection URI.
-	uri string
+	// `config` is the configuration of the database connection.
+	config *core.DatabaseConfig
 	// `query` is a string containing the query to be executed.
 	query string
+	// `parameters` are the names of the query parameters, in order.
+	parameters []string
+	// `defaults` are the configured values of the query parameters.
+	defaults core.Arguments
+	// `values` are the resolved values of the query parameters.
+	values map[string]any
+	// `resumeKey` is the column to order and restrict the rows by.
+	resumeKey string
+	// `resumeValue` is the key value of the last row already processed.
+	resumeValue any
+	// `watermark` is the column whose highest value is recorded.
+	watermark string
+	// `watermarkValue` is the highest value recorded by the last run.
+	watermarkValue any
+	// `watermarkMax` is the highest value read by the current run.
+	watermarkMax any
+	// `partition` is the partitioning shared by the source instances,
+	// or nil if the source isn't partitioned.
+	partition *partitioning
+	// `normalization` converts the values of the columns.
+	normalization *normalization
 }
 
+// `sourceAlias` is the alias of the configured query when it's nested
+// into another one.
+const sourceAlias = "datacat_source"
+
+// `numbersAlias` is the alias of the query of an Oracle database when
+// it's nested to read its numbers as text.
+const numbersAlias = "datacat_numbers"
+
 // `IsaDatabaseQuerySource` returns true if given source type is
 // an Database Query.
 func IsaDatabaseQuerySource(sourceType string) bool {
@@ -64,92 +101,442 @@ func IsaDatabaseQuerySource(sourceType string) bool {
 // The `id` is the instance of the adapter to be created.
 // The `cfg` is the global configuration object.
 // The `taskName` is the name of the task to be executed.
-func NewDatabaseQuerySource(id int, cfg core.Configurator, taskName string) core.Source {
+func NewDatabaseQuerySource(id int, cfg core.Configurator, taskName string) (core.Source, error) {
 	sourceConfig, _ := cfg.GetSourceConfig(taskName)
 
-	dbName := sourceConfig.Arguments["database"].(string)
+	dbName, err := sourceConfig.Arguments.RequiredString("database")
+	if err != nil {
+		return nil, err
+	}
+
 	dbConfig, err := cfg.GetDatabaseConfig(dbName)
 	if err != nil {
-		log.Fatalf("Can't get configuration of database '%s' for task '%s': %s", dbName, taskName, err)
+		return nil, fmt.Errorf("Can't get configuration of database '%s' for task '%s': %w", dbName, taskName, err)
+	}
+
+	query, err := sourceConfig.Arguments.RequiredString("query")
+	if err != nil {
+		return nil, err
 	}
 
-	hostname := dbConfig.Host
-	if dbConfig.Port > 0 {
-		hostname = net.JoinHostPort(hostname, strconv.Itoa(dbConfig.Port))
+	query, parameters := compileParameters(query)
+	defaults, err := sourceConfig.Arguments.Map("parameters")
+	if err != nil {
+		return nil, err
 	}
 
-	uri := &url.URL{
-		Scheme: dbConfig.Scheme,
-		User:   url.UserPassword(dbConfig.Username, dbConfig.Password),
-		Host:   hostname,
+	partition, err := getPartitioning(sourceConfig.Arguments, taskName)
+	if err != nil {
+		return nil, err
+	}
+	if partition == nil && id > 0 || partition != nil && id >= partition.count {
+		return nil, fmt.Errorf("Invalid instance #%d of database query source for task '%s'", id, taskName)
 	}
 
-	if dbConfig.Service != "" {
-		uri.Path = url.PathEscape(dbConfig.Service)
+	normalization, err := getNormalization(sourceConfig.Arguments)
+	if err != nil {
+		return nil, err
 	}
 
-	params := dbConfig.Parameters
-	if len(params) > 0 {
-		query := uri.Query()
-		for key, value := range params {
-			query.Add(strings.TrimSpace(key), strings.TrimSpace(value))
+	watermark := sourceConfig.Arguments.String("watermark", "")
+	var watermarkValue any
+	if watermark != "" {
+		if !isIdentifier(watermark) {
+			return nil, fmt.Errorf("Invalid watermark column name: %s", watermark)
+		}
+
+		state, err := core.OpenStateStore(cfg, taskName).Load()
+		if err != nil {
+			return nil, err
+		}
+		if state.Watermark != nil && state.Watermark.Column == watermark {
+			watermarkValue = bindValue(state.Watermark.Value)
 		}
-		uri.RawQuery = query.Encode()
 	}
 
 	return &DatabaseQuerySource{
-		id:       id,
-		task:     taskName,
-		database: dbName,
-		driver:   dbConfig.Driver,
-		uri:      uri.String(),
-		query:    sourceConfig.Arguments["query"].(string),
-	}
+		id:             id,
+		task:           taskName,
+		database:       dbName,
+		driver:         dbConfig.Driver,
+		config:         dbConfig,
+		query:          query,
+		parameters:     parameters,
+		defaults:       defaults,
+		watermark:      watermark,
+		watermarkValue: watermarkValue,
+		partition:      partition,
+		normalization:  normalization,
+	}, nil
 }
 
 // `Run` creates a goroutine that reads data from the database and sends
 // it to an output channel. It returns a channel that will receive the
 // data read from the database.
-func (src *DatabaseQuerySource) Run(wg *sync.WaitGroup) <-chan core.RowMap {
+func (src *DatabaseQuerySource) Run(ctx context.Context, wg *sync.WaitGroup, trk *core.Tracker) <-chan core.RowMap {
 	log.Printf("* Creating instance #%d of database query source for task %s...", src.id, src.task)
 	out := make(chan core.RowMap)
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
+		defer close(out)
 
 		log.Printf(" - Opening a connection to the database: '%s'...", src.database)
-		db, err := sqlx.Open(src.driver, src.uri)
+		db, err := core.OpenDatabase(ctx, src.config)
 		if err != nil {
-			log.Fatal("Error opening connection to database: ", err)
+			if ctx.Err() == nil {
+				trk.Abort("source", fmt.Errorf("Error opening connection to database: %w", err))
+			}
+			return
 		}
 		defer db.Close()
 
-		log.Printf(" - Executing the database query: '%s'...", strings.TrimSpace(src.query[:24]))
-		rows, err := db.Queryx(src.query)
+		if src.values == nil {
+			if err := src.SetParameters(nil); err != nil {
+				trk.Abort("source", err)
+				return
+			}
+		}
+
+		var rng partitionRange
+		if src.partition != nil {
+			var ok bool
+			planCtx, cancel := src.config.WithQueryTimeout(ctx)
+			rng, ok, err = src.partition.plan(planCtx, db, trk, src, src.id)
+			cancel()
+			if err != nil {
+				if ctx.Err() == nil {
+					trk.Abort("source", err)
+				}
+				return
+			}
+			if !ok {
+				log.Printf(" - Partition #%d has no rows to read", src.id)
+				return
+			}
+		}
+
+		query, args := src.buildQuery(db, rng)
+		var described []*sql.ColumnType
+		if src.driver == "oracle" {
+			describeCtx, cancel := src.config.WithQueryTimeout(ctx)
+			query, described, err = src.exactNumbers(describeCtx, db, query, args)
+			cancel()
+			if err != nil {
+				if ctx.Err() == nil {
+					trk.Abort("source", err)
+				}
+				return
+			}
+		}
+		log.Printf(" - Executing the database query: '%s'...", abbreviate(query, 24))
+		queryCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		timer := startQueryTimer(src.config.QueryTimeout, cancel)
+		rows, err := db.QueryxContext(queryCtx, query, args...)
 		if err != nil {
-			log.Fatal("Error trying to execute a query: ", err)
+			if ctx.Err() == nil {
+				trk.Abort("source", fmt.Errorf("Error trying to execute a query: %w", timer.check(err)))
+			}
+			return
 		}
 		defer rows.Close()
 
 		log.Printf(" - Fetching rows from the database: '%s'...", src.database)
 		columns, _ := rows.Columns()
+		columnTypes, err := rows.ColumnTypes()
+		if err != nil {
+			trk.Abort("source", fmt.Errorf("Error getting column types: %w", err))
+			return
+		}
+		if described != nil {
+			// The numbers read as text are converted by their own types.
+			columnTypes = described
+		}
+		converters := src.normalization.converters(src.driver, columnTypes)
 		length := len(columns)
 		counter := 0
 		for rows.Next() {
+			timer.stop()
 			row := make(core.RowMap, length)
 			if err := rows.MapScan(row); err != nil {
-				log.Fatal("Failed to scan map from current row: ", err)
+				trk.Abort("source", fmt.Errorf("Failed to scan map from current row: %w", err))
+				return
 			}
 
+			if !trk.Read(row) {
+				continue
+			}
+			if err := convertRow(row, columns, converters); err != nil {
+				trk.Fail("source", row, err)
+				continue
+			}
+			if src.watermark != "" {
+				src.observe(row)
+			}
+			if src.partition != nil {
+				row[PartitionField] = src.id
+			}
+			if !core.Send(ctx, out, row) {
+				break
+			}
 			counter++
-			out <- row
 		}
 
-		close(out)
+		if err := rows.Err(); err != nil && ctx.Err() == nil {
+			trk.Abort("source", fmt.Errorf("Error fetching rows from the database: %w", timer.check(err)))
+		}
+
 		log.Printf(" - Closing output channel after processed %d rows", counter)
 	}()
 
 	log.Printf("* DatabaseQuery source on database '%s' started successfully!", src.database)
 	return out
 }
+
+// `ResumeAfter` implements the `core.Resumable` interface.
+func (src *DatabaseQuerySource) ResumeAfter(key string, value any) error {
+	if !isIdentifier(key) {
+		return fmt.Errorf("Invalid key column name: %s", key)
+	}
+	if src.partition != nil {
+		return errors.New("Can't resume a partitioned source")
+	}
+
+	src.resumeKey = key
+	src.resumeValue = bindValue(value)
+	return nil
+}
+
+// `SetParameters` implements the `core.Parameterized` interface.
+func (src *DatabaseQuerySource) SetParameters(overrides map[string]string) error {
+	values, err := resolveParameters(src.parameters, src.defaults, overrides)
+	if err != nil {
+		return err
+	}
+
+	src.values = values
+	return nil
+}
+
+// `Watermark` implements the `core.Watermarker` interface.
+func (src *DatabaseQuerySource) Watermark() (string, any) {
+	return src.watermark, src.watermarkMax
+}
+
+// `observe` records the watermark column value of the given row.
+func (src *DatabaseQuerySource) observe(row core.RowMap) {
+	value := row[src.watermark]
+	if bytes, ok := value.([]byte); ok {
+		value = string(bytes)
+	}
+	if value == nil {
+		return
+	}
+	if src.watermarkMax == nil || core.CompareValues(value, src.watermarkMax) > 0 {
+		src.watermarkMax = value
+	}
+}
+
+// `buildQuery` returns the query to execute and its arguments. The
+// configured query is wrapped to keep only the rows of the given
+// partition range, the rows beyond the stored watermark and, when a
+// resume key is set, to order its rows by the key and to skip the rows
+// already processed.
+func (src *DatabaseQuerySource) buildQuery(db *sqlx.DB, rng partitionRange) (string, []any) {
+	conditions, args := src.conditions()
+	if src.partition != nil {
+		rangeConditions, rangeArgs := rng.conditions(src.partition.column)
+		conditions = append(conditions, rangeConditions...)
+		args = append(args, rangeArgs...)
+	}
+
+	if len(conditions) == 0 && src.resumeKey == "" {
+		if len(args) == 0 {
+			return src.query, nil
+		}
+		return rebindQuery(db, src.query), args
+	}
+
+	query := fmt.Sprintf("SELECT * FROM (%s) %s", trimQuery(src.query), sourceAlias)
+	if len(conditions) > 0 {
+		query += " WHERE " + joinConditions(conditions)
+	}
+	if src.resumeKey != "" {
+		query += fmt.Sprintf(" ORDER BY %s.%s", sourceAlias, src.resumeKey)
+	}
+
+	return rebindQuery(db, query), args
+}
+
+// `exactNumbers` returns the given query of an Oracle database with its
+// `NUMBER` columns read as text, since the driver reads the numbers with
+// decimals as floats, and the types of the columns of the given query.
+// The query is returned as is if it has no such column.
+func (src *DatabaseQuerySource) exactNumbers(ctx context.Context, db *sqlx.DB, query string, args []any) (string, []*sql.ColumnType, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT * FROM (%s) WHERE 1 = 0", query), args...)
+	if err != nil {
+		return "", nil, fmt.Errorf("Error describing the columns of the query: %w", err)
+	}
+	defer rows.Close()
+
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return "", nil, fmt.Errorf("Error getting column types: %w", err)
+	}
+
+	names := make([]string, len(columnTypes))
+	numbers := make([]bool, len(columnTypes))
+	for i, columnType := range columnTypes {
+		names[i] = columnType.Name()
+		numbers[i] = strings.EqualFold(columnType.DatabaseTypeName(), "NUMBER") && src.normalization.readsNumber(names[i])
+	}
+
+	exact, ok := textNumbersQuery(query, names, numbers, src.resumeKey)
+	if !ok {
+		return query, nil, nil
+	}
+	return exact, columnTypes, nil
+}
+
+// `textNumbersQuery` returns the given Oracle query with the columns of
+// the given names, which are flagged as `numbers`, read as text with all
+// their digits. The query is ordered again by the `order` column, if
+// any. It returns false if there is no number to read.
+func textNumbersQuery(query string, names []string, numbers []bool, order string) (string, bool) {
+	exact := false
+	columns := make([]string, len(names))
+	for i, name := range names {
+		quoted := `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+		columns[i] = numbersAlias + "." + quoted
+		if numbers[i] {
+			columns[i] = fmt.Sprintf("TO_CHAR(%s, 'TM9', 'NLS_NUMERIC_CHARACTERS=''.,''') AS %s", columns[i], quoted)
+			exact = true
+		}
+	}
+	if !exact {
+		return query, false
+	}
+
+	exactQuery := fmt.Sprintf("SELECT %s FROM (%s) %s", strings.Join(columns, ", "), query, numbersAlias)
+	if order != "" {
+		exactQuery += fmt.Sprintf(" ORDER BY %s.%s", numbersAlias, order)
+	}
+	return exactQuery, true
+}
+
+// `conditions` returns the conditions on the rows of the configured
+// query, and the arguments of the query, starting with the values of
+// the query parameters.
+func (src *DatabaseQuerySource) conditions() ([]string, []any) {
+	var conditions []string
+	args := make([]any, len(src.parameters))
+	for i, name := range src.parameters {
+		args[i] = src.values[name]
+	}
+
+	if src.watermarkValue != nil {
+		conditions = append(conditions, fmt.Sprintf("%s.%s > ?", sourceAlias, src.watermark))
+		args = append(args, src.watermarkValue)
+	}
+
+	if src.resumeValue != nil {
+		conditions = append(conditions, fmt.Sprintf("%s.%s > ?", sourceAlias, src.resumeKey))
+		args = append(args, src.resumeValue)
+	}
+
+	return conditions, args
+}
+
+// `joinConditions` joins the given conditions of a `WHERE` clause.
+func joinConditions(conditions []string) string {
+	return strings.Join(conditions, " AND ")
+}
+
+// `trimQuery` removes the surrounding spaces and the trailing semicolon
+// of a query, so it can be nested into another one.
+func trimQuery(query string) string {
+	return strings.TrimRight(strings.TrimSpace(query), "; \t\r\n")
+}
+
+// `isIdentifier` returns true if the given name is a plain column name,
+// safe to be written into a query.
+func isIdentifier(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, char := range name {
+		if char != '_' && !unicode.IsLetter(char) && (i == 0 || !unicode.IsDigit(char)) {
+			return false
+		}
+	}
+	return true
+}
+
+// `bindValue` converts a value restored from a state file to the type
+// expected by the database driver.
+func bindValue(value any) any {
+	switch value := value.(type) {
+	case json.Number:
+		if number, err := value.Int64(); err == nil {
+			return number
+		}
+		if number, err := value.Float64(); err == nil {
+			return number
+		}
+	case string:
+		if timestamp, err := time.Parse(time.RFC3339Nano, value); err == nil {
+			return timestamp
+		}
+
+	}
+	return value
+}
+
+// `abbreviate` returns the first `length` characters of the trimmed text.
+func abbreviate(text string, length int) string {
+	text = strings.TrimSpace(text)
+	if len(text) > length {
+		return text[:length]
+	}
+	return text
+}
+
+// A `queryTimer` cancels a query which doesn't return its first row
+// before the query timeout. The timeout doesn't apply to the fetching
+// of the following rows.
+type queryTimer struct {
+	timeout time.Duration
+	timer   *time.Timer
+	expired atomic.Bool
+}
+
+// `startQueryTimer` starts a timer which calls the given cancel function
+// after the timeout, if it's positive.
+func startQueryTimer(timeout time.Duration, cancel context.CancelFunc) *queryTimer {
+	qt := &queryTimer{timeout: timeout}
+	if timeout > 0 {
+		qt.timer = time.AfterFunc(timeout, func() {
+			qt.expired.Store(true)
+			cancel()
+		})
+	}
+	return qt
+}
+
+// `stop` stops the timer, once the query has returned a row.
+func (qt *queryTimer) stop() {
+	if qt.timer != nil {
+		qt.timer.Stop()
+	}
+}
+
+// `check` returns the timeout error instead of the given one if the
+// timer has expired.
+func (qt *queryTimer) check(err error) error {
+	if qt.expired.Load() {
+		return fmt.Errorf("Query timed out after %s", qt.timeout)
+	}
+	return err
+}
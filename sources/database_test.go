@@ -0,0 +1,55 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sources
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestTextNumbersQuery(t *testing.T) {
+	query, ok := textNumbersQuery("SELECT ID, NAME, AMOUNT FROM ORDERS",
+		[]string{"ID", "NAME", "AMOUNT"}, []bool{true, false, true}, "ID")
+	want := `SELECT TO_CHAR(datacat_numbers."ID", 'TM9', 'NLS_NUMERIC_CHARACTERS=''.,''') AS "ID", ` +
+		`datacat_numbers."NAME", ` +
+		`TO_CHAR(datacat_numbers."AMOUNT", 'TM9', 'NLS_NUMERIC_CHARACTERS=''.,''') AS "AMOUNT" ` +
+		`FROM (SELECT ID, NAME, AMOUNT FROM ORDERS) datacat_numbers ORDER BY datacat_numbers.ID`
+	if !ok || query != want {
+		t.Errorf("textNumbersQuery() = %q, %v\nwant %q", query, ok, want)
+	}
+
+	if query, ok := textNumbersQuery("SELECT NAME FROM ORDERS", []string{"NAME"}, []bool{false}, ""); ok || query != "SELECT NAME FROM ORDERS" {
+		t.Errorf("textNumbersQuery() without numbers = %q, %v", query, ok)
+	}
+}
+
+func TestConvertNumberKeepsDigitsOfText(t *testing.T) {
+	for text, want := range map[string]json.Number{
+		"12345678901234567890.123456789": "12345678901234567890.123456789",
+		"-.5":                            "-0.5",
+		"1E+100":                         "1E+100",
+	} {
+		got, err := convertNumber(text)
+		if err != nil || got != want {
+			t.Errorf("convertNumber(%q) = %v, %v, want %v", text, got, err, want)
+		}
+	}
+}
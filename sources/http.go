@@ -0,0 +1,442 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sources
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tnotstar/datacat/core"
+	"github.com/tnotstar/datacat/services"
+)
+
+// The pagination strategies of the HTTP request source.
+const (
+	PaginationNone   = "none"
+	PaginationPage   = "page"
+	PaginationOffset = "offset"
+	PaginationCursor = "cursor"
+	PaginationLink   = "link"
+)
+
+// `HttpRequestSource` is the concrete implementation of the source
+// interface for HTTP microservices endpoints. It requests the pages of
+// a given endpoint and sends each record of their responses to the
+// output processing channel.
+type HttpRequestSource struct {
+	// The `id` of the source.
+	id int
+	// The `task` of the task which is running into.
+	task string
+	// The `route` of the requests.
+	route *services.Route
+	// The `body` of the requests, if any.
+	body []byte
+	// The `endpoint` of the service to send the requests to.
+	endpoint *services.Endpoint
+	// The `recordsPath` is the dotted path of the array of records in
+	// the responses, or `.` for the response itself.
+	recordsPath string
+	// The `pagination` of the requests.
+	pagination pagination
+	// The `interval` is the minimum time between two requests.
+	interval time.Duration
+}
+
+// The `pagination` settings of the HTTP request source.
+type pagination struct {
+	// The `kind` of pagination, one of the `Pagination*` constants.
+	kind string
+	// The `param` is the query parameter of the page number, offset or
+	// cursor.
+	param string
+	// The `sizeParam` is the query parameter of the page size.
+	sizeParam string
+	// The `start` is the number of the first page.
+	start int
+	// The `size` is the page size.
+	size int
+	// The `cursorPath` is the dotted path of the next cursor in the
+	// responses.
+	cursorPath string
+	// The `maxPages` is the maximum number of pages, or 0 for all.
+	maxPages int
+}
+
+// `IsaHttpRequestSource` returns true if given source type is
+// a HTTP endpoint.
+func IsaHttpRequestSource(sourceType string) bool {
+	return sourceType == "http-request-source"
+}
+
+// `NewHttpRequestSource` creates a new instance of the HTTP request source endpoint.
+//
+// The `id` is the instance of the source to be created.
+// The `cfg` is the global configuration object.
+// The `taskName` is the name of the task to be executed.
+func NewHttpRequestSource(id int, cfg core.Configurator, taskName string) (core.Source, error) {
+	sourceConfig, _ := cfg.GetSourceConfig(taskName)
+
+	endpoint, err := services.NewEndpoint(cfg, taskName, sourceConfig.Arguments)
+	if err != nil {
+		return nil, err
+	}
+
+	// There are no rows to fill the request templates in with.
+	request, err := services.NewRequestTemplate(endpoint.BaseURL(), sourceConfig.Arguments, http.MethodGet)
+	if err != nil {
+		return nil, err
+	}
+	route, err := request.Route(nil)
+	if err != nil {
+		return nil, err
+	}
+	var body []byte
+	if sourceConfig.Arguments.Has("body") {
+		if body, err = request.Body(nil); err != nil {
+			return nil, err
+		}
+	}
+
+	query, err := sourceConfig.Arguments.Map("query")
+	if err != nil {
+		return nil, err
+	}
+	if len(query) > 0 {
+		values := make(url.Values)
+		for key, value := range query {
+			values.Set(key, fmt.Sprint(value))
+		}
+		if route.URL, err = setQuery(route.URL, values); err != nil {
+			return nil, err
+		}
+	}
+
+	paging, err := getPagination(sourceConfig.Arguments)
+	if err != nil {
+		return nil, err
+	}
+
+	rateLimit, err := sourceConfig.Arguments.Float("ratelimit", 0)
+	if err != nil {
+		return nil, err
+	}
+	var interval time.Duration
+	if rateLimit > 0 {
+		interval = time.Duration(float64(time.Second) / rateLimit)
+	}
+
+	return &HttpRequestSource{
+		id:          id,
+		task:        taskName,
+		route:       route,
+		body:        body,
+		endpoint:    endpoint,
+		recordsPath: sourceConfig.Arguments.String("recordspath", "."),
+		pagination:  paging,
+		interval:    interval,
+	}, nil
+}
+
+// `getPagination` returns the pagination settings of the `pagination`
+// argument.
+func getPagination(args core.Arguments) (pagination, error) {
+	settings, err := args.Map("pagination")
+	if err != nil {
+		return pagination{}, err
+	}
+
+	paging := pagination{
+		kind:       settings.String("type", PaginationNone),
+		sizeParam:  settings.String("sizeparam", ""),
+		cursorPath: settings.String("cursorpath", ""),
+	}
+	if paging.start, err = settings.Int("start", 1); err != nil {
+		return paging, err
+	}
+	if paging.size, err = settings.Int("size", 0); err != nil {
+		return paging, err
+	}
+	if paging.maxPages, err = settings.Int("maxpages", 0); err != nil {
+		return paging, err
+	}
+
+	switch paging.kind {
+	case PaginationNone, PaginationLink:
+	case PaginationPage:
+		paging.param = settings.String("param", "page")
+	case PaginationOffset:
+		paging.param = settings.String("param", "offset")
+		paging.sizeParam = settings.String("sizeparam", "limit")
+		if paging.size < 1 {
+			return paging, fmt.Errorf("Argument 'size' is required by the offset pagination")
+		}
+	case PaginationCursor:
+		paging.param = settings.String("param", "cursor")
+		if paging.cursorPath == "" {
+			return paging, fmt.Errorf("Argument 'cursorpath' is required by the cursor pagination")
+		}
+	default:
+		return paging, fmt.Errorf("Invalid pagination type: %s", paging.kind)
+	}
+
+	return paging, nil
+}
+
+// `Run` creates a goroutine that requests the pages of the endpoint and
+// sends their records to an output channel. It returns a channel that
+// will receive the records.
+func (src *HttpRequestSource) Run(ctx context.Context, wg *sync.WaitGroup, trk *core.Tracker) <-chan core.RowMap {
+	log.Printf("Starting HTTP request source for task %s...", src.task)
+	out := make(chan core.RowMap)
+	src.endpoint.Share(trk)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(out)
+
+		pageURL, err := src.firstPage()
+		if err != nil {
+			trk.Abort("source", err)
+			return
+		}
+
+		counter, pages := 0, 0
+		var last time.Time
+		for pageURL != "" {
+			if src.pagination.maxPages > 0 && pages >= src.pagination.maxPages {
+				break
+			}
+			if wait := time.Until(last.Add(src.interval)); wait > 0 {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(wait):
+				}
+			}
+			last = time.Now()
+
+			records, next, err := src.fetch(ctx, pageURL)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				trk.Abort("source", fmt.Errorf("Error requesting page %s: %w", pageURL, err))
+				return
+			}
+			pages += 1
+
+			for _, record := range records {
+				if !trk.Read(record) {
+					continue
+				}
+				if !core.Send(ctx, out, record) {
+					return
+				}
+				counter += 1
+			}
+			pageURL = next
+		}
+
+		log.Printf("Read %d record(s) from %d page(s) of the service", counter, pages)
+	}()
+
+	log.Println("HTTP request source for task:", src.task, ", started")
+	return out
+}
+
+// `firstPage` returns the URL of the first page.
+func (src *HttpRequestSource) firstPage() (string, error) {
+	values := make(url.Values)
+	switch src.pagination.kind {
+	case PaginationPage:
+		values.Set(src.pagination.param, strconv.Itoa(src.pagination.start))
+	case PaginationOffset:
+		values.Set(src.pagination.param, "0")
+	}
+	if src.pagination.sizeParam != "" && src.pagination.size > 0 {
+		values.Set(src.pagination.sizeParam, strconv.Itoa(src.pagination.size))
+	}
+	return setQuery(src.route.URL, values)
+}
+
+// `fetch` requests the page with the given URL. It returns its records
+// and the URL of the next page, or an empty URL after the last page.
+func (src *HttpRequestSource) fetch(ctx context.Context, pageURL string) ([]core.RowMap, string, error) {
+	route := &services.Route{Method: src.route.Method, URL: pageURL, Header: src.route.Header}
+	res, err := src.endpoint.Exchange(ctx, route, src.body)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := res.Err(); err != nil {
+		return nil, "", err
+	}
+
+	response, err := res.JSON()
+	if err != nil {
+		return nil, "", err
+	}
+
+	records, err := src.extract(response)
+	if err != nil {
+		return nil, "", err
+	}
+
+	next, err := src.nextPage(pageURL, res, response, len(records))
+	return records, next, err
+}
+
+// `extract` returns the records at the records path of a response: the
+// objects of an array, or a single object.
+func (src *HttpRequestSource) extract(response any) ([]core.RowMap, error) {
+	value, ok := services.LookupPath(response, src.recordsPath)
+	if !ok {
+		return nil, fmt.Errorf("Missing records '%s' in response", src.recordsPath)
+	}
+
+	var items []any
+	switch value := value.(type) {
+	case nil:
+		return nil, nil
+	case []any:
+		items = value
+	default:
+		items = []any{value}
+	}
+
+	records := make([]core.RowMap, len(items))
+	for i, item := range items {
+		object, ok := item.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("Invalid record #%d at '%s' in response: %v", i+1, src.recordsPath, item)
+		}
+		records[i] = core.RowMap(object)
+	}
+	return records, nil
+}
+
+// `nextPage` returns the URL of the page after the given one, or an
+// empty URL if it's the last page.
+func (src *HttpRequestSource) nextPage(pageURL string, res *services.Response, response any, count int) (string, error) {
+	paging := src.pagination
+	switch paging.kind {
+	case PaginationPage, PaginationOffset:
+		// A short page is the last one.
+		if count == 0 || (paging.size > 0 && count < paging.size) {
+			return "", nil
+		}
+		current, err := url.Parse(pageURL)
+		if err != nil {
+			return "", err
+		}
+		number, err := strconv.Atoi(current.Query().Get(paging.param))
+		if err != nil {
+			return "", fmt.Errorf("Invalid %s parameter in %s", paging.param, pageURL)
+		}
+		if paging.kind == PaginationPage {
+			number += 1
+		} else {
+			number += count
+		}
+		return setQuery(pageURL, url.Values{paging.param: {strconv.Itoa(number)}})
+	case PaginationCursor:
+		value, _ := services.LookupPath(response, paging.cursorPath)
+		if value == nil || value == "" || value == false {
+			return "", nil
+		}
+		cursor := fmt.Sprint(value)
+		if strings.HasPrefix(cursor, "http://") || strings.HasPrefix(cursor, "https://") {
+			if cursor == pageURL {
+				return "", nil
+			}
+			return cursor, nil
+		}
+		current, err := url.Parse(pageURL)
+		if err != nil {
+			return "", err
+		}
+		if current.Query().Get(paging.param) == cursor {
+			return "", fmt.Errorf("Repeated cursor %s in response", cursor)
+		}
+		return setQuery(pageURL, url.Values{paging.param: {cursor}})
+	case PaginationLink:
+		next := nextLink(res.Header.Values("Link"))
+		if next == "" {
+			return "", nil
+		}
+		target, err := res.Request.URL.Parse(next)
+		if err != nil {
+			return "", fmt.Errorf("Invalid next link %s: %w", next, err)
+		}
+		if target.String() == pageURL {
+			return "", fmt.Errorf("Repeated next link %s in response", next)
+		}
+		return target.String(), nil
+	}
+	return "", nil
+}
+
+// `nextLink` returns the URL of the `next` relation of the given `Link`
+// headers, or an empty string if there's none.
+func nextLink(headers []string) string {
+	for _, header := range headers {
+		for _, link := range strings.Split(header, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			for _, param := range parts[1:] {
+				key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if strings.EqualFold(key, "rel") && strings.Contains(" "+strings.Trim(value, `"`)+" ", " next ") {
+					return target[1 : len(target)-1]
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// `setQuery` returns the given URL with the given query parameters set.
+func setQuery(rawURL string, values url.Values) (string, error) {
+	if len(values) == 0 {
+		return rawURL, nil
+	}
+
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("Error parsing endpoint URI: %w", err)
+	}
+	query := target.Query()
+	for key := range values {
+		query.Set(key, values.Get(key))
+	}
+	target.RawQuery = query.Encode()
+	return target.String(), nil
+}
@@ -0,0 +1,229 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sources
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tnotstar/datacat/core"
+)
+
+// `records` returns the records with the ids in the given range, or
+// none if the range is empty.
+func records(from, to int) []map[string]any {
+	items := []map[string]any{}
+	for id := from; id <= to && id <= 5; id++ {
+		items = append(items, map[string]any{"id": id})
+	}
+	return items
+}
+
+// `newHTTPServer` starts a test server with the given handler of its
+// `/items` endpoint, which counts the requests.
+func newHTTPServer(t *testing.T, requests *atomic.Int32, handler func(w http.ResponseWriter, r *http.Request) any) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(handler(w, r))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// `readHTTPSource` reads the records of an HTTP request source of the
+// given server, and returns their ids.
+func readHTTPSource(t *testing.T, server *httptest.Server, args core.Arguments) []string {
+	t.Helper()
+	args["service"] = "api"
+	args["path"] = "/items"
+	cfg := newTaskConfig("http-request-source", args)
+	cfg.Services = map[string]core.ServiceConfig{"api": {BaseURL: server.URL}}
+
+	rows, err := readSource(t, cfg)
+	if err != nil {
+		t.Fatalf("Source failed: %v", err)
+	}
+	ids := make([]string, len(rows))
+	for i, row := range rows {
+		ids[i] = fmt.Sprint(row["id"])
+	}
+	return ids
+}
+
+// `queryInt` returns the integer query parameter of the given request.
+func queryInt(r *http.Request, name string) int {
+	value, _ := strconv.Atoi(r.URL.Query().Get(name))
+	return value
+}
+
+var allIDs = []string{"1", "2", "3", "4", "5"}
+
+func TestHTTPSourcePagePagination(t *testing.T) {
+	var requests atomic.Int32
+	server := newHTTPServer(t, &requests, func(w http.ResponseWriter, r *http.Request) any {
+		page, size := queryInt(r, "page"), queryInt(r, "size")
+		return records((page-1)*size+1, page*size)
+	})
+
+	ids := readHTTPSource(t, server, core.Arguments{
+		"pagination": core.Arguments{"type": "page", "size": 2, "sizeparam": "size"},
+	})
+	if !reflect.DeepEqual(ids, allIDs) || requests.Load() != 3 {
+		t.Errorf("Read %v with %d requests, want %v with 3", ids, requests.Load(), allIDs)
+	}
+}
+
+func TestHTTPSourceOffsetPagination(t *testing.T) {
+	var requests atomic.Int32
+	server := newHTTPServer(t, &requests, func(w http.ResponseWriter, r *http.Request) any {
+		offset, limit := queryInt(r, "offset"), queryInt(r, "limit")
+		return map[string]any{"data": records(offset+1, offset+limit)}
+	})
+
+	ids := readHTTPSource(t, server, core.Arguments{
+		"recordspath": "data",
+		"pagination":  core.Arguments{"type": "offset", "size": 2},
+	})
+	if !reflect.DeepEqual(ids, allIDs) || requests.Load() != 3 {
+		t.Errorf("Read %v with %d requests, want %v with 3", ids, requests.Load(), allIDs)
+	}
+}
+
+func TestHTTPSourceCursorPagination(t *testing.T) {
+	var requests atomic.Int32
+	server := newHTTPServer(t, &requests, func(w http.ResponseWriter, r *http.Request) any {
+		from := 1
+		if cursor := r.URL.Query().Get("after"); cursor != "" {
+			from, _ = strconv.Atoi(cursor)
+		}
+		response := map[string]any{"items": records(from, from+1), "meta": map[string]any{"next": nil}}
+		if from+2 <= 5 {
+			response["meta"] = map[string]any{"next": strconv.Itoa(from + 2)}
+		}
+		return response
+	})
+
+	ids := readHTTPSource(t, server, core.Arguments{
+		"recordspath": "items",
+		"pagination":  core.Arguments{"type": "cursor", "param": "after", "cursorpath": "meta.next"},
+	})
+	if !reflect.DeepEqual(ids, allIDs) || requests.Load() != 3 {
+		t.Errorf("Read %v with %d requests, want %v with 3", ids, requests.Load(), allIDs)
+	}
+}
+
+func TestHTTPSourceLinkPagination(t *testing.T) {
+	var requests atomic.Int32
+	server := newHTTPServer(t, &requests, func(w http.ResponseWriter, r *http.Request) any {
+		from := queryInt(r, "from")
+		if from == 0 {
+			from = 1
+		}
+		if from+2 <= 5 {
+			w.Header().Set("Link", fmt.Sprintf(`</items?from=1>; rel="first", </items?from=%d>; rel="next"`, from+2))
+		}
+		return records(from, from+1)
+	})
+
+	ids := readHTTPSource(t, server, core.Arguments{
+		"pagination": core.Arguments{"type": "link"},
+	})
+	if !reflect.DeepEqual(ids, allIDs) || requests.Load() != 3 {
+		t.Errorf("Read %v with %d requests, want %v with 3", ids, requests.Load(), allIDs)
+	}
+}
+
+func TestHTTPSourceStopsAtEmptyPage(t *testing.T) {
+	var requests atomic.Int32
+	server := newHTTPServer(t, &requests, func(w http.ResponseWriter, r *http.Request) any {
+		page := queryInt(r, "page")
+		return records(page*2-1, page*2)
+	})
+
+	// Without a page size, only an empty page is the last one.
+	ids := readHTTPSource(t, server, core.Arguments{
+		"pagination": core.Arguments{"type": "page"},
+	})
+	if !reflect.DeepEqual(ids, allIDs) || requests.Load() != 4 {
+		t.Errorf("Read %v with %d requests, want %v with 4", ids, requests.Load(), allIDs)
+	}
+}
+
+func TestHTTPSourceStopsAtMaxPages(t *testing.T) {
+	var requests atomic.Int32
+	server := newHTTPServer(t, &requests, func(w http.ResponseWriter, r *http.Request) any {
+		page := queryInt(r, "page")
+		return records(page*2-1, page*2)
+	})
+
+	ids := readHTTPSource(t, server, core.Arguments{
+		"pagination": core.Arguments{"type": "page", "maxpages": 2},
+	})
+	if want := allIDs[:4]; !reflect.DeepEqual(ids, want) || requests.Load() != 2 {
+		t.Errorf("Read %v with %d requests, want %v with 2", ids, requests.Load(), want)
+	}
+}
+
+func TestHTTPSourceRateLimit(t *testing.T) {
+	var requests atomic.Int32
+	server := newHTTPServer(t, &requests, func(w http.ResponseWriter, r *http.Request) any {
+		page := queryInt(r, "page")
+		return records(page*2-1, page*2)
+	})
+
+	// Four requests at 20 per second take at least three intervals.
+	start := time.Now()
+	readHTTPSource(t, server, core.Arguments{
+		"ratelimit":  20,
+		"pagination": core.Arguments{"type": "page"},
+	})
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("Read %d pages in %v, want at least 150ms", requests.Load(), elapsed)
+	}
+}
+
+func TestHTTPSourceRepeatedLink(t *testing.T) {
+	var requests atomic.Int32
+	server := newHTTPServer(t, &requests, func(w http.ResponseWriter, r *http.Request) any {
+		w.Header().Set("Link", `</items>; rel="next"`)
+		return records(1, 2)
+	})
+
+	args := core.Arguments{
+		"service":    "api",
+		"path":       "/items",
+		"pagination": core.Arguments{"type": "link"},
+	}
+	cfg := newTaskConfig("http-request-source", args)
+	cfg.Services = map[string]core.ServiceConfig{"api": {BaseURL: server.URL}}
+	if _, err := readSource(t, cfg); err == nil || requests.Load() != 1 {
+		t.Errorf("Source of a repeated link failed with %v after %d request(s)", err, requests.Load())
+	}
+}
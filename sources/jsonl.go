@@ -22,14 +22,26 @@ package sources
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/tnotstar/datacat/core"
 )
 
+// The names of the metadata fields of the JSONLines rows.
+const (
+	FileField = "_file"
+	LineField = "_line"
+)
+
 // `JSONLFileSource` is the concrete implementation of the source interface
 // for JSONLines (or NDJSON) file reader. It reads data from a given
 // file(s) in NDJSON format and send each row to the output processing channel.
@@ -38,10 +50,24 @@ type JSONLFileSource struct {
 	id int
 	// The `task` of the task which is running into.
 	task string
-	// The `fileName` of the file to be read.
-	fileName string
+	// The `fileNames` of the files to be read, in order.
+	fileNames []string
+	// The `parallel` is the number of files read at the same time.
+	parallel int
+	// `metadata` adds the file name and line number to the rows.
+	metadata bool
+	// The `compression` format of the files, or `auto` to detect it by
+	// their extensions.
+	compression string
+	// The `maxLineSize` is the maximum size of a line, in bytes.
+	maxLineSize int
 }
 
+// The default maximum size of a line of a JSONLines file.
+const defaultMaxLineSize = 16 << 20
+
+// `IsaJSONLFileSource` returns true if given source type is
+// a JSONLines file.
 func IsaJSONLFileSource(sourceType string) bool {
 	return sourceType == "jsonl-file-source"
 }
@@ -51,50 +77,204 @@ func IsaJSONLFileSource(sourceType string) bool {
 // The `id` is the instance of the adapter to be created.
 // The `task` is the name of the task to be executed.
 // The `filename` is the name of the file to be read.
-func NewJSONLFileSource(id int, cfg core.Configurator, taskName string) *JSONLFileSource {
+func NewJSONLFileSource(id int, cfg core.Configurator, taskName string) (core.Source, error) {
 	sourceConfig, _ := cfg.GetSourceConfig(taskName)
 
+	patterns, err := sourceConfig.Arguments.Strings("filenames")
+	if err != nil {
+		return nil, err
+	}
+	if len(patterns) == 0 {
+		fileName, err := sourceConfig.Arguments.RequiredString("filename")
+		if err != nil {
+			return nil, err
+		}
+		patterns = []string{fileName}
+	}
+
+	fileNames, err := expandFileNames(patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	parallel, err := sourceConfig.Arguments.Int("parallel", 1)
+	if err != nil {
+		return nil, err
+	}
+	if parallel < 1 {
+		parallel = 1
+	}
+	if taskConfig, err := cfg.GetTaskConfig(taskName); err == nil && parallel > 1 {
+		if taskConfig.Ordered {
+			return nil, fmt.Errorf("Ordered task can't read %d files in parallel", parallel)
+		}
+		// The rows of the files read in parallel interleave in a
+		// different order on every run, so the rows skipped on resume
+		// wouldn't be the ones processed before.
+		if taskConfig.Checkpoint != nil {
+			return nil, fmt.Errorf("Checkpointed task can't read %d files in parallel", parallel)
+		}
+	}
+
+	metadata, err := sourceConfig.Arguments.Bool("metadata", false)
+	if err != nil {
+		return nil, err
+	}
+
+	maxLineSize, err := sourceConfig.Arguments.Int("maxlinesize", defaultMaxLineSize)
+	if err != nil {
+		return nil, err
+	}
+	if maxLineSize < 1 {
+		return nil, fmt.Errorf("Invalid maximum line size: %d", maxLineSize)
+	}
+
+	compression := sourceConfig.Arguments.String("compression", core.CompressionAuto)
+	for _, fileName := range fileNames {
+		if _, err := core.DetectCompression(fileName, compression); err != nil {
+			return nil, err
+		}
+	}
+
 	return &JSONLFileSource{
-		id:       id,
-		task:     taskName,
-		fileName: sourceConfig.Arguments["filename"].(string),
+		id:          id,
+		task:        taskName,
+		fileNames:   fileNames,
+		parallel:    parallel,
+		metadata:    metadata,
+		compression: compression,
+		maxLineSize: maxLineSize,
+	}, nil
+}
+
+// `expandFileNames` returns the names of the files matching the given
+// glob patterns, in the order of the patterns and sorted by name for
+// each pattern, without duplicates. A pattern must match some file.
+func expandFileNames(patterns []string) ([]string, error) {
+	var fileNames []string
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		matches := []string{pattern}
+		if strings.ContainsAny(pattern, `*?[\`) {
+			var err error
+			if matches, err = filepath.Glob(pattern); err != nil {
+				return nil, fmt.Errorf("Invalid file pattern '%s': %w", pattern, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("No file matches pattern '%s'", pattern)
+			}
+			sort.Strings(matches)
+		}
+
+		for _, match := range matches {
+			if !seen[match] {
+				seen[match] = true
+				fileNames = append(fileNames, match)
+			}
+		}
 	}
+	return fileNames, nil
 }
 
-// `Run` creates a goroutine that reads data from the database and sends
+// `Run` creates a goroutine that reads data from the files and sends
 // it to an output channel. It returns a channel that will receive the
-// data read from the database.
-func (src *JSONLFileSource) Run(wg *sync.WaitGroup) <-chan core.RowMap {
+// data read from the files. Files read in parallel interleave their
+// rows, each file in order.
+func (src *JSONLFileSource) Run(ctx context.Context, wg *sync.WaitGroup, trk *core.Tracker) <-chan core.RowMap {
 	log.Printf("Starting JSONLines source for task %s...", src.task)
 	out := make(chan core.RowMap)
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
+	files := make(chan string, len(src.fileNames))
+	for _, fileName := range src.fileNames {
+		files <- fileName
+	}
+	close(files)
 
-		log.Printf("Reading input file: %s\n", src.fileName)
-		reader, err := os.Open(src.fileName)
-		if err != nil {
-			log.Fatalf("Error opening file %s: %s", src.fileName, err.Error())
-		}
-		defer reader.Close()
-
-		counter := 0
-		scanner := bufio.NewScanner(reader)
-		log.Println("Reading data from the input file")
-		for scanner.Scan() {
-			var row core.RowMap
-			if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
-				log.Fatalf("Error unmarshalling data row: %s", err.Error())
+	var readers sync.WaitGroup
+	for i := 0; i < src.parallel && i < len(src.fileNames); i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for fileName := range files {
+				if !src.readFile(ctx, trk, out, fileName) {
+					return
+				}
 			}
-			out <- row
-			counter += 1
-		}
+		}()
+	}
 
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		readers.Wait()
 		close(out)
-		log.Printf("Read %d row(s) from the input file", counter)
 	}()
 
 	log.Println("JSONLines source for task:", src.task, ", started")
 	return out
 }
+
+// `readFile` reads the rows of the file with the given name and sends
+// them to the given channel. It returns false if the reading must stop.
+func (src *JSONLFileSource) readFile(ctx context.Context, trk *core.Tracker, out chan<- core.RowMap, fileName string) bool {
+	log.Printf("Reading input file: %s\n", fileName)
+	file, err := os.Open(fileName)
+	if err != nil {
+		trk.Abort("source", fmt.Errorf("Error opening file %s: %w", fileName, err))
+		return false
+	}
+	defer file.Close()
+
+	compression, _ := core.DetectCompression(fileName, src.compression)
+	reader, err := core.NewDecompressor(file, compression)
+	if err != nil {
+		trk.Abort("source", fmt.Errorf("Error opening file %s: %w", fileName, err))
+		return false
+	}
+	defer reader.Close()
+
+	counter, line := 0, 0
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, min(bufio.MaxScanTokenSize, src.maxLineSize)), src.maxLineSize)
+	for scanner.Scan() {
+		line += 1
+		var row core.RowMap
+		var invalid error
+		if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+			invalid = fmt.Errorf("Error unmarshalling data row of file %s at line %d: %w", fileName, line, err)
+		} else if row == nil {
+			invalid = fmt.Errorf("Data row of file %s at line %d isn't an object", fileName, line)
+		}
+		// An invalid line has no fields to follow the row with.
+		if invalid != nil {
+			row = make(core.RowMap)
+		}
+		if src.metadata {
+			row[FileField] = fileName
+			row[LineField] = line
+		}
+
+		if !trk.Read(row) {
+			continue
+		}
+		if invalid != nil {
+			trk.Fail("source", row, invalid)
+			continue
+		}
+		if !core.Send(ctx, out, row) {
+			return false
+		}
+		counter += 1
+	}
+
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			err = fmt.Errorf("line %d is longer than %d bytes, see the 'maxlinesize' argument", line+1, src.maxLineSize)
+		}
+		trk.Abort("source", fmt.Errorf("Error reading file %s: %w", fileName, err))
+		return false
+	}
+
+	log.Printf("Read %d row(s) from the input file %s", counter, fileName)
+	return true
+}
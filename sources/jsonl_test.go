@@ -0,0 +1,115 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sources
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tnotstar/datacat/core"
+)
+
+func TestJSONLParallelWithCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.jsonl", "b.jsonl"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(`{"id":1}`+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := newTaskConfig("jsonl-file-source", core.Arguments{
+		"filename": filepath.Join(dir, "*.jsonl"),
+		"parallel": 2,
+	})
+	if _, err := BuildSource(0, cfg, "test"); err != nil {
+		t.Fatalf("BuildSource failed without checkpoint: %v", err)
+	}
+
+	task := cfg.Tasks["test"]
+	task.Checkpoint = &core.CheckpointConfig{}
+	cfg.Tasks["test"] = task
+	if _, err := BuildSource(0, cfg, "test"); err == nil {
+		t.Error("BuildSource succeeded with checkpoint and parallel files")
+	}
+}
+
+// `readJSONLines` reads the given content with a JSONLines source with
+// the given arguments, and a dead-letter output.
+func readJSONLines(t *testing.T, content string, args core.Arguments) ([]core.RowMap, []core.RowMap, error) {
+	t.Helper()
+	fileName := filepath.Join(t.TempDir(), "input.jsonl")
+	if err := os.WriteFile(fileName, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	args["filename"] = fileName
+	cfg := newTaskConfig("jsonl-file-source", args)
+
+	src, err := BuildSource(0, cfg, "test")
+	if err != nil {
+		t.Fatalf("BuildSource failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	trk := core.NewTracker("test", cancel)
+	deadLetter := make(chan core.RowMap, 10)
+	trk.SetDeadLetter(ctx, deadLetter, core.DeadLetterConfig{})
+
+	var wg sync.WaitGroup
+	var rows []core.RowMap
+	for row := range src.Run(ctx, &wg, trk) {
+		rows = append(rows, row)
+	}
+	wg.Wait()
+	close(deadLetter)
+	var failed []core.RowMap
+	for row := range deadLetter {
+		failed = append(failed, row)
+	}
+	return rows, failed, trk.Err()
+}
+
+func TestJSONLInvalidLinesFail(t *testing.T) {
+	rows, failed, err := readJSONLines(t, "{\"a\":1}\n{oops\n[1]\n{\"a\":2}\n", core.Arguments{})
+	if err != nil {
+		t.Fatalf("Source failed: %v", err)
+	}
+	if len(rows) != 2 || len(failed) != 2 {
+		t.Errorf("Read %d row(s) and failed %d, want 2 and 2", len(rows), len(failed))
+	}
+}
+
+func TestJSONLLongLines(t *testing.T) {
+	long := fmt.Sprintf("{\"a\":%q}\n", strings.Repeat("x", 100000))
+	rows, _, err := readJSONLines(t, long, core.Arguments{})
+	if err != nil || len(rows) != 1 {
+		t.Errorf("Read %d row(s) of a long line, error %v", len(rows), err)
+	}
+
+	_, _, err = readJSONLines(t, long, core.Arguments{"maxlinesize": 1000})
+	if err == nil || !strings.Contains(err.Error(), "maxlinesize") {
+		t.Errorf("Error of a line over the maximum = %v", err)
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sources
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/tnotstar/datacat/core"
+)
+
+// `compileParameters` replaces the named parameters of the given query
+// (e.g. `:from_date`) with positional `?` placeholders. It returns the
+// compiled query and the names of the parameters, in lower case and in
+// the order of their placeholders.
+//
+// Quoted strings and identifiers, comments and `::` casts are skipped.
+func compileParameters(query string) (string, []string) {
+	var compiled strings.Builder
+	var names []string
+
+	text := []rune(query)
+	for i := 0; i < len(text); i++ {
+		char := text[i]
+		switch end := skipQuoted(text, i); {
+		case end > i:
+			compiled.WriteString(string(text[i:end]))
+			i = end - 1
+		case char == ':' && i+1 < len(text) && text[i+1] == ':':
+			compiled.WriteString("::")
+			i++
+		case char == ':' && i+1 < len(text) && isNameStart(text[i+1]):
+			end := i + 1
+			for end < len(text) && isNamePart(text[end]) {
+				end++
+			}
+			names = append(names, strings.ToLower(string(text[i+1:end])))
+			compiled.WriteRune('?')
+			i = end - 1
+		default:
+			compiled.WriteRune(char)
+		}
+	}
+
+	return compiled.String(), names
+}
+
+// `rebindQuery` replaces the positional `?` placeholders of the given
+// query with the bind style of the driver of the database. Unlike
+// `sqlx.Rebind`, the `?` found in quoted strings and identifiers or in
+// comments are kept as they are.
+func rebindQuery(db *sqlx.DB, query string) string {
+	bindType := sqlx.BindType(db.DriverName())
+	if bindType == sqlx.QUESTION || bindType == sqlx.UNKNOWN {
+		return query
+	}
+
+	var rebound strings.Builder
+	var count int
+
+	text := []rune(query)
+	for i := 0; i < len(text); i++ {
+		char := text[i]
+		switch end := skipQuoted(text, i); {
+		case end > i:
+			rebound.WriteString(string(text[i:end]))
+			i = end - 1
+		case char == '?':
+			count++
+			switch bindType {
+			case sqlx.DOLLAR:
+				fmt.Fprintf(&rebound, "$%d", count)
+			case sqlx.NAMED:
+				fmt.Fprintf(&rebound, ":arg%d", count)
+			case sqlx.AT:
+				fmt.Fprintf(&rebound, "@p%d", count)
+			}
+		default:
+			rebound.WriteRune(char)
+		}
+	}
+
+	return rebound.String()
+}
+
+// `skipQuoted` returns the position after the quoted string or
+// identifier, or the comment, starting at the given position of the
+// text. It returns the same position if none starts there.
+func skipQuoted(text []rune, start int) int {
+	char := text[start]
+	switch {
+	case char == '\'' || char == '"':
+		return skipTo(text, start+1, string(char))
+	case char == '-' && start+1 < len(text) && text[start+1] == '-':
+		return skipTo(text, start+2, "\n")
+	case char == '/' && start+1 < len(text) && text[start+1] == '*':
+		return skipTo(text, start+2, "*/")
+	}
+	return start
+}
+
+// `skipTo` returns the position after the first `delimiter` found from
+// the `start` position of the text, or the length of the text.
+func skipTo(text []rune, start int, delimiter string) int {
+	delim := []rune(delimiter)
+	for i := start; i+len(delim) <= len(text); i++ {
+		if string(text[i:i+len(delim)]) == delimiter {
+			return i + len(delim)
+		}
+	}
+	return len(text)
+}
+
+// `isNameStart` returns true if the given char may start a parameter name.
+func isNameStart(char rune) bool {
+	return char == '_' || unicode.IsLetter(char)
+}
+
+// `isNamePart` returns true if the given char may be part of a parameter name.
+func isNamePart(char rune) bool {
+	return isNameStart(char) || unicode.IsDigit(char)
+}
+
+// `resolveParameters` returns the value of each named parameter, taken
+// from the `overrides` given in the command line, from the environment
+// or from the `defaults` of the task configuration, in this order.
+func resolveParameters(names []string, defaults core.Arguments, overrides map[string]string) (map[string]any, error) {
+	known := make(map[string]bool, len(names))
+	for _, name := range names {
+		known[name] = true
+	}
+
+	var unknown []string
+	for name := range overrides {
+		if !known[strings.ToLower(name)] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("Unknown query parameter(s): %s", strings.Join(unknown, ", "))
+	}
+
+	values := make(map[string]any, len(names))
+	var missing []string
+	for name := range known {
+		if value, ok := lookupOverride(overrides, name); ok {
+			values[name] = value
+		} else if value, ok := core.LookupEnvParameter(name); ok {
+			values[name] = value
+		} else if defaults.Has(name) {
+			values[name] = defaults[name]
+		} else {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("Missing value for query parameter(s): %s", strings.Join(missing, ", "))
+	}
+
+	return values, nil
+}
+
+// `lookupOverride` returns the override of the parameter with the given
+// name, ignoring the case of the keys.
+func lookupOverride(overrides map[string]string, name string) (string, bool) {
+	for key, value := range overrides {
+		if strings.EqualFold(key, name) {
+			return value, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,65 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sources
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestCompileParameters(t *testing.T) {
+	for _, test := range []struct {
+		query, want string
+		names       []string
+	}{
+		{"SELECT * FROM t WHERE a = :From_Date AND b < :to",
+			"SELECT * FROM t WHERE a = ? AND b < ?", []string{"from_date", "to"}},
+		{"SELECT ':skip', \":skip\" FROM t WHERE a = :a",
+			"SELECT ':skip', \":skip\" FROM t WHERE a = ?", []string{"a"}},
+		{"SELECT a::date FROM t -- :skip\nWHERE a > :a /* :skip */",
+			"SELECT a::date FROM t -- :skip\nWHERE a > ? /* :skip */", []string{"a"}},
+		{"SELECT * FROM t WHERE a >= :day AND b <= :day",
+			"SELECT * FROM t WHERE a >= ? AND b <= ?", []string{"day", "day"}},
+		{"SELECT 'it''s :skip' FROM t WHERE a = :a",
+			"SELECT 'it''s :skip' FROM t WHERE a = ?", []string{"a"}},
+	} {
+		query, names := compileParameters(test.query)
+		if query != test.want || !reflect.DeepEqual(names, test.names) {
+			t.Errorf("compileParameters(%q) = %q, %q, want %q, %q", test.query, query, names, test.want, test.names)
+		}
+	}
+}
+
+func TestRebindQuerySkipsQuotedText(t *testing.T) {
+	query := "SELECT 'why?', \"a?\" FROM t -- ?\nWHERE a = ? /* ? */ AND b = ?"
+	for driver, want := range map[string]string{
+		"sqlite3":   query,
+		"pgx":       "SELECT 'why?', \"a?\" FROM t -- ?\nWHERE a = $1 /* ? */ AND b = $2",
+		"oracle":    "SELECT 'why?', \"a?\" FROM t -- ?\nWHERE a = :arg1 /* ? */ AND b = :arg2",
+		"sqlserver": "SELECT 'why?', \"a?\" FROM t -- ?\nWHERE a = @p1 /* ? */ AND b = @p2",
+	} {
+		if got := rebindQuery(sqlx.NewDb(nil, driver), query); got != want {
+			t.Errorf("rebindQuery(%s) = %q, want %q", driver, got, want)
+		}
+	}
+}
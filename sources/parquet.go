@@ -0,0 +1,393 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sources
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/format"
+	"github.com/tnotstar/datacat/core"
+)
+
+// The number of rows read at a time from a row group of a Parquet file.
+const parquetReadSize = 256
+
+// `ParquetFileSource` is the concrete implementation of the source
+// interface for Parquet files. It reads the row groups of the files in
+// order, and sends each row to the output channel.
+type ParquetFileSource struct {
+	// The `id` of the source.
+	id int
+	// The `task` of the task which is running into.
+	task string
+	// The `fileNames` of the files to be read, in order.
+	fileNames []string
+	// The `columns` to be read, or all of them if empty.
+	columns []string
+}
+
+// `IsaParquetFileSource` returns true if given source type is
+// a Parquet file.
+func IsaParquetFileSource(sourceType string) bool {
+	return sourceType == "parquet-file-source"
+}
+
+// `NewParquetFileSource` creates a new instance of the Parquet source endpoint.
+//
+// The `id` is the instance of the adapter to be created.
+// The `cfg` is the global configuration object.
+// The `taskName` is the name of the task to be executed.
+func NewParquetFileSource(id int, cfg core.Configurator, taskName string) (core.Source, error) {
+	sourceConfig, _ := cfg.GetSourceConfig(taskName)
+	args := sourceConfig.Arguments
+
+	patterns, err := args.Strings("filenames")
+	if err != nil {
+		return nil, err
+	}
+	if len(patterns) == 0 {
+		fileName, err := args.RequiredString("filename")
+		if err != nil {
+			return nil, err
+		}
+		patterns = []string{fileName}
+	}
+
+	fileNames, err := expandFileNames(patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	columns, err := args.Strings("columns")
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) > 0 {
+		if err := checkColumns(columns); err != nil {
+			return nil, fmt.Errorf("Invalid columns of task '%s': %w", taskName, err)
+		}
+	}
+
+	return &ParquetFileSource{id: id, task: taskName, fileNames: fileNames, columns: columns}, nil
+}
+
+// `Run` creates a goroutine that reads the rows of the files and sends
+// them to an output channel. It returns a channel that will receive the
+// rows read from the files.
+func (src *ParquetFileSource) Run(ctx context.Context, wg *sync.WaitGroup, trk *core.Tracker) <-chan core.RowMap {
+	log.Printf("Starting Parquet source for task %s...", src.task)
+	out := make(chan core.RowMap)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(out)
+
+		for _, fileName := range src.fileNames {
+			if !src.readFile(ctx, trk, out, fileName) {
+				return
+			}
+		}
+	}()
+
+	log.Println("Parquet source for task:", src.task, ", started")
+	return out
+}
+
+// `readFile` reads the rows of the file with the given name, one row
+// group at a time, and sends them to the given channel. It returns
+// false if the reading must stop.
+func (src *ParquetFileSource) readFile(ctx context.Context, trk *core.Tracker, out chan<- core.RowMap, fileName string) bool {
+	log.Printf("Reading input file: %s\n", fileName)
+	file, err := os.Open(fileName)
+	if err != nil {
+		trk.Abort("source", fmt.Errorf("Error opening file %s: %w", fileName, err))
+		return false
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		trk.Abort("source", fmt.Errorf("Error opening file %s: %w", fileName, err))
+		return false
+	}
+	parquetFile, err := parquet.OpenFile(file, info.Size())
+	if err != nil {
+		trk.Abort("source", fmt.Errorf("Error opening file %s: %w", fileName, err))
+		return false
+	}
+
+	schema := parquetFile.Schema()
+	fields, err := src.fields(schema)
+	if err != nil {
+		trk.Abort("source", fmt.Errorf("Invalid columns of file %s: %w", fileName, err))
+		return false
+	}
+
+	counter := 0
+	buffer := make([]parquet.Row, parquetReadSize)
+	for _, rowGroup := range parquetFile.RowGroups() {
+		rows := rowGroup.Rows()
+		for {
+			count, err := rows.ReadRows(buffer)
+			for _, values := range buffer[:count] {
+				row, err := newParquetRow(schema, fields, values)
+				if err != nil {
+					rows.Close()
+					trk.Abort("source", fmt.Errorf("Error reading row of file %s: %w", fileName, err))
+					return false
+				}
+
+				if !trk.Read(row) {
+					continue
+				}
+				if !core.Send(ctx, out, row) {
+					rows.Close()
+					return false
+				}
+				counter += 1
+			}
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				rows.Close()
+				trk.Abort("source", fmt.Errorf("Error reading file %s: %w", fileName, err))
+				return false
+			}
+		}
+		rows.Close()
+	}
+
+	log.Printf("Read %d row(s) from the input file %s", counter, fileName)
+	return true
+}
+
+// A `parquetField` is a top-level field of the schema of a Parquet file.
+type parquetField struct {
+	// The `name` of the field.
+	name string
+	// The `column` index of the leaf column of the field, or -1 if it's
+	// a nested or repeated field.
+	column int
+	// The `typ` of the values of the leaf column of the field.
+	typ parquet.Type
+}
+
+// `fields` returns the fields of the given schema to be read.
+func (src *ParquetFileSource) fields(schema *parquet.Schema) ([]parquetField, error) {
+	var fields []parquetField
+	byName := make(map[string]parquetField)
+	column := 0
+	for _, node := range schema.Fields() {
+		field := parquetField{name: node.Name(), column: -1}
+		if node.Leaf() && !node.Repeated() {
+			field.column = column
+			field.typ = node.Type()
+		}
+		column += countLeaves(node)
+		fields = append(fields, field)
+		byName[field.name] = field
+	}
+	if len(src.columns) == 0 {
+		return fields, nil
+	}
+
+	selected := make([]parquetField, len(src.columns))
+	for i, name := range src.columns {
+		field, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("missing column '%s'", name)
+		}
+		selected[i] = field
+	}
+	return selected, nil
+}
+
+// `countLeaves` returns the number of leaf columns of the given node.
+func countLeaves(node parquet.Node) int {
+	if node.Leaf() {
+		return 1
+	}
+	count := 0
+	for _, field := range node.Fields() {
+		count += countLeaves(field)
+	}
+	return count
+}
+
+// `newParquetRow` returns the row of the given fields from the given
+// values of a row of a file. The values of the leaf columns take the
+// types of their logical types; nested and repeated fields are
+// reconstructed as objects and arrays of their plain values.
+func newParquetRow(schema *parquet.Schema, fields []parquetField, values parquet.Row) (core.RowMap, error) {
+	columns := make([][]parquet.Value, len(schema.Columns()))
+	values.Range(func(column int, values []parquet.Value) bool {
+		columns[column] = values
+		return true
+	})
+
+	var nested map[string]any
+	row := make(core.RowMap, len(fields))
+	for _, field := range fields {
+		if field.column < 0 {
+			if nested == nil {
+				nested = make(map[string]any)
+				if err := schema.Reconstruct(&nested, values); err != nil {
+					return nil, err
+				}
+			}
+			row[field.name] = nested[field.name]
+			continue
+		}
+
+		var value any
+		if len(columns[field.column]) > 0 {
+			var err error
+			if value, err = parquetValue(columns[field.column][0], field.typ); err != nil {
+				return nil, fmt.Errorf("Invalid value of column '%s': %w", field.name, err)
+			}
+		}
+		row[field.name] = value
+	}
+	return row, nil
+}
+
+// `parquetValue` returns the value of a leaf column of the given type,
+// by its logical type: dates and timestamps are times, decimals exact
+// numbers, and texts strings.
+func parquetValue(value parquet.Value, typ parquet.Type) (any, error) {
+	if value.IsNull() {
+		return nil, nil
+	}
+
+	logical := typ.LogicalType()
+	if logical == nil {
+		logical = &format.LogicalType{}
+	}
+	if logical.Decimal != nil {
+		return decimalValue(value, int(logical.Decimal.Scale)), nil
+	}
+
+	switch typ.Kind() {
+	case parquet.Boolean:
+		return value.Boolean(), nil
+	case parquet.Int32:
+		switch {
+		case logical.Date != nil:
+			return time.Unix(int64(value.Int32())*24*60*60, 0).UTC(), nil
+		case logical.Integer != nil && !logical.Integer.IsSigned:
+			return int64(value.Uint32()), nil
+		}
+		return int64(value.Int32()), nil
+	case parquet.Int64:
+		switch {
+		case logical.Timestamp != nil:
+			return timestampValue(value.Int64(), logical.Timestamp.Unit), nil
+		case logical.Integer != nil && !logical.Integer.IsSigned:
+			return value.Uint64(), nil
+		}
+		return value.Int64(), nil
+	case parquet.Int96:
+		// The legacy timestamps: nanoseconds of the day and Julian day.
+		int96 := value.Int96()
+		nanos := int64(int96[1])<<32 | int64(int96[0])
+		return time.Unix((int64(int96[2])-julianUnixEpoch)*24*60*60, nanos).UTC(), nil
+	case parquet.Float:
+		return float64(value.Float()), nil
+	case parquet.Double:
+		return value.Double(), nil
+	}
+
+	data := value.ByteArray()
+	switch {
+	case logical.UTF8 != nil, logical.Enum != nil:
+		return string(data), nil
+	case logical.Json != nil:
+		var decoded any
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&decoded); err != nil {
+			return nil, err
+		}
+		return decoded, nil
+	case logical.UUID != nil && len(data) == 16:
+		return fmt.Sprintf("%x-%x-%x-%x-%x", data[0:4], data[4:6], data[6:8], data[8:10], data[10:16]), nil
+	}
+	return bytes.Clone(data), nil
+}
+
+// The `julianUnixEpoch` is the Julian day of the Unix epoch.
+const julianUnixEpoch = 2440588
+
+// `timestampValue` returns the time of the given timestamp, in the given
+// unit since the Unix epoch.
+func timestampValue(timestamp int64, unit format.TimeUnit) time.Time {
+	switch {
+	case unit.Millis != nil:
+		return time.UnixMilli(timestamp).UTC()
+	case unit.Nanos != nil:
+		return time.Unix(0, timestamp).UTC()
+	}
+	return time.UnixMicro(timestamp).UTC()
+}
+
+// `decimalValue` returns the exact number of the given unscaled value,
+// an integer or a big-endian two's complement, with the given scale.
+func decimalValue(value parquet.Value, scale int) json.Number {
+	unscaled := new(big.Int)
+	switch value.Kind() {
+	case parquet.Int32:
+		unscaled.SetInt64(int64(value.Int32()))
+	case parquet.Int64:
+		unscaled.SetInt64(value.Int64())
+	default:
+		data := value.ByteArray()
+		unscaled.SetBytes(data)
+		if len(data) > 0 && data[0]&0x80 != 0 {
+			unscaled.Sub(unscaled, new(big.Int).Lsh(big.NewInt(1), uint(8*len(data))))
+		}
+	}
+
+	digits := new(big.Int).Abs(unscaled).String()
+	if scale > 0 {
+		if len(digits) <= scale {
+			digits = strings.Repeat("0", scale-len(digits)+1) + digits
+		}
+		digits = digits[:len(digits)-scale] + "." + digits[len(digits)-scale:]
+	}
+	if unscaled.Sign() < 0 {
+		digits = "-" + digits
+	}
+	return json.Number(digits)
+}
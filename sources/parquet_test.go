@@ -0,0 +1,157 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sources
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/tnotstar/datacat/core"
+)
+
+// `writeParquetFile` writes the given rows of physical values to a new
+// Parquet file with the given schema, in row groups of `groupSize` rows,
+// and returns its name.
+func writeParquetFile(t *testing.T, group parquet.Group, groupSize int, rows ...map[string]any) string {
+	t.Helper()
+	fileName := filepath.Join(t.TempDir(), "input.parquet")
+	file, err := os.Create(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	schema := parquet.NewSchema("test", group)
+	writer := parquet.NewWriter(file, schema)
+	for i, row := range rows {
+		if _, err := writer.WriteRows([]parquet.Row{schema.Deconstruct(nil, row)}); err != nil {
+			t.Fatal(err)
+		}
+		if (i+1)%groupSize == 0 {
+			if err := writer.Flush(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return fileName
+}
+
+func TestParquetLogicalTypes(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 30, 15, 0, time.UTC)
+	group := parquet.Group{
+		"id":      parquet.Int(64),
+		"name":    parquet.Optional(parquet.String()),
+		"price":   parquet.Decimal(2, 18, parquet.Int64Type),
+		"amount":  parquet.Optional(parquet.Decimal(4, 20, parquet.FixedLenByteArrayType(9))),
+		"created": parquet.Timestamp(parquet.Millisecond),
+		"day":     parquet.Date(),
+		"count":   parquet.Uint(32),
+		"raw":     parquet.Leaf(parquet.ByteArrayType),
+		"doc":     parquet.JSON(),
+		"tags":    parquet.Repeated(parquet.String()),
+		"address": parquet.Group{"city": parquet.String(), "zip": parquet.Int(32)},
+	}
+	// -12.3456 is -123456 unscaled, in two's complement.
+	negative := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfe, 0x1d, 0xc0}
+	fileName := writeParquetFile(t, group, 1,
+		map[string]any{
+			"id": int64(1), "name": "ann", "price": int64(1999), "amount": negative,
+			"created": created.UnixMilli(), "day": int32(19783), "count": uint32(4000000000),
+			"raw": []byte{1, 2}, "doc": `{"a":1.5}`, "tags": []any{"x", "y"},
+			"address": map[string]any{"city": "Lima", "zip": int32(15001)},
+		},
+		map[string]any{
+			"id": int64(2), "name": nil, "price": int64(-5), "amount": nil,
+			"created": created.UnixMilli(), "day": int32(0), "count": uint32(1),
+			"raw": []byte{}, "doc": `[]`, "tags": []any{},
+			"address": map[string]any{"city": "", "zip": int32(0)},
+		},
+	)
+
+	rows, err := readSource(t, newTaskConfig("parquet-file-source", core.Arguments{"filename": fileName}))
+	if err != nil {
+		t.Fatalf("reading failed: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("read %d rows, want 2", len(rows))
+	}
+
+	want := core.RowMap{
+		"id": int64(1), "name": "ann", "price": json.Number("19.99"), "amount": json.Number("-12.3456"),
+		"created": created, "day": time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), "count": int64(4000000000),
+		"raw": []byte{1, 2}, "doc": map[string]any{"a": json.Number("1.5")}, "tags": []any{"x", "y"},
+		"address": map[string]any{"city": "Lima", "zip": int32(15001)},
+	}
+	for field, value := range want {
+		if !reflect.DeepEqual(rows[0][field], value) {
+			t.Errorf("field %s = %#v, want %#v", field, rows[0][field], value)
+		}
+	}
+	if rows[1]["name"] != nil || rows[1]["amount"] != nil || rows[1]["price"] != json.Number("-0.05") {
+		t.Errorf("second row = %v", rows[1])
+	}
+	if day := rows[1]["day"].(time.Time); !day.Equal(time.Unix(0, 0)) {
+		t.Errorf("day of second row = %v", day)
+	}
+}
+
+func TestParquetColumnsOfFiles(t *testing.T) {
+	group := parquet.Group{"id": parquet.Int(64), "name": parquet.String(), "city": parquet.String()}
+	var rows []map[string]any
+	for i := 0; i < 5; i++ {
+		rows = append(rows, map[string]any{"id": int64(i), "name": "n", "city": "c"})
+	}
+	first := writeParquetFile(t, group, 2, rows[:3]...)
+	second := writeParquetFile(t, group, 2, rows[3:]...)
+
+	read, err := readSource(t, newTaskConfig("parquet-file-source", core.Arguments{
+		"filenames": []any{first, second},
+		"columns":   []any{"name", "id"},
+	}))
+	if err != nil {
+		t.Fatalf("reading failed: %v", err)
+	}
+	if len(read) != 5 {
+		t.Fatalf("read %d rows, want 5", len(read))
+	}
+	for i, row := range read {
+		if len(row) != 2 || row["id"] != int64(i) || row["name"] != "n" {
+			t.Errorf("row #%d = %v", i, row)
+		}
+	}
+
+	_, err = readSource(t, newTaskConfig("parquet-file-source", core.Arguments{
+		"filename": first,
+		"columns":  []any{"zip"},
+	}))
+	if err == nil || !strings.Contains(err.Error(), "missing column 'zip'") {
+		t.Errorf("error of a missing column = %v", err)
+	}
+}
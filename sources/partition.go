@@ -0,0 +1,305 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sources
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/tnotstar/datacat/core"
+)
+
+// `PartitionField` is the name of the field which tags each row with
+// the partition of the source that read it.
+const PartitionField = "_partition"
+
+// A `partitioning` splits the rows of a database query source into
+// ranges of a column, read concurrently by the source instances.
+type partitioning struct {
+	// `column` is the name of the partitioning column.
+	column string
+	// `count` is the number of partitions.
+	count int
+	// `ranges` are the explicit ranges of the partitions, if any.
+	ranges []partitionRange
+}
+
+// A `partitionPlan` holds the ranges of the partitions of an execution
+// of a task, shared by all the instances of its source.
+type partitionPlan struct {
+	// `ranges` are the ranges of the partitions, explicit or computed
+	// from the minimum and maximum values of the column.
+	ranges []partitionRange
+
+	once sync.Once
+	err  error
+}
+
+// A `partitionRange` restricts the rows of a partition to the values of
+// the column from `from` (inclusive) to `to` (exclusive). A nil bound
+// is unrestricted.
+type partitionRange struct {
+	from  any
+	to    any
+	nulls bool
+}
+
+// `CountPartitions` returns the number of source instances to be built
+// for the given task: the number of partitions of a partitioned source,
+// or one otherwise.
+func CountPartitions(cfg core.Configurator, taskName string) (int, error) {
+	sourceConfig, err := cfg.GetSourceConfig(taskName)
+	if err != nil {
+		return 0, fmt.Errorf("Error getting source configuration for task %s: %w", taskName, err)
+	}
+
+	if !IsaDatabaseQuerySource(sourceConfig.Type) {
+		return 1, nil
+	}
+
+	part, err := getPartitioning(sourceConfig.Arguments, taskName)
+	if err != nil || part == nil {
+		return 1, err
+	}
+	return part.count, nil
+}
+
+// `getPartitioning` returns the partitioning of the source of the given
+// task, or nil if it isn't partitioned. It's parsed from the `partition`
+// argument:
+//
+//	partition:
+//	  column: ID        # the partitioning column
+//	  count: 4          # the number of partitions, or
+//	  ranges:           # explicit ranges, `from` inclusive, `to` exclusive
+//	    - { to: 1000 }
+//	    - { from: 1000, nulls: true }   # the range of the nulls, or the first one
+func getPartitioning(args core.Arguments, taskName string) (*partitioning, error) {
+	if !args.Has("partition") {
+		return nil, nil
+	}
+
+	partArgs, err := args.Map("partition")
+	if err != nil {
+		return nil, err
+	}
+
+	column, err := partArgs.RequiredString("column")
+	if err != nil {
+		return nil, err
+	}
+	if !isIdentifier(column) {
+		return nil, fmt.Errorf("Invalid partition column name: %s", column)
+	}
+
+	part := &partitioning{column: column}
+	if partArgs.Has("ranges") {
+		if partArgs.Has("count") {
+			return nil, fmt.Errorf("Partition of task '%s' can't take both count and ranges", taskName)
+		}
+
+		raws, ok := partArgs["ranges"].([]any)
+		if !ok || len(raws) == 0 {
+			return nil, fmt.Errorf("Invalid partition ranges for task '%s'", taskName)
+		}
+		nulls := -1
+		for i, raw := range raws {
+			bounds, ok := raw.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("Invalid partition range #%d for task '%s'", i, taskName)
+			}
+			rng := partitionRange{
+				from: boundValue(bounds["from"]),
+				to:   boundValue(bounds["to"]),
+			}
+			if rng.nulls, err = core.Arguments(bounds).Bool("nulls", false); err != nil {
+				return nil, err
+			}
+			if rng.nulls {
+				if nulls >= 0 {
+					return nil, fmt.Errorf("Partition ranges #%d and #%d of task '%s' both read the nulls", nulls, i, taskName)
+				}
+				nulls = i
+			}
+			part.ranges = append(part.ranges, rng)
+		}
+		// The rows with a null value match no bounds, so they are read
+		// by the first range unless another one is set to.
+		if nulls < 0 {
+			part.ranges[0].nulls = true
+		}
+		part.count = len(part.ranges)
+	} else {
+		part.count, err = partArgs.Int("count", 0)
+		if err != nil {
+			return nil, err
+		}
+		if part.count < 1 {
+			return nil, fmt.Errorf("Invalid partition count for task '%s': %d", taskName, part.count)
+		}
+	}
+
+	return part, nil
+}
+
+// `plan` returns the range of the partition with the given `id`. The
+// ranges are computed once per execution of the task, by the first
+// instance, from the minimum and maximum values of the column, unless
+// they're explicit.
+//
+// The `ok` result is false when the partition has no rows to read.
+func (part *partitioning) plan(ctx context.Context, db *sqlx.DB, trk *core.Tracker, src *DatabaseQuerySource, id int) (partitionRange, bool, error) {
+	plan := trk.Shared("partition", func() any { return &partitionPlan{} }).(*partitionPlan)
+	plan.once.Do(func() {
+		if part.ranges != nil {
+			plan.ranges = part.ranges
+		} else {
+			plan.ranges, plan.err = part.split(ctx, db, src)
+		}
+	})
+	if plan.err != nil {
+		return partitionRange{}, false, plan.err
+	}
+	if id >= len(plan.ranges) {
+		return partitionRange{}, false, nil
+	}
+	return plan.ranges[id], true, nil
+}
+
+// `split` divides the values of the column into `count` ranges of the
+// same width. The first range also holds the rows with a null value.
+func (part *partitioning) split(ctx context.Context, db *sqlx.DB, src *DatabaseQuerySource) ([]partitionRange, error) {
+	conditions, args := src.conditions()
+	query := fmt.Sprintf("SELECT MIN(%[1]s.%[2]s), MAX(%[1]s.%[2]s) FROM (%[3]s) %[1]s", sourceAlias, part.column, trimQuery(src.query))
+	if len(conditions) > 0 {
+		query += " WHERE " + joinConditions(conditions)
+	}
+
+	var lower, upper any
+	if err := db.QueryRowxContext(ctx, rebindQuery(db, query), args...).Scan(&lower, &upper); err != nil {
+		return nil, fmt.Errorf("Error computing the partitions of column '%s': %w", part.column, err)
+	}
+	if bytes, ok := lower.([]byte); ok {
+		lower = string(bytes)
+	}
+	if bytes, ok := upper.([]byte); ok {
+		upper = string(bytes)
+	}
+
+	if lower == nil || upper == nil {
+		// Either there're no rows or all of them are null.
+		return []partitionRange{{nulls: true}}, nil
+	}
+
+	bounds, err := splitBounds(lower, upper, part.count)
+	if err != nil {
+		return nil, fmt.Errorf("Can't partition column '%s': %w", part.column, err)
+	}
+
+	ranges := make([]partitionRange, part.count)
+	for i := range ranges {
+		if i > 0 {
+			ranges[i].from = bounds[i-1]
+		}
+		if i < len(bounds) {
+			ranges[i].to = bounds[i]
+		}
+	}
+	ranges[0].nulls = true
+	return ranges, nil
+}
+
+// `splitBounds` returns the `count - 1` bounds dividing the interval
+// from `lower` to `upper` into `count` ranges of the same width.
+func splitBounds(lower, upper any, count int) ([]any, error) {
+	bounds := make([]any, count-1)
+
+	if from, ok := lower.(time.Time); ok {
+		to, ok := upper.(time.Time)
+		if !ok {
+			return nil, fmt.Errorf("Unexpected upper bound: %v", upper)
+		}
+		width := to.Sub(from) / time.Duration(count)
+		for i := range bounds {
+			bounds[i] = from.Add(width * time.Duration(i+1))
+		}
+		return bounds, nil
+	}
+
+	from, ok := core.ToFloat(lower)
+	if !ok {
+		return nil, fmt.Errorf("Unsupported column type: %T", lower)
+	}
+	to, ok := core.ToFloat(upper)
+	if !ok {
+		return nil, fmt.Errorf("Unsupported column type: %T", upper)
+	}
+
+	integral := from == math.Trunc(from) && to == math.Trunc(to)
+	width := (to - from) / float64(count)
+	for i := range bounds {
+		bound := from + width*float64(i+1)
+		if integral {
+			bounds[i] = int64(math.Ceil(bound))
+		} else {
+			bounds[i] = bound
+		}
+	}
+	return bounds, nil
+}
+
+// `boundValue` converts a configured bound of a range to the type
+// expected by the database driver. Dates and timestamps are converted
+// to times.
+func boundValue(value any) any {
+	if text, ok := value.(string); ok {
+		if date, err := time.Parse(time.DateOnly, text); err == nil {
+			return date
+		}
+	}
+	return bindValue(value)
+}
+
+// `conditions` returns the conditions which restrict the rows of the
+// given range of the column, and their arguments.
+func (rng partitionRange) conditions(column string) ([]string, []any) {
+	var conditions []string
+	var args []any
+
+	if rng.from != nil {
+		conditions = append(conditions, fmt.Sprintf("%s.%s >= ?", sourceAlias, column))
+		args = append(args, rng.from)
+	}
+	if rng.to != nil {
+		conditions = append(conditions, fmt.Sprintf("%s.%s < ?", sourceAlias, column))
+		args = append(args, rng.to)
+	}
+
+	if rng.nulls && len(conditions) > 0 {
+		condition := fmt.Sprintf("(%s OR %s.%s IS NULL)", joinConditions(conditions), sourceAlias, column)
+		conditions = []string{condition}
+	}
+	return conditions, args
+}
@@ -0,0 +1,61 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sources
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/tnotstar/datacat/core"
+)
+
+// `newTaskConfig` returns a configuration with a single task named
+// `test`, with the given source.
+func newTaskConfig(sourceType string, args core.Arguments) *core.Config {
+	return &core.Config{
+		Tasks: map[string]core.TaskConfig{
+			"test": {Source: core.SourceConfig{Type: sourceType, Arguments: args}},
+		},
+	}
+}
+
+// `readSource` runs the source of the `test` task of the given
+// configuration, and returns the rows read and the error of the task.
+func readSource(t *testing.T, cfg *core.Config) ([]core.RowMap, error) {
+	t.Helper()
+	src, err := BuildSource(0, cfg, "test")
+	if err != nil {
+		t.Fatalf("BuildSource failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	trk := core.NewTracker("test", cancel)
+
+	var wg sync.WaitGroup
+	var rows []core.RowMap
+	for row := range src.Run(ctx, &wg, trk) {
+		rows = append(rows, row)
+	}
+	wg.Wait()
+	return rows, trk.Err()
+}
@@ -0,0 +1,433 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sources
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tnotstar/datacat/core"
+	"github.com/xuri/excelize/v2"
+)
+
+// `XLSXFileSource` is the concrete implementation of the source interface
+// for Excel workbooks. It reads the cells of a sheet and sends each row
+// of the sheet, or of a range of it, to the output channel.
+type XLSXFileSource struct {
+	// The `id` of the source.
+	id int
+	// The `task` of the task which is running into.
+	task string
+	// The `fileName` of the workbook to be read.
+	fileName string
+	// The `sheet` name, or empty to use the `sheetIndex`.
+	sheet string
+	// The `sheetIndex` of the sheet, from 1.
+	sheetIndex int
+	// The `from` and `to` cells of the range, as column and row numbers
+	// from 1. Zero means unbounded.
+	from, to [2]int
+	// `header` is true if the first row holds the column names.
+	header bool
+	// The `columns` names, overriding the header.
+	columns []string
+	// `formatted` reads the values as displayed, instead of typed.
+	formatted bool
+}
+
+// `IsaXLSXFileSource` returns true if given source type is
+// an Excel workbook.
+func IsaXLSXFileSource(sourceType string) bool {
+	return sourceType == "xlsx-file-source"
+}
+
+// `NewXLSXFileSource` creates a new instance of the XLSX source endpoint.
+//
+// The `id` is the instance of the adapter to be created.
+// The `cfg` is the global configuration object.
+// The `taskName` is the name of the task to be executed.
+func NewXLSXFileSource(id int, cfg core.Configurator, taskName string) (core.Source, error) {
+	sourceConfig, _ := cfg.GetSourceConfig(taskName)
+	args := sourceConfig.Arguments
+
+	fileName, err := args.RequiredString("filename")
+	if err != nil {
+		return nil, err
+	}
+
+	src := &XLSXFileSource{id: id, task: taskName, fileName: fileName, sheetIndex: 1}
+
+	// A number selects the sheet by its position, a text by its name.
+	switch sheet := args["sheet"].(type) {
+	case nil:
+	case string:
+		src.sheet = sheet
+	default:
+		if src.sheetIndex, err = args.Int("sheet", 1); err != nil {
+			return nil, err
+		}
+		if src.sheetIndex < 1 {
+			return nil, fmt.Errorf("Invalid sheet number: %d", src.sheetIndex)
+		}
+	}
+
+	if cells := args.String("range", ""); cells != "" {
+		if src.from, src.to, err = parseCellRange(cells); err != nil {
+			return nil, err
+		}
+	}
+
+	if src.header, err = args.Bool("header", true); err != nil {
+		return nil, err
+	}
+	if src.columns, err = args.Strings("columns"); err != nil {
+		return nil, err
+	}
+	if len(src.columns) > 0 {
+		if err := checkColumns(src.columns); err != nil {
+			return nil, fmt.Errorf("Invalid columns of task '%s': %w", taskName, err)
+		}
+	}
+	if src.formatted, err = args.Bool("formatted", false); err != nil {
+		return nil, err
+	}
+
+	return src, nil
+}
+
+// `parseCellRange` returns the first and last cells of a range like
+// `B2:F100`, or of an open range like `B2`.
+func parseCellRange(cells string) ([2]int, [2]int, error) {
+	var from, to [2]int
+	first, last, bounded := strings.Cut(cells, ":")
+
+	var err error
+	if from[0], from[1], err = excelize.CellNameToCoordinates(first); err != nil {
+		return from, to, fmt.Errorf("Invalid cell range '%s': %w", cells, err)
+	}
+	if bounded {
+		if to[0], to[1], err = excelize.CellNameToCoordinates(last); err != nil {
+			return from, to, fmt.Errorf("Invalid cell range '%s': %w", cells, err)
+		}
+		if to[0] < from[0] || to[1] < from[1] {
+			return from, to, fmt.Errorf("Invalid cell range '%s'", cells)
+		}
+	}
+	return from, to, nil
+}
+
+// `Run` creates a goroutine that reads the rows of the sheet and sends
+// them to an output channel. It returns a channel that will receive the
+// rows read from the sheet.
+func (src *XLSXFileSource) Run(ctx context.Context, wg *sync.WaitGroup, trk *core.Tracker) <-chan core.RowMap {
+	log.Printf("Starting XLSX source for task %s...", src.task)
+	out := make(chan core.RowMap)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(out)
+
+		log.Printf("Reading input file: %s\n", src.fileName)
+		file, err := excelize.OpenFile(src.fileName)
+		if err != nil {
+			trk.Abort("source", fmt.Errorf("Error opening file %s: %w", src.fileName, err))
+			return
+		}
+		defer file.Close()
+
+		sheet := src.sheet
+		if sheet == "" {
+			sheets := file.GetSheetList()
+			if src.sheetIndex > len(sheets) {
+				trk.Abort("source", fmt.Errorf("Missing sheet #%d in file %s", src.sheetIndex, src.fileName))
+				return
+			}
+			sheet = sheets[src.sheetIndex-1]
+		}
+
+		reader, err := newCellReader(file, sheet, src.formatted)
+		if err != nil {
+			trk.Abort("source", fmt.Errorf("Error reading sheet '%s' of file %s: %w", sheet, src.fileName, err))
+			return
+		}
+
+		counter := 0
+		columns := src.columns
+		width := src.width(reader.text)
+		headerPending := src.header
+		first, last := max(src.from[1], 1), src.to[1]
+		if last == 0 || last > len(reader.text) {
+			last = len(reader.text)
+		}
+		for line := first; line <= last; line++ {
+			cells := src.cells(reader.text[line-1], width)
+			if isEmptyRow(cells) {
+				continue
+			}
+
+			if len(columns) == 0 {
+				// Later columns would overwrite the fields of earlier
+				// ones with the same name.
+				columns = src.columnNames(cells)
+				if err := checkColumns(columns); err != nil {
+					trk.Abort("source", fmt.Errorf("Invalid columns of sheet '%s' of file %s: %w", sheet, src.fileName, err))
+					return
+				}
+			}
+			if headerPending {
+				headerPending = false
+				continue
+			}
+
+			row := make(core.RowMap, len(columns))
+			for i, name := range columns {
+				// The configured columns may outnumber the used ones.
+				var text string
+				if i < len(cells) {
+					text = cells[i]
+				}
+				value, err := reader.value(line, src.column(i), text)
+				if err != nil {
+					trk.Abort("source", fmt.Errorf("Error reading sheet '%s' of file %s: %w", sheet, src.fileName, err))
+					return
+				}
+				row[name] = value
+			}
+
+			if !trk.Read(row) {
+				continue
+			}
+			if !core.Send(ctx, out, row) {
+				return
+			}
+			counter += 1
+		}
+
+		log.Printf("Read %d row(s) from the input file", counter)
+	}()
+
+	log.Println("XLSX source for task:", src.task, ", started")
+	return out
+}
+
+// `column` returns the number of the sheet column of the given range
+// column, from 1.
+func (src *XLSXFileSource) column(index int) int {
+	return max(src.from[0], 1) + index
+}
+
+// `width` returns the number of columns of the range, up to the last
+// used column of the sheet if the range is open.
+func (src *XLSXFileSource) width(texts [][]string) int {
+	last := src.to[0]
+	if last == 0 {
+		for _, row := range texts {
+			last = max(last, len(row))
+		}
+	}
+	return max(last-max(src.from[0], 1)+1, 0)
+}
+
+// `cells` returns the texts of the given sheet row within the range.
+func (src *XLSXFileSource) cells(texts []string, width int) []string {
+	first := max(src.from[0], 1)
+	cells := make([]string, width)
+	for i := range cells {
+		if first+i <= len(texts) {
+			cells[i] = texts[first+i-1]
+		}
+	}
+	return cells
+}
+
+// `columnNames` returns the column names from the given header row, or
+// the letters of the columns if the sheet has no header. A header cell
+// without a name is named by its letter as well.
+func (src *XLSXFileSource) columnNames(cells []string) []string {
+	names := make([]string, len(cells))
+	for i := range cells {
+		if src.header && strings.TrimSpace(cells[i]) != "" {
+			names[i] = strings.TrimSpace(cells[i])
+		} else {
+			names[i], _ = excelize.ColumnNumberToName(src.column(i))
+		}
+	}
+	return names
+}
+
+// `isEmptyRow` returns true if all the given cells are empty.
+func isEmptyRow(cells []string) bool {
+	for _, cell := range cells {
+		if cell != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// A `cellReader` reads the values of the cells of a sheet.
+type cellReader struct {
+	file  *excelize.File
+	sheet string
+	// The `text` of the cells as displayed, by row and column.
+	text [][]string
+	// The `raw` values of the cells, by row and column, unless the
+	// values are read as displayed.
+	raw [][]string
+	// `date1904` is true if the dates of the workbook start in 1904.
+	date1904 bool
+	// The `dates` caches whether the cells of a style are dates.
+	dates map[int]bool
+}
+
+// `newCellReader` creates a new reader of the cells of the given sheet.
+// If `formatted` is true, the values are read as displayed.
+func newCellReader(file *excelize.File, sheet string, formatted bool) (*cellReader, error) {
+	reader := &cellReader{file: file, sheet: sheet, dates: make(map[int]bool)}
+
+	var err error
+	if reader.text, err = file.GetRows(sheet); err != nil {
+		return nil, err
+	}
+	if formatted {
+		return reader, nil
+	}
+
+	if reader.raw, err = file.GetRows(sheet, excelize.Options{RawCellValue: true}); err != nil {
+		return nil, err
+	}
+	props, err := file.GetWorkbookProps()
+	if err != nil {
+		return nil, err
+	}
+	reader.date1904 = props.Date1904 != nil && *props.Date1904
+	return reader, nil
+}
+
+// `value` returns the value of the cell at the given sheet row and
+// column, with the given text. Empty cells are null when the values
+// are typed.
+func (reader *cellReader) value(line int, column int, text string) (any, error) {
+	if reader.raw == nil {
+		return text, nil
+	}
+	if text == "" {
+		return nil, nil
+	}
+
+	raw := text
+	if line <= len(reader.raw) && column <= len(reader.raw[line-1]) {
+		raw = reader.raw[line-1][column-1]
+	}
+
+	cell, _ := excelize.CoordinatesToCellName(column, line)
+	cellType, err := reader.file.GetCellType(reader.sheet, cell)
+	if err != nil {
+		return nil, err
+	}
+
+	switch cellType {
+	case excelize.CellTypeBool:
+		return raw == "1" || strings.EqualFold(raw, "true"), nil
+	case excelize.CellTypeDate:
+		if value, err := time.Parse(time.RFC3339Nano, raw); err == nil {
+			return value, nil
+		}
+	case excelize.CellTypeNumber, excelize.CellTypeUnset:
+		number, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return text, nil
+		}
+		isDate, err := reader.isDate(cell)
+		if err != nil {
+			return nil, err
+		}
+		if isDate {
+			return excelize.ExcelDateToTime(number, reader.date1904)
+		}
+		if number == math.Trunc(number) && math.Abs(number) < 1<<53 {
+			return int64(number), nil
+		}
+		return number, nil
+	}
+	return text, nil
+}
+
+// `isDate` returns true if the number format of the given cell is a
+// date or time format.
+func (reader *cellReader) isDate(cell string) (bool, error) {
+	styleID, err := reader.file.GetCellStyle(reader.sheet, cell)
+	if err != nil || styleID == 0 {
+		return false, err
+	}
+	if isDate, ok := reader.dates[styleID]; ok {
+		return isDate, nil
+	}
+
+	style, err := reader.file.GetStyle(styleID)
+	if err != nil {
+		return false, err
+	}
+	isDate := isDateFormat(style.NumFmt, style.CustomNumFmt)
+	reader.dates[styleID] = isDate
+	return isDate, nil
+}
+
+// `isDateFormat` returns true if the given built-in number format, or
+// custom format code, formats a date or a time.
+func isDateFormat(numFmt int, custom *string) bool {
+	if custom == nil {
+		return (numFmt >= 14 && numFmt <= 22) || (numFmt >= 27 && numFmt <= 36) ||
+			(numFmt >= 45 && numFmt <= 47) || (numFmt >= 50 && numFmt <= 58)
+	}
+
+	// Quoted texts, escaped characters and bracketed sections like
+	// colors don't count.
+	code := strings.ToLower(*custom)
+	for i := 0; i < len(code); i++ {
+		switch code[i] {
+		case '"':
+			if end := strings.IndexByte(code[i+1:], '"'); end >= 0 {
+				i += end + 1
+			}
+		case '\\', '_', '*':
+			i++
+		case '[':
+			if end := strings.IndexByte(code[i:], ']'); end >= 0 {
+				section := code[i+1 : i+end]
+				if strings.Trim(section, "hms") == "" {
+					return true
+				}
+				i += end
+			}
+		case 'y', 'm', 'd', 'h', 's':
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sources
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tnotstar/datacat/core"
+	"github.com/xuri/excelize/v2"
+)
+
+func TestXLSXMoreColumnsThanCells(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "narrow.xlsx")
+	file := excelize.NewFile()
+	file.SetSheetRow("Sheet1", "A1", &[]any{"ann", 30})
+	file.SetSheetRow("Sheet1", "A2", &[]any{"bob"})
+	if err := file.SaveAs(fileName); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := newTaskConfig("xlsx-file-source", core.Arguments{
+		"filename": fileName,
+		"header":   false,
+		"columns":  []any{"name", "age", "city", "country"},
+	})
+	rows, err := readSource(t, cfg)
+	if err != nil {
+		t.Fatalf("reading failed: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("read %d rows, want 2", len(rows))
+	}
+	if rows[0]["name"] != "ann" || rows[0]["age"] != int64(30) && rows[0]["age"] != 30.0 {
+		t.Errorf("first row = %v", rows[0])
+	}
+	for _, row := range rows {
+		if value, ok := row["country"]; !ok || value != nil {
+			t.Errorf("missing cell of row %v isn't null", row)
+		}
+	}
+}
+
+func TestXLSXDuplicateColumns(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "duplicate.xlsx")
+	file := excelize.NewFile()
+	// The empty header cell is named by its letter, `B`.
+	file.SetSheetRow("Sheet1", "A1", &[]any{"name", "", "B"})
+	file.SetSheetRow("Sheet1", "A2", &[]any{"ann", 1, 2})
+	if err := file.SaveAs(fileName); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := newTaskConfig("xlsx-file-source", core.Arguments{"filename": fileName})
+	if _, err := readSource(t, cfg); err == nil || !strings.Contains(err.Error(), "duplicate column name 'B'") {
+		t.Errorf("Error of duplicate columns = %v", err)
+	}
+
+	cfg = newTaskConfig("xlsx-file-source", core.Arguments{"filename": fileName, "columns": []any{"a", "a"}})
+	if _, err := BuildSource(0, cfg, "test"); err == nil {
+		t.Error("BuildSource succeeded with duplicate configured columns")
+	}
+}
@@ -21,7 +21,7 @@
 package targets
 
 import (
-	"log"
+	"fmt"
 
 	"github.com/tnotstar/datacat/core"
 )
@@ -32,20 +32,35 @@ import (
 // The `id` is the index of the adapter to be created.
 // The `cfg` is the global configuration object.
 // The `taskName` is the name of the task to be executed.
-func BuildTarget(id int, cfg core.Configurator, taskName string) core.Target {
+func BuildTarget(id int, cfg core.Configurator, taskName string) (core.Target, error) {
 	targetConfig, err := cfg.GetTargetConfig(taskName)
 	if err != nil {
-		log.Fatalf("Error getting source configuration for task %s: %s", taskName, err)
+		return nil, fmt.Errorf("Error getting target configuration for task %s: %w", taskName, err)
 	}
 
 	if IsaJSONLFileTarget(targetConfig.Type) {
 		return NewJSONLFileTarget(id, cfg, taskName)
 	}
 
+	if IsaCSVFileTarget(targetConfig.Type) {
+		return NewCSVFileTarget(id, cfg, taskName)
+	}
+
+	if IsaXLSXFileTarget(targetConfig.Type) {
+		return NewXLSXFileTarget(id, cfg, taskName)
+	}
+
+	if IsaParquetFileTarget(targetConfig.Type) {
+		return NewParquetFileTarget(id, cfg, taskName)
+	}
+
+	if IsaDatabaseTableTarget(targetConfig.Type) {
+		return NewDatabaseTableTarget(id, cfg, taskName)
+	}
+
 	if IsaHttpRequestTarget(targetConfig.Type) {
 		return NewHttpRequestTarget(id, cfg, taskName)
 	}
 
-	log.Fatalf("Invalid target endpoint type %s", targetConfig.Type)
-	return nil
+	return nil, fmt.Errorf("Invalid target endpoint type %s", targetConfig.Type)
 }
@@ -0,0 +1,673 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package targets
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tnotstar/datacat/core"
+)
+
+// The quoting policies of a CSV file target.
+const (
+	// `QuoteMinimal` quotes only the fields with special characters.
+	QuoteMinimal = "minimal"
+	// `QuoteAll` quotes all the fields, except nulls.
+	QuoteAll = "all"
+	// `QuoteNonNumeric` quotes all the fields, except numbers, booleans
+	// and nulls.
+	QuoteNonNumeric = "nonnumeric"
+	// `QuoteNone` never quotes fields, and fails the rows with special
+	// characters.
+	QuoteNone = "none"
+)
+
+// The behaviours of a CSV file target on rows which don't match its columns.
+const (
+	// `FieldsError` fails the row.
+	FieldsError = "error"
+	// `FieldsIgnore` ignores the extra fields, or writes the missing
+	// ones as nulls.
+	FieldsIgnore = "ignore"
+	// `FieldsAdd` adds the extra fields as new columns.
+	FieldsAdd = "add"
+)
+
+// `CSVFileTarget` is the concrete implementation of the target interface
+// for delimited text files (CSV, TSV...). It reads data from a given
+// processing channel and writes each row as a record of the file.
+type CSVFileTarget struct {
+	// The `id` of the target.
+	id int
+	// The `task` of the task which is running into.
+	task string
+	// The `fileName` of the file to be created.
+	fileName string
+	// The `batchSize` of the batch to be written.
+	batchSize int
+	// The `columns` of the file, in order. If empty, they are taken from
+	// the fields of the first row, sorted by name.
+	columns []string
+	// `header` is true if the column names are written as first record.
+	header bool
+	// The `delimiter` between fields.
+	delimiter rune
+	// The `quote` around fields.
+	quote rune
+	// The `quoting` policy.
+	quoting string
+	// The `null` representation.
+	null string
+	// The `dateFormat` layout of times.
+	dateFormat string
+	// The `numberFormat` of floating point numbers, as a `fmt` verb.
+	numberFormat string
+	// The `decimalSeparator` of numbers.
+	decimalSeparator string
+	// The behaviour on `extraFields` not in the columns.
+	extraFields string
+	// The behaviour on `missingFields` of the columns.
+	missingFields string
+	// The `compression` format of the file.
+	compression string
+	// The `level` of compression.
+	level int
+}
+
+// `IsaCSVFileTarget` returns true if given target type
+// is a delimited text file.
+func IsaCSVFileTarget(targetType string) bool {
+	return targetType == "csv-file-target"
+}
+
+// `NewCSVFileTarget` creates a new instance of the CSV target endpoint.
+//
+// The `cfg` is the global configuration object.
+// The `taskName` is the name of the task to be executed.
+func NewCSVFileTarget(id int, cfg core.Configurator, taskName string) (core.Target, error) {
+	targetConfig, _ := cfg.GetTargetConfig(taskName)
+	args := targetConfig.Arguments
+
+	fileName, err := args.RequiredString("filename")
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.Contains(fileName, "%") && targetConfig.GetParallelism() > 1 {
+		return nil, fmt.Errorf("Filename '%s' needs a '%%d' pattern for parallel instances", fileName)
+	}
+
+	batchSize, err := args.Int("batchsize", defaultBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
+	columns, err := args.Strings("columns")
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := args.Bool("header", true)
+	if err != nil {
+		return nil, err
+	}
+
+	defaultDelimiter := ","
+	if strings.EqualFold(filepath.Ext(strings.TrimSuffix(core.TrimCompressionExt(fileName), "%d")), ".tsv") {
+		defaultDelimiter = "\t"
+	}
+	delimiter, err := args.Char("delimiter", defaultDelimiter)
+	if err != nil {
+		return nil, err
+	}
+	quote, err := args.Char("quote", `"`)
+	if err != nil {
+		return nil, err
+	}
+	if delimiter == 0 || delimiter == quote || delimiter == '\n' || delimiter == '\r' {
+		return nil, fmt.Errorf("Invalid delimiter for task '%s': %q", taskName, delimiter)
+	}
+
+	quoting := args.String("quoting", QuoteMinimal)
+	switch quoting {
+	case QuoteMinimal, QuoteAll, QuoteNonNumeric:
+		if quote == 0 {
+			return nil, fmt.Errorf("Quoting policy '%s' needs a quote character", quoting)
+		}
+	case QuoteNone:
+	default:
+		return nil, fmt.Errorf("Invalid quoting policy: %s", quoting)
+	}
+
+	extraFields := args.String("extrafields", FieldsIgnore)
+	if extraFields != FieldsError && extraFields != FieldsIgnore && extraFields != FieldsAdd {
+		return nil, fmt.Errorf("Invalid extra fields handling: %s", extraFields)
+	}
+	if extraFields == FieldsAdd && targetConfig.GetParallelism() > 1 {
+		return nil, fmt.Errorf("Extra fields handling '%s' can't be used by parallel instances", extraFields)
+	}
+
+	missingFields := args.String("missingfields", FieldsIgnore)
+	if missingFields != FieldsError && missingFields != FieldsIgnore {
+		return nil, fmt.Errorf("Invalid missing fields handling: %s", missingFields)
+	}
+
+	compression, level, err := getCompression(args, fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CSVFileTarget{
+		id:               id,
+		task:             taskName,
+		fileName:         fileName,
+		batchSize:        batchSize,
+		columns:          columns,
+		header:           header,
+		delimiter:        delimiter,
+		quote:            quote,
+		quoting:          quoting,
+		null:             args.String("nullvalue", ""),
+		dateFormat:       args.String("dateformat", time.RFC3339),
+		numberFormat:     args.String("numberformat", ""),
+		decimalSeparator: args.String("decimalseparator", "."),
+		extraFields:      extraFields,
+		missingFields:    missingFields,
+		compression:      compression,
+		level:            level,
+	}, nil
+}
+
+// `Run` creates a goroutine that reads rows from the input channel and
+// writes them to the target file.
+func (tgt *CSVFileTarget) Run(ctx context.Context, wg *sync.WaitGroup, trk *core.Tracker, in <-chan core.RowMap) {
+	log.Printf("* Creating instance #%d of CSV file target for task '%s'...", tgt.id, tgt.task)
+	stage := fmt.Sprintf("target#%d", tgt.id)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		fileName := tgt.fileName
+		if strings.Contains(fileName, "%") {
+			fileName = fmt.Sprintf(tgt.fileName, tgt.id)
+		}
+		log.Printf(" - Creating CSV target file: '%s'...", fileName)
+
+		file, err := createFile(fileName, trk)
+		if err != nil {
+			trk.Abort(stage, fmt.Errorf("Error creating file %s: %w", fileName, err))
+			return
+		}
+
+		columns := append([]string(nil), tgt.columns...)
+		writeHeader := tgt.header
+		if trk.Resuming() {
+			existing, err := readHeader(fileName, tgt.delimiter, tgt.compression)
+			if err != nil {
+				file.Close()
+				trk.Abort(stage, fmt.Errorf("Error reading header of file %s: %w", fileName, err))
+				return
+			}
+			if existing != nil {
+				writeHeader = false
+				if tgt.header && len(columns) == 0 {
+					columns = existing
+				}
+			}
+		}
+		compressor, err := core.NewCompressor(file, tgt.compression, tgt.level)
+		if err != nil {
+			file.Close()
+			trk.Abort(stage, fmt.Errorf("Error creating file %s: %w", fileName, err))
+			return
+		}
+
+		// Rows are acknowledged once they have been flushed to the file.
+		writer := bufio.NewWriter(compressor)
+		batch := make([]core.RowMap, 0, tgt.batchSize)
+		flush := func() error {
+			if err := writer.Flush(); err != nil {
+				return err
+			}
+			if err := compressor.Flush(); err != nil {
+				return err
+			}
+			size, err := file.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return err
+			}
+			trk.Flushed(batch, fileName, size)
+			batch = batch[:0]
+			return nil
+		}
+
+		added := false
+		defer func() {
+			if err := flush(); err != nil {
+				trk.Abort(stage, fmt.Errorf("Error flushing file %s: %w", fileName, err))
+			}
+			if err := compressor.Close(); err != nil {
+				trk.Abort(stage, fmt.Errorf("Error closing file %s: %w", fileName, err))
+			}
+			if err := file.Close(); err != nil {
+				trk.Abort(stage, fmt.Errorf("Error closing file %s: %w", fileName, err))
+			}
+			if added {
+				size, err := tgt.rewriteFile(fileName, columns)
+				if err != nil {
+					trk.Abort(stage, fmt.Errorf("Error rewriting file %s: %w", fileName, err))
+					return
+				}
+				trk.Flushed(nil, fileName, size)
+			}
+		}()
+
+		writeColumns := func() error {
+			if !writeHeader {
+				return nil
+			}
+			writeHeader = false
+			_, err := writer.WriteString(tgt.formatHeader(columns))
+			return err
+		}
+		if len(columns) > 0 {
+			if err := writeColumns(); err != nil {
+				trk.Abort(stage, fmt.Errorf("Error writing header: %w", err))
+				return
+			}
+		}
+
+		counter := 0
+		for row := range in {
+			if ctx.Err() != nil {
+				break
+			}
+
+			if len(columns) == 0 {
+				columns = sortedKeys(row)
+			}
+			if err := writeColumns(); err != nil {
+				trk.Abort(stage, fmt.Errorf("Error writing header: %w", err))
+				return
+			}
+
+			extra, err := tgt.checkFields(row, columns)
+			if err != nil {
+				trk.Fail(stage, row, err)
+				continue
+			}
+			if len(extra) > 0 {
+				columns = append(columns, extra...)
+				added = true
+			}
+
+			record, err := tgt.formatRecord(row, columns)
+			if err != nil {
+				trk.Fail(stage, row, err)
+				continue
+			}
+			if _, err := writer.WriteString(record); err != nil {
+				trk.Abort(stage, fmt.Errorf("Error writing data row: %w", err))
+				return
+			}
+
+			batch = append(batch, row)
+			if len(batch) >= tgt.batchSize {
+				if err := flush(); err != nil {
+					trk.Abort(stage, fmt.Errorf("Error flushing file %s: %w", fileName, err))
+					return
+				}
+			}
+			counter++
+		}
+
+		log.Printf(" - Written %d row(s) to the CSV target file: '%s'...", counter, fileName)
+	}()
+
+	log.Printf("* CSV target with filename pattern '%s' started successfully!", tgt.fileName)
+}
+
+// `checkFields` verifies the fields of the row against the columns. It
+// returns the extra fields to be added as new columns, sorted by name.
+func (tgt *CSVFileTarget) checkFields(row core.RowMap, columns []string) ([]string, error) {
+	if tgt.missingFields == FieldsError {
+		for _, column := range columns {
+			if _, ok := row[column]; !ok {
+				return nil, fmt.Errorf("Missing field '%s'", column)
+			}
+		}
+	}
+
+	if tgt.extraFields == FieldsIgnore {
+		return nil, nil
+	}
+
+	known := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		known[column] = true
+	}
+	var extra []string
+	for key := range row.Data() {
+		if !known[key] {
+			extra = append(extra, key)
+		}
+	}
+	if len(extra) == 0 {
+		return nil, nil
+	}
+
+	sort.Strings(extra)
+	if tgt.extraFields == FieldsError {
+		return nil, fmt.Errorf("Unexpected field(s): %s", strings.Join(extra, ", "))
+	}
+	return extra, nil
+}
+
+// `formatHeader` returns the header record with the given columns.
+func (tgt *CSVFileTarget) formatHeader(columns []string) string {
+	fields := make([]string, len(columns))
+	for i, column := range columns {
+		fields[i] = column
+		if tgt.quoting != QuoteNone && (tgt.quoting != QuoteMinimal || tgt.needsQuotes(column)) {
+			fields[i] = tgt.quoteField(column)
+		}
+	}
+	return strings.Join(fields, string(tgt.delimiter)) + "\n"
+}
+
+// `formatRecord` returns the record with the fields of the given row.
+func (tgt *CSVFileTarget) formatRecord(row core.RowMap, columns []string) (string, error) {
+	var record strings.Builder
+	for i, column := range columns {
+		if i > 0 {
+			record.WriteRune(tgt.delimiter)
+		}
+
+		value := row[column]
+		if value == nil {
+			record.WriteString(tgt.null)
+			continue
+		}
+
+		field, numeric, err := tgt.formatValue(value)
+		if err != nil {
+			return "", fmt.Errorf("Error formatting field '%s': %w", column, err)
+		}
+
+		switch {
+		case tgt.quoting == QuoteNone:
+			if tgt.needsQuotes(field) {
+				return "", fmt.Errorf("Field '%s' needs quotes: %q", column, field)
+			}
+		case tgt.quoting == QuoteAll,
+			tgt.quoting == QuoteNonNumeric && !numeric,
+			tgt.quoting == QuoteMinimal && tgt.needsQuotes(field):
+			field = tgt.quoteField(field)
+		}
+		record.WriteString(field)
+	}
+	record.WriteByte('\n')
+	return record.String(), nil
+}
+
+// `formatValue` returns the text of a field value, and true if it's a
+// number or a boolean.
+func (tgt *CSVFileTarget) formatValue(value any) (string, bool, error) {
+	switch value := value.(type) {
+	case string:
+		return value, false, nil
+	case []byte:
+		return string(value), false, nil
+	case bool:
+		return strconv.FormatBool(value), true, nil
+	case time.Time:
+		return value.Format(tgt.dateFormat), false, nil
+	case float64:
+		return tgt.formatNumber(value), true, nil
+	case float32:
+		return tgt.formatNumber(float64(value)), true, nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(value), true, nil
+	case json.Number:
+		return tgt.formatExactNumber(value), true, nil
+	case map[string]any, []any:
+		buffer, err := json.Marshal(value)
+		return string(buffer), false, err
+	}
+	return fmt.Sprint(value), false, nil
+}
+
+// `formatNumber` returns the text of a floating point number.
+func (tgt *CSVFileTarget) formatNumber(value float64) string {
+	text := strconv.FormatFloat(value, 'f', -1, 64)
+	if tgt.numberFormat != "" {
+		text = fmt.Sprintf(tgt.numberFormat, value)
+	}
+	if tgt.decimalSeparator != "." {
+		text = strings.Replace(text, ".", tgt.decimalSeparator, 1)
+	}
+	return text
+}
+
+// `numberPrecision` matches the precision of the decimals of a number
+// format, like `%.2f`.
+var numberPrecision = regexp.MustCompile(`%[-+ #0]*\d*\.(\d+)[fF]`)
+
+// `formatExactNumber` returns the text of an exact number, like the
+// decimals read from databases. Integers are kept as they are, like the
+// other integers, while the decimals are rounded in decimal, not in
+// binary like floats, to the precision of the number format.
+func (tgt *CSVFileTarget) formatExactNumber(value json.Number) string {
+	text := value.String()
+	if _, err := value.Int64(); err != nil && tgt.numberFormat != "" {
+		if number, ok := new(big.Rat).SetString(text); ok {
+			if match := numberPrecision.FindStringSubmatch(tgt.numberFormat); match != nil {
+				digits, _ := strconv.Atoi(match[1])
+				number.SetString(number.FloatString(digits))
+			}
+			text = fmt.Sprintf(tgt.numberFormat, new(big.Float).SetPrec(256).SetRat(number))
+		}
+	}
+	if tgt.decimalSeparator != "." {
+		text = strings.Replace(text, ".", tgt.decimalSeparator, 1)
+	}
+	return text
+}
+
+// `needsQuotes` returns true if the field has special characters.
+func (tgt *CSVFileTarget) needsQuotes(field string) bool {
+	if field == "" {
+		return false
+	}
+	return strings.ContainsRune(field, tgt.delimiter) ||
+		tgt.quote != 0 && strings.ContainsRune(field, tgt.quote) ||
+		strings.ContainsAny(field, "\r\n") ||
+		field[0] == ' ' || field[0] == '\t'
+}
+
+// `quoteField` returns the field between quotes, doubling the quotes
+// inside it.
+func (tgt *CSVFileTarget) quoteField(field string) string {
+	quote := string(tgt.quote)
+	return quote + strings.ReplaceAll(field, quote, quote+quote) + quote
+}
+
+// `sortedKeys` returns the keys of the row sorted by name.
+func sortedKeys(row core.RowMap) []string {
+	keys := make([]string, 0, len(row))
+	for key := range row.Data() {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// `readHeader` returns the column names of an existing file, or nil if
+// it doesn't exist or it's empty.
+func readHeader(fileName string, delimiter rune, compression string) ([]string, error) {
+	file, err := os.Open(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	decompressor, err := core.NewDecompressor(file, compression)
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer decompressor.Close()
+
+	reader := csv.NewReader(decompressor)
+	reader.Comma = delimiter
+	reader.LazyQuotes = true
+	columns, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	return columns, err
+}
+
+// `rewriteFile` rewrites the given file after new columns have been
+// added: the header, if any, is replaced with the given columns and the
+// records written before are padded with nulls. The file is compressed
+// again if needed. It returns the new size of the file.
+func (tgt *CSVFileTarget) rewriteFile(fileName string, columns []string) (int64, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	decompressor, err := core.NewDecompressor(file, tgt.compression)
+	if err != nil {
+		return 0, err
+	}
+	defer decompressor.Close()
+
+	reader := bufio.NewReader(decompressor)
+	if tgt.header {
+		if _, _, err := tgt.readRecord(reader); err != nil && !errors.Is(err, io.EOF) {
+			return 0, err
+		}
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(fileName), filepath.Base(fileName)+".*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(temp.Name())
+
+	compressor, err := core.NewCompressor(temp, tgt.compression, tgt.level)
+	if err != nil {
+		temp.Close()
+		return 0, err
+	}
+	writer := bufio.NewWriter(compressor)
+	if tgt.header {
+		writer.WriteString(tgt.formatHeader(columns))
+	}
+	for {
+		record, fields, err := tgt.readRecord(reader)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			temp.Close()
+			return 0, err
+		}
+		writer.WriteString(record)
+		for ; fields < len(columns); fields++ {
+			writer.WriteRune(tgt.delimiter)
+			writer.WriteString(tgt.null)
+		}
+		writer.WriteByte('\n')
+	}
+	if err := writer.Flush(); err != nil {
+		temp.Close()
+		return 0, err
+	}
+	if err := compressor.Close(); err != nil {
+		temp.Close()
+		return 0, err
+	}
+	size, err := temp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		temp.Close()
+		return 0, err
+	}
+	if err := temp.Close(); err != nil {
+		return 0, err
+	}
+	return size, os.Rename(temp.Name(), fileName)
+}
+
+// `readRecord` returns the next record of the reader, without its line
+// break, and its number of fields. The delimiters and line breaks between
+// quotes are part of the fields.
+func (tgt *CSVFileTarget) readRecord(reader *bufio.Reader) (string, int, error) {
+	var record strings.Builder
+	fields, quoted := 1, false
+	for {
+		line, err := reader.ReadString('\n')
+		for _, char := range line {
+			switch {
+			case tgt.quote != 0 && char == tgt.quote:
+				quoted = !quoted
+			case char == tgt.delimiter && !quoted:
+				fields++
+			}
+		}
+		record.WriteString(line)
+
+		if errors.Is(err, io.EOF) && record.Len() > 0 {
+			err = nil
+		} else if err == nil && quoted {
+			continue
+		}
+		return strings.TrimSuffix(record.String(), "\n"), fields, err
+	}
+}
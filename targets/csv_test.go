@@ -0,0 +1,113 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package targets
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/tnotstar/datacat/core"
+)
+
+func TestCSVFormatExactNumber(t *testing.T) {
+	tests := []struct {
+		format    string
+		separator string
+		value     json.Number
+		want      string
+	}{
+		{"", ".", "12345678901234567890.123456789", "12345678901234567890.123456789"},
+		{"%.2f", ".", "12.345", "12.35"},
+		{"%.2f", ",", "0.5", "0,50"},
+		{"%.2f", ".", "42", "42"},
+		{"%.3f", ".", "98765432109876543210.4567", "98765432109876543210.457"},
+	}
+	for _, test := range tests {
+		tgt := &CSVFileTarget{numberFormat: test.format, decimalSeparator: test.separator}
+		text, isNumber, err := tgt.formatValue(test.value)
+		if err != nil || !isNumber || text != test.want {
+			t.Errorf("formatValue(%s) with %q = %q, %v, %v, want %q", test.value, test.format, text, isNumber, err, test.want)
+		}
+	}
+}
+
+// `writeCSV` writes the given rows with a CSV file target with the given
+// arguments, and returns the content of the file.
+func writeCSV(t *testing.T, args core.Arguments, rows ...core.RowMap) string {
+	t.Helper()
+	fileName := filepath.Join(t.TempDir(), "output.csv")
+	args["filename"] = fileName
+	cfg := &core.Config{
+		Tasks: map[string]core.TaskConfig{
+			"test": {Target: core.TargetConfig{Type: "csv-file-target", Arguments: args}},
+		},
+	}
+	tgt, err := BuildTarget(0, cfg, "test")
+	if err != nil {
+		t.Fatalf("BuildTarget failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	trk := core.NewTracker("test", cancel)
+
+	var wg sync.WaitGroup
+	in := make(chan core.RowMap)
+	tgt.Run(ctx, &wg, trk, in)
+	for _, row := range rows {
+		in <- row
+	}
+	close(in)
+	wg.Wait()
+	if err := trk.Err(); err != nil {
+		t.Fatalf("Target failed: %v", err)
+	}
+
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestCSVAddedFieldsPadRecords(t *testing.T) {
+	rows := []core.RowMap{
+		{"a": 1},
+		{"a": "x,\ny", "b": 2},
+		{"a": 3, "c": "z"},
+	}
+
+	content := writeCSV(t, core.Arguments{"extrafields": "add", "batchsize": 1}, rows...)
+	want := "a,b,c\n1,,\n\"x,\ny\",2,\n3,,z\n"
+	if content != want {
+		t.Errorf("File content = %q, want %q", content, want)
+	}
+
+	content = writeCSV(t, core.Arguments{"extrafields": "add", "header": false, "nullvalue": "NULL"}, rows...)
+	want = "1,NULL,NULL\n\"x,\ny\",2,NULL\n3,NULL,z\n"
+	if content != want {
+		t.Errorf("File content without header = %q, want %q", content, want)
+	}
+}
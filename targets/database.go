@@ -0,0 +1,425 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package targets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/tnotstar/datacat/core"
+
+	_ "github.com/denisenkom/go-mssqldb"
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "github.com/mattn/go-sqlite3"
+	_ "github.com/sijms/go-ora/v2"
+)
+
+// `DatabaseTableTarget` is the concrete implementation of the target
+// interface for database tables. It reads data from a given processing
+// channel and inserts or merges each row into a table, in batches of
+// rows written inside a transaction.
+type DatabaseTableTarget struct {
+	// The `id` of the target.
+	id int
+	// The `task` of the task which is running into.
+	task string
+	// The `database` name in the configuration.
+	database string
+	// The `config` of the database connection.
+	config *core.DatabaseConfig
+	// The `dialect` of the database.
+	dialect Dialect
+	// The `table` name.
+	table string
+	// The `columns` of the table to be written. If empty, they are taken
+	// from the fields of the first row, sorted by name.
+	columns []string
+	// The `fields` of the rows written to each column.
+	fields []string
+	// The `keys` columns of an upsert.
+	keys []string
+	// `upsert` merges the rows by their key columns.
+	upsert bool
+	// `truncate` deletes all the rows of the table before loading it.
+	truncate bool
+	// The `batchSize` of the rows written in a transaction.
+	batchSize int
+}
+
+// A `truncation` of a table, shared by the instances of a target.
+type truncation struct {
+	once sync.Once
+	err  error
+}
+
+// The write modes of a database table target.
+const (
+	// `ModeInsert` inserts the rows.
+	ModeInsert = "insert"
+	// `ModeUpsert` inserts the new rows and updates the existing ones.
+	ModeUpsert = "upsert"
+)
+
+// `IsaDatabaseTableTarget` returns true if given target type
+// is a database table.
+func IsaDatabaseTableTarget(targetType string) bool {
+	return targetType == "database-table-target"
+}
+
+// `NewDatabaseTableTarget` creates a new instance of the database table
+// target endpoint.
+//
+// The `id` is the instance of the target to be created.
+// The `cfg` is the global configuration object.
+// The `taskName` is the name of the task to be executed.
+func NewDatabaseTableTarget(id int, cfg core.Configurator, taskName string) (core.Target, error) {
+	targetConfig, _ := cfg.GetTargetConfig(taskName)
+	args := targetConfig.Arguments
+
+	dbName, err := args.RequiredString("database")
+	if err != nil {
+		return nil, err
+	}
+
+	dbConfig, err := cfg.GetDatabaseConfig(dbName)
+	if err != nil {
+		return nil, fmt.Errorf("Can't get configuration of database '%s' for task '%s': %w", dbName, taskName, err)
+	}
+
+	dialect, err := GetDialect(dbConfig.Driver)
+	if err != nil {
+		return nil, err
+	}
+
+	table, err := args.RequiredString("table")
+	if err != nil {
+		return nil, err
+	}
+
+	mode := args.String("mode", ModeInsert)
+	if mode != ModeInsert && mode != ModeUpsert {
+		return nil, fmt.Errorf("Invalid database write mode: %s", mode)
+	}
+
+	keys, err := args.Strings("keys")
+	if err != nil {
+		return nil, err
+	}
+	if mode == ModeUpsert && len(keys) == 0 {
+		return nil, errors.New("Missing required argument 'keys' for upsert mode")
+	}
+
+	columns, fields, err := getColumnMapping(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) > 0 {
+		if err := checkKeys(keys, columns); err != nil {
+			return nil, err
+		}
+	}
+
+	truncate, err := args.Bool("truncate", false)
+	if err != nil {
+		return nil, err
+	}
+
+	batchSize, err := args.Int("batchsize", defaultBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
+	return &DatabaseTableTarget{
+		id:        id,
+		task:      taskName,
+		database:  dbName,
+		config:    dbConfig,
+		dialect:   dialect,
+		table:     table,
+		columns:   columns,
+		fields:    fields,
+		keys:      keys,
+		upsert:    mode == ModeUpsert,
+		truncate:  truncate,
+		batchSize: batchSize,
+	}, nil
+}
+
+// `Run` creates a goroutine that reads rows from the input channel and
+// writes them to the database table.
+func (tgt *DatabaseTableTarget) Run(ctx context.Context, wg *sync.WaitGroup, trk *core.Tracker, in <-chan core.RowMap) {
+	log.Printf("* Creating instance #%d of database table target for task '%s'...", tgt.id, tgt.task)
+	stage := fmt.Sprintf("target#%d", tgt.id)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		log.Printf(" - Opening a connection to the database: '%s'...", tgt.database)
+		db, err := core.OpenDatabase(ctx, tgt.config)
+		if err != nil {
+			if ctx.Err() == nil {
+				trk.Abort(stage, fmt.Errorf("Error opening connection to database: %w", err))
+			}
+			return
+		}
+		defer db.Close()
+
+		if tgt.truncate && !trk.Resuming() {
+			if err := tgt.truncateTable(ctx, db, trk); err != nil {
+				trk.Abort(stage, fmt.Errorf("Error truncating table %s: %w", tgt.table, err))
+				return
+			}
+		}
+
+		columns, fields := tgt.columns, tgt.fields
+		var statement string
+		batch := make([]core.RowMap, 0, tgt.batchSize)
+		counter := 0
+		for row := range in {
+			if ctx.Err() != nil {
+				break
+			}
+
+			if statement == "" {
+				if len(columns) == 0 {
+					columns = sortedKeys(row)
+					fields = columns
+					if err := checkKeys(tgt.keys, columns); err != nil {
+						trk.Abort(stage, err)
+						return
+					}
+				}
+				statement = tgt.buildStatement(db, columns)
+			}
+
+			batch = append(batch, row)
+			if len(batch) >= tgt.batchSize {
+				written, err := tgt.writeBatch(ctx, db, trk, stage, statement, fields, batch)
+				if err != nil {
+					trk.Abort(stage, err)
+					return
+				}
+				counter += written
+				batch = batch[:0]
+			}
+		}
+
+		if len(batch) > 0 && ctx.Err() == nil {
+			written, err := tgt.writeBatch(ctx, db, trk, stage, statement, fields, batch)
+			if err != nil {
+				trk.Abort(stage, err)
+				return
+			}
+			counter += written
+		}
+
+		log.Printf(" - Written %d row(s) to the database table: '%s'...", counter, tgt.table)
+	}()
+
+	log.Printf("* Database table target on table '%s' started successfully!", tgt.table)
+}
+
+// `buildStatement` returns the statement to write a row with the given
+// columns, with the placeholders of the database driver.
+func (tgt *DatabaseTableTarget) buildStatement(db *sqlx.DB, columns []string) string {
+	if tgt.upsert {
+		return db.Rebind(tgt.dialect.UpsertStatement(tgt.table, columns, tgt.keys))
+	}
+	return db.Rebind(tgt.dialect.InsertStatement(tgt.table, columns))
+}
+
+// `truncateTable` deletes all the rows of the table, once for all the
+// instances of the target in an execution of the task. The other
+// instances wait until it's done.
+func (tgt *DatabaseTableTarget) truncateTable(ctx context.Context, db *sqlx.DB, trk *core.Tracker) error {
+	shared := trk.Shared("truncation:"+tgt.table, func() any { return &truncation{} })
+	trunc := shared.(*truncation)
+	trunc.once.Do(func() {
+		log.Printf(" - Truncating the database table: '%s'...", tgt.table)
+		truncCtx, cancel := tgt.config.WithQueryTimeout(ctx)
+		defer cancel()
+		_, trunc.err = db.ExecContext(truncCtx, tgt.dialect.TruncateStatement(tgt.table))
+	})
+	return trunc.err
+}
+
+// `rowSavepoint` is the name of the savepoint set before each row, when
+// the dialect is a `Savepointer`.
+const rowSavepoint = "datacat_row"
+
+// `writeBatch` writes the given rows inside a transaction. A row which
+// can't be written fails alone; the rows written are acknowledged when
+// the transaction is committed. It returns the number of rows written.
+// The query timeout of the database applies to the whole batch.
+func (tgt *DatabaseTableTarget) writeBatch(parent context.Context, db *sqlx.DB, trk *core.Tracker, stage string, statement string, fields []string, batch []core.RowMap) (int, error) {
+	ctx, cancel := tgt.config.WithQueryTimeout(parent)
+	defer cancel()
+
+	// `batchError` returns the error which aborts the batch.
+	batchError := func(err error) error {
+		if parent.Err() != nil {
+			return parent.Err()
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("Batch timed out after %s", tgt.config.QueryTimeout)
+		}
+		return err
+	}
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("Error starting a transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PreparexContext(ctx, statement)
+	if err != nil {
+		return 0, fmt.Errorf("Error preparing statement '%s': %w", statement, err)
+	}
+	defer stmt.Close()
+
+	savepointer, _ := tgt.dialect.(Savepointer)
+	written := make([]core.RowMap, 0, len(batch))
+	for _, row := range batch {
+		values, err := bindValues(row, fields)
+		if err != nil {
+			trk.Fail(stage, row, err)
+			continue
+		}
+		if savepointer != nil {
+			if _, err := tx.ExecContext(ctx, savepointer.SavepointStatement(rowSavepoint)); err != nil {
+				return 0, batchError(fmt.Errorf("Error setting a savepoint: %w", err))
+			}
+		}
+
+		_, rowErr := stmt.ExecContext(ctx, values...)
+		if rowErr != nil && (parent.Err() != nil || ctx.Err() != nil) {
+			return 0, batchError(rowErr)
+		}
+		if rowErr != nil && savepointer != nil {
+			if _, err := tx.ExecContext(ctx, savepointer.RollbackToStatement(rowSavepoint)); err != nil {
+				return 0, batchError(fmt.Errorf("Error rolling back to a savepoint: %w", err))
+			}
+		}
+		if savepointer != nil {
+			if _, err := tx.ExecContext(ctx, savepointer.ReleaseStatement(rowSavepoint)); err != nil {
+				return 0, batchError(fmt.Errorf("Error releasing a savepoint: %w", err))
+			}
+		}
+
+		if rowErr != nil {
+			trk.Fail(stage, row, fmt.Errorf("Error writing data row: %w", rowErr))
+			continue
+		}
+		written = append(written, row)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("Error committing a transaction: %w", err)
+	}
+	trk.Flushed(written, "", 0)
+	return len(written), nil
+}
+
+// `bindValues` returns the values of the given fields of a row, as
+// expected by the database driver. Nested maps and lists are written as
+// JSON text.
+func bindValues(row core.RowMap, fields []string) ([]any, error) {
+	values := make([]any, len(fields))
+	for i, field := range fields {
+		switch value := row[field].(type) {
+		case map[string]any, []any:
+			buffer, err := json.Marshal(value)
+			if err != nil {
+				return nil, fmt.Errorf("Error marshalling field '%s': %w", field, err)
+			}
+			values[i] = string(buffer)
+		case json.Number:
+			values[i] = value.String()
+		default:
+			values[i] = value
+		}
+	}
+	return values, nil
+}
+
+// `getColumnMapping` returns the columns of the table and the fields of
+// the rows written to them, from the `columns` list (fields with the
+// same name) or the `mapping` of columns to fields.
+func getColumnMapping(args core.Arguments) ([]string, []string, error) {
+	if args.Has("mapping") {
+		if args.Has("columns") {
+			return nil, nil, errors.New("Arguments 'columns' and 'mapping' can't be used together")
+		}
+
+		mapping, err := args.Map("mapping")
+		if err != nil {
+			return nil, nil, err
+		}
+
+		columns := make([]string, 0, len(mapping))
+		for column := range mapping {
+			columns = append(columns, column)
+		}
+		sort.Strings(columns)
+
+		fields := make([]string, len(columns))
+		for i, column := range columns {
+			fields[i] = mapping.String(column, column)
+		}
+		return columns, fields, nil
+	}
+
+	columns, err := args.Strings("columns")
+	if err != nil {
+		return nil, nil, err
+	}
+	return columns, columns, nil
+}
+
+// `checkKeys` verifies that the key columns are written.
+func checkKeys(keys []string, columns []string) error {
+	for _, key := range keys {
+		found := false
+		for _, column := range columns {
+			if strings.EqualFold(key, column) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("Key column '%s' isn't written to the table", key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package targets
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/tnotstar/datacat/core"
+)
+
+// A `savepointDialect` is the SQLite dialect with the savepoints of the
+// PostgreSQL one, to check the writing of batches with savepoints.
+type savepointDialect struct {
+	sqliteDialect
+	postgresDialect
+	statements []string
+}
+
+func (d *savepointDialect) QuoteIdentifier(name string) string {
+	return d.sqliteDialect.QuoteIdentifier(name)
+}
+
+func (d *savepointDialect) InsertStatement(table string, columns []string) string {
+	return d.sqliteDialect.InsertStatement(table, columns)
+}
+
+func (d *savepointDialect) UpsertStatement(table string, columns []string, keys []string) string {
+	return d.sqliteDialect.UpsertStatement(table, columns, keys)
+}
+
+func (d *savepointDialect) TruncateStatement(table string) string {
+	return d.sqliteDialect.TruncateStatement(table)
+}
+
+func (d *savepointDialect) SavepointStatement(name string) string {
+	d.statements = append(d.statements, "savepoint")
+	return d.postgresDialect.SavepointStatement(name)
+}
+
+func (d *savepointDialect) RollbackToStatement(name string) string {
+	d.statements = append(d.statements, "rollback")
+	return d.postgresDialect.RollbackToStatement(name)
+}
+
+func (d *savepointDialect) ReleaseStatement(name string) string {
+	d.statements = append(d.statements, "release")
+	return d.postgresDialect.ReleaseStatement(name)
+}
+
+func TestWriteBatchRollsBackFailedRowsToSavepoint(t *testing.T) {
+	config := &core.DatabaseConfig{Driver: "sqlite3", Path: filepath.Join(t.TempDir(), "test.db")}
+	db, err := sqlx.Open(config.Driver, config.GetDataSourceName())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE dst (id INTEGER PRIMARY KEY, name TEXT NOT NULL)"); err != nil {
+		t.Fatal(err)
+	}
+
+	dialect := &savepointDialect{}
+	tgt := &DatabaseTableTarget{config: config, dialect: dialect, table: "dst"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	trk := core.NewTracker("test", cancel)
+	deadLetters := make(chan core.RowMap, 10)
+	trk.SetDeadLetter(ctx, deadLetters, core.DeadLetterConfig{})
+
+	batch := []core.RowMap{
+		{"id": 1, "name": "ann"},
+		{"id": 2, "name": nil},
+		{"id": 3, "name": "bob"},
+	}
+	statement := tgt.buildStatement(db, []string{"id", "name"})
+	written, err := tgt.writeBatch(ctx, db, trk, "target#0", statement, []string{"id", "name"}, batch)
+	if err != nil {
+		t.Fatalf("writeBatch failed: %v", err)
+	}
+	if written != 2 || len(deadLetters) != 1 {
+		t.Errorf("writeBatch wrote %d rows and failed %d, want 2 and 1", written, len(deadLetters))
+	}
+
+	var count int
+	if err := db.Get(&count, "SELECT COUNT(*) FROM dst"); err != nil || count != 2 {
+		t.Errorf("Table has %d rows (%v), want 2", count, err)
+	}
+
+	want := []string{"savepoint", "release", "savepoint", "rollback", "release", "savepoint", "release"}
+	if !slices.Equal(dialect.statements, want) {
+		t.Errorf("Savepoint statements = %v, want %v", dialect.statements, want)
+	}
+}
@@ -0,0 +1,303 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package targets
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// A `Dialect` builds the SQL statements of a database table target for
+// a specific database engine.
+type Dialect interface {
+	// QuoteIdentifier returns the given table or column name, quoted if
+	// it isn't a plain identifier. Plain identifiers are kept unquoted
+	// so their case follows the rules of the database engine.
+	QuoteIdentifier(name string) string
+
+	// InsertStatement returns the statement to insert a row with the
+	// given columns, with a `?` placeholder for each one.
+	InsertStatement(table string, columns []string) string
+
+	// UpsertStatement returns the statement to insert a row with the
+	// given columns, or to update it if a row with the same key columns
+	// exists, with a `?` placeholder for each column.
+	UpsertStatement(table string, columns []string, keys []string) string
+
+	// TruncateStatement returns the statement to delete all the rows of
+	// the given table.
+	TruncateStatement(table string) string
+}
+
+// A `Savepointer` is the dialect of a database engine which aborts the
+// whole transaction when one of its statements fails, like PostgreSQL.
+// The rows of a batch are then written after a savepoint, which is
+// rolled back to when the row fails, so that it fails alone.
+type Savepointer interface {
+	// SavepointStatement returns the statement to set a savepoint with
+	// the given name.
+	SavepointStatement(name string) string
+
+	// RollbackToStatement returns the statement to roll back to the
+	// savepoint with the given name.
+	RollbackToStatement(name string) string
+
+	// ReleaseStatement returns the statement to release the savepoint
+	// with the given name.
+	ReleaseStatement(name string) string
+}
+
+// `dialects` are the registered dialects by driver name.
+var dialects = map[string]Dialect{}
+
+// `RegisterDialect` registers the dialect of the given database driver.
+func RegisterDialect(driver string, dialect Dialect) {
+	dialects[driver] = dialect
+}
+
+// `GetDialect` returns the dialect of the given database driver.
+func GetDialect(driver string) (Dialect, error) {
+	dialect, ok := dialects[driver]
+	if !ok {
+		return nil, fmt.Errorf("Unsupported database driver for targets: %s", driver)
+	}
+	return dialect, nil
+}
+
+func init() {
+	RegisterDialect("oracle", &oracleDialect{ansiDialect{open: `"`, close: `"`}})
+	RegisterDialect("sqlserver", &mssqlDialect{ansiDialect{open: "[", close: "]"}})
+	RegisterDialect("mssql", &mssqlDialect{ansiDialect{open: "[", close: "]"}})
+	RegisterDialect("sqlite3", &sqliteDialect{ansiDialect{open: `"`, close: `"`}})
+	RegisterDialect("pgx", &postgresDialect{ansiDialect{open: `"`, close: `"`}})
+	RegisterDialect("mysql", &mysqlDialect{ansiDialect{open: "`", close: "`"}})
+}
+
+// `ansiDialect` builds the statements common to most database engines.
+type ansiDialect struct {
+	// The `open` and `close` quotes of identifiers.
+	open, close string
+}
+
+// `QuoteIdentifier` implements the `Dialect` interface. The parts of a
+// qualified name are quoted separately.
+func (d *ansiDialect) QuoteIdentifier(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		if !isPlainIdentifier(part) {
+			parts[i] = d.open + strings.ReplaceAll(part, d.close, d.close+d.close) + d.close
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// `InsertStatement` implements the `Dialect` interface.
+func (d *ansiDialect) InsertStatement(table string, columns []string) string {
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		d.QuoteIdentifier(table), d.columnList("", columns), placeholders(len(columns)))
+}
+
+// `UpsertStatement` implements the `Dialect` interface with the `MERGE`
+// statement of the SQL standard.
+func (d *ansiDialect) UpsertStatement(table string, columns []string, keys []string) string {
+	return d.merge(table, columns, keys, "", "", "")
+}
+
+// `TruncateStatement` implements the `Dialect` interface.
+func (d *ansiDialect) TruncateStatement(table string) string {
+	return fmt.Sprintf("TRUNCATE TABLE %s", d.QuoteIdentifier(table))
+}
+
+// `merge` returns a `MERGE` statement. The `hint` is appended to the
+// target table, the `from` clause to the select list of the source row,
+// and the `end` to the statement.
+func (d *ansiDialect) merge(table string, columns []string, keys []string, hint string, from string, end string) string {
+	selects := make([]string, len(columns))
+	for i, column := range columns {
+		selects[i] = "? AS " + d.QuoteIdentifier(column)
+	}
+
+	conditions := make([]string, len(keys))
+	for i, key := range keys {
+		conditions[i] = fmt.Sprintf("tgt.%[1]s = src.%[1]s", d.QuoteIdentifier(key))
+	}
+
+	isKey := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		isKey[strings.ToLower(key)] = true
+	}
+	var updates []string
+	for _, column := range columns {
+		if !isKey[strings.ToLower(column)] {
+			updates = append(updates, fmt.Sprintf("tgt.%[1]s = src.%[1]s", d.QuoteIdentifier(column)))
+		}
+	}
+
+	var statement strings.Builder
+	fmt.Fprintf(&statement, "MERGE INTO %s%s tgt USING (SELECT %s%s) src ON (%s)",
+		d.QuoteIdentifier(table), hint, strings.Join(selects, ", "), from, strings.Join(conditions, " AND "))
+	if len(updates) > 0 {
+		fmt.Fprintf(&statement, " WHEN MATCHED THEN UPDATE SET %s", strings.Join(updates, ", "))
+	}
+	fmt.Fprintf(&statement, " WHEN NOT MATCHED THEN INSERT (%s) VALUES (%s)%s",
+		d.columnList("", columns), d.columnList("src.", columns), end)
+	return statement.String()
+}
+
+// `onConflict` returns an `INSERT` statement which updates the row with
+// the same key columns, if any, by an `ON CONFLICT` clause.
+func (d *ansiDialect) onConflict(table string, columns []string, keys []string) string {
+	isKey := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		isKey[strings.ToLower(key)] = true
+	}
+	var updates []string
+	for _, column := range columns {
+		if !isKey[strings.ToLower(column)] {
+			updates = append(updates, fmt.Sprintf("%[1]s = excluded.%[1]s", d.QuoteIdentifier(column)))
+		}
+	}
+
+	action := "DO NOTHING"
+	if len(updates) > 0 {
+		action = "DO UPDATE SET " + strings.Join(updates, ", ")
+	}
+	return fmt.Sprintf("%s ON CONFLICT (%s) %s", d.InsertStatement(table, columns), d.columnList("", keys), action)
+}
+
+// `columnList` returns the comma separated list of the quoted columns,
+// each one with the given prefix.
+func (d *ansiDialect) columnList(prefix string, columns []string) string {
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = prefix + d.QuoteIdentifier(column)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// `oracleDialect` builds the statements for Oracle databases.
+type oracleDialect struct {
+	ansiDialect
+}
+
+// `UpsertStatement` implements the `Dialect` interface.
+func (d *oracleDialect) UpsertStatement(table string, columns []string, keys []string) string {
+	return d.merge(table, columns, keys, "", " FROM DUAL", "")
+}
+
+// `mssqlDialect` builds the statements for SQL Server databases.
+type mssqlDialect struct {
+	ansiDialect
+}
+
+// `UpsertStatement` implements the `Dialect` interface. The table is
+// locked until the end of the transaction to avoid duplicated keys.
+func (d *mssqlDialect) UpsertStatement(table string, columns []string, keys []string) string {
+	return d.merge(table, columns, keys, " WITH (HOLDLOCK)", "", ";")
+}
+
+// `sqliteDialect` builds the statements for SQLite databases.
+type sqliteDialect struct {
+	ansiDialect
+}
+
+// `UpsertStatement` implements the `Dialect` interface. The key columns
+// must have a unique index.
+func (d *sqliteDialect) UpsertStatement(table string, columns []string, keys []string) string {
+	return d.onConflict(table, columns, keys)
+}
+
+// `TruncateStatement` implements the `Dialect` interface, since SQLite
+// has no `TRUNCATE` statement.
+func (d *sqliteDialect) TruncateStatement(table string) string {
+	return fmt.Sprintf("DELETE FROM %s", d.QuoteIdentifier(table))
+}
+
+// `postgresDialect` builds the statements for PostgreSQL databases.
+type postgresDialect struct {
+	ansiDialect
+}
+
+// `UpsertStatement` implements the `Dialect` interface. The key columns
+// must have a unique index.
+func (d *postgresDialect) UpsertStatement(table string, columns []string, keys []string) string {
+	return d.onConflict(table, columns, keys)
+}
+
+// `SavepointStatement` implements the `Savepointer` interface.
+func (d *postgresDialect) SavepointStatement(name string) string {
+	return "SAVEPOINT " + name
+}
+
+// `RollbackToStatement` implements the `Savepointer` interface.
+func (d *postgresDialect) RollbackToStatement(name string) string {
+	return "ROLLBACK TO SAVEPOINT " + name
+}
+
+// `ReleaseStatement` implements the `Savepointer` interface.
+func (d *postgresDialect) ReleaseStatement(name string) string {
+	return "RELEASE SAVEPOINT " + name
+}
+
+// `mysqlDialect` builds the statements for MySQL databases.
+type mysqlDialect struct {
+	ansiDialect
+}
+
+// `UpsertStatement` implements the `Dialect` interface. The key columns
+// must have a unique index.
+func (d *mysqlDialect) UpsertStatement(table string, columns []string, keys []string) string {
+	isKey := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		isKey[strings.ToLower(key)] = true
+	}
+	var updates []string
+	for _, column := range columns {
+		if !isKey[strings.ToLower(column)] {
+			updates = append(updates, fmt.Sprintf("%[1]s = VALUES(%[1]s)", d.QuoteIdentifier(column)))
+		}
+	}
+	if len(updates) == 0 {
+		// A key assigned to itself ignores the duplicated row.
+		updates = append(updates, fmt.Sprintf("%[1]s = %[1]s", d.QuoteIdentifier(keys[0])))
+	}
+	return fmt.Sprintf("%s ON DUPLICATE KEY UPDATE %s", d.InsertStatement(table, columns), strings.Join(updates, ", "))
+}
+
+// `placeholders` returns a comma separated list of `?` placeholders.
+func placeholders(count int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", count), ", ")
+}
+
+// `isPlainIdentifier` returns true if the given name is an unquoted
+// identifier in any database engine.
+func isPlainIdentifier(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, char := range name {
+		if char != '_' && !unicode.IsLetter(char) && (i == 0 || !unicode.IsDigit(char)) {
+			return false
+		}
+	}
+	return true
+}
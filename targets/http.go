@@ -21,17 +21,18 @@
 package targets
 
 import (
-	"bytes"
-	"crypto/tls"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
-	"net/http/httputil"
-	"net/url"
 	"sync"
+	"time"
 
 	"github.com/tnotstar/datacat/core"
+	"github.com/tnotstar/datacat/services"
 )
 
 // `HttpRequestTarget` is the concrete implementation of the target interface
@@ -42,20 +43,32 @@ type HttpRequestTarget struct {
 	id int
 	// The `task` of the task which is running into.
 	task string
-	// The `url` to send data to.
-	url string
-	// The `method` to use.
-	method string
-	// The `trustcert` is a flag to indicate if certificates must be trusted.
-	trustcert bool
-	// The `authzURL` is the authorization url to get the JWT token from.
-	authzURL string
-	// The `authzMethod` is the HTTP method to use for authorization.
-	authzMethod string
-	// The `authzClient` to use for authorization.
-	authzClient string
-	// The `authzCredential` to use for authorization.
-	authzCredential string
+	// The `request` template of the requests to the endpoint.
+	request *services.RequestTemplate
+	// The `route` of the requests of a batched target.
+	route *services.Route
+	// The `endpoint` of the service to send the requests to.
+	endpoint *services.Endpoint
+	// `batched` sends the rows as a JSON array instead of one by one.
+	batched bool
+	// The `batchSize` is the maximum number of rows in a request.
+	batchSize int
+	// The `maxBytes` is the maximum size of the rows in a request.
+	maxBytes int
+	// The `envelope` is the field of the body object holding the array
+	// of rows. If empty, the body is the array itself.
+	envelope string
+	// The `flushInterval` is the maximum time a row waits in a batch.
+	flushInterval time.Duration
+	// The `resultsPath` is the dotted path of the array of per-item
+	// results in the response, or `.` for the response itself.
+	resultsPath string
+	// The `resultStatus` is the field of a per-item result with its
+	// HTTP status code.
+	resultStatus string
+	// The `resultError` is the field of a per-item result with its
+	// error message.
+	resultError string
 }
 
 // `IsaHttpRequestTarget` returns true if given target type
@@ -68,90 +81,196 @@ func IsaHttpRequestTarget(sourceType string) bool {
 //
 // The `cfg` is the global configuration object.
 // The `taskName` is the name of the task to be executed.
-func NewHttpRequestTarget(id int, cfg core.Configurator, taskName string) *HttpRequestTarget {
+func NewHttpRequestTarget(id int, cfg core.Configurator, taskName string) (core.Target, error) {
 	targetConfig, _ := cfg.GetTargetConfig(taskName)
 
-	serviceName := targetConfig.Arguments["service"].(string)
-	serviceConfig, err := cfg.GetServiceConfig(serviceName)
+	endpoint, err := services.NewEndpoint(cfg, taskName, targetConfig.Arguments)
 	if err != nil {
-		log.Fatalf("Error getting configuration for service %s in task %s: %s", serviceName, taskName, err)
+		return nil, err
 	}
 
-	authzName := serviceConfig.WithAuthz
-	authzConfig, err := cfg.GetServiceConfig(authzName)
+	request, err := services.NewRequestTemplate(endpoint.BaseURL(), targetConfig.Arguments, http.MethodPost)
 	if err != nil {
-		log.Fatalf("Error getting configuration for authz service %s in task %s: %s", authzName, taskName, err)
+		return nil, err
 	}
 
-	targetMethod := targetConfig.Arguments["method"].(string)
-	targetPath := targetConfig.Arguments["path"].(string)
-	targetURL, err := url.JoinPath(serviceConfig.BaseURL, targetPath)
+	batchSize, err := targetConfig.Arguments.Int("batchsize", 1)
 	if err != nil {
-		log.Fatalf("Error parsing endpoint URI: %s", err.Error())
+		return nil, err
+	}
+	if batchSize < 1 {
+		batchSize = 1
 	}
 
-	return &HttpRequestTarget{
-		id:              id,
-		task:            taskName,
-		url:             targetURL,
-		method:          targetMethod,
-		trustcert:       serviceConfig.TrustCert,
-		authzURL:        authzConfig.BaseURL,
-		authzMethod:     authzConfig.Method,
-		authzClient:     authzConfig.Parameters["client"],
-		authzCredential: authzConfig.Parameters["credential"],
+	maxBytes, err := targetConfig.Arguments.Int("maxbytes", 0)
+	if err != nil {
+		return nil, err
+	}
+	// Without a batch size, the batches are only limited by their size.
+	if maxBytes > 0 && !targetConfig.Arguments.Has("batchsize") {
+		batchSize = math.MaxInt
+	}
+
+	flushInterval, err := targetConfig.Arguments.Duration("flushinterval", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	envelope := targetConfig.Arguments.String("envelope", "")
+	resultsPath := targetConfig.Arguments.String("resultspath", "")
+	batched := batchSize > 1 || maxBytes > 0 || envelope != ""
+	if resultsPath != "" && !batched {
+		return nil, fmt.Errorf("Argument 'resultspath' needs a batched target")
+	}
+
+	// The rows of a batch share a single request, so its route can't
+	// depend on their fields.
+	var route *services.Route
+	if batched {
+		if request.PerRow() {
+			return nil, fmt.Errorf("Arguments 'method', 'path' and 'headers' can't use row fields in a batched target")
+		}
+		if route, err = request.Route(nil); err != nil {
+			return nil, err
+		}
 	}
+
+	return &HttpRequestTarget{
+		id:            id,
+		task:          taskName,
+		request:       request,
+		route:         route,
+		endpoint:      endpoint,
+		batched:       batched,
+		batchSize:     batchSize,
+		maxBytes:      maxBytes,
+		envelope:      envelope,
+		flushInterval: flushInterval,
+		resultsPath:   resultsPath,
+		resultStatus:  targetConfig.Arguments.String("resultstatus", "status"),
+		resultError:   targetConfig.Arguments.String("resulterror", "error"),
+	}, nil
 }
 
 // `Run` creates a goroutine that reads data from the database and sends
 // it to an output channel. It returns a channel that will receive the
 // data read from the database.
-func (tgt *HttpRequestTarget) Run(wg *sync.WaitGroup, in <-chan core.RowMap) {
+func (tgt *HttpRequestTarget) Run(ctx context.Context, wg *sync.WaitGroup, trk *core.Tracker, in <-chan core.RowMap) {
 	log.Printf("* Creating instance #%d of HTTP request target for task '%s'...", tgt.id, tgt.task)
-
-	log.Println("Requesting JWToken from the authz server...")
-	jwtoken := tgt.GetJWTokenFromAuthzServer()
-	authorizationBearer := fmt.Sprintf("Bearer %s", jwtoken)
-	log.Println("JWToken received successfully:", authorizationBearer)
-
-	tr := &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
-	client := &http.Client{Transport: tr}
+	stage := fmt.Sprintf("target#%d", tgt.id)
+	tgt.endpoint.Share(trk)
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 
 		counter := 0
-		log.Println("Requesting service with received data rows...")
-		for row := range in {
-			buffer, err := json.Marshal(row)
-			if err != nil {
-				log.Fatalf("Error marshalling data row: %s", err.Error())
+		var rows []core.RowMap
+		var items []json.RawMessage
+		size := 0
+
+		// A timer flushes an incomplete batch after the flush interval.
+		timer := time.NewTimer(time.Hour)
+		timer.Stop()
+		defer timer.Stop()
+
+		// `stopTimer` stops the timer and drains a pending tick, if any,
+		// so that a later `Reset` doesn't flush the next batch early. The
+		// tick may have already been received by the loop.
+		stopTimer := func() {
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
 			}
+		}
 
-			req, err := http.NewRequest("POST", tgt.url, bytes.NewBuffer(buffer))
-			if err != nil {
-				log.Fatalf("Error creating request: %s", err.Error())
+		flush := func() bool {
+			if len(rows) == 0 {
+				return true
 			}
-			req.Header.Add("Content-Type", "application/json")
-			req.Header.Add("Authorization", authorizationBearer)
+			stopTimer()
 
-			reqDump, err := httputil.DumpRequestOut(req, true)
+			route := tgt.route
+			var err error
+			if route == nil {
+				route, err = tgt.request.Route(rows[0])
+			}
+			var errs []error
 			if err == nil {
-				log.Print("Requesting:\n", string(reqDump))
-			} else {
-				log.Print("Error dumping request:", err.Error())
+				errs, err = tgt.send(ctx, route, items)
 			}
-
-			res, err := client.Do(req)
-			if err != nil {
-				log.Fatalf("Error sending request: %s", err.Error())
+			if ctx.Err() != nil {
+				return false
+			}
+			if errors.Is(err, services.ErrAuthorization) {
+				trk.Abort(stage, err)
+				return false
 			}
-			res.Body.Close()
+			var written []core.RowMap
+			for i, row := range rows {
+				switch {
+				case err != nil:
+					trk.Fail(stage, row, err)
+				case errs != nil && errs[i] != nil:
+					trk.Fail(stage, row, errs[i])
+				default:
+					written = append(written, row)
+				}
+			}
+			trk.Flushed(written, "", 0)
+			counter += len(written)
+
+			rows, items, size = rows[:0], items[:0], 0
+			return true
+		}
+
+		log.Println("Requesting service with received data rows...")
+	loop:
+		for {
+			select {
+			case row, ok := <-in:
+				if !ok || ctx.Err() != nil {
+					break loop
+				}
+
+				buffer, err := tgt.request.Body(row)
+				if err == nil && tgt.batched && len(buffer) == 0 {
+					err = fmt.Errorf("Empty body for a batched target")
+				}
+				if err != nil {
+					trk.Fail(stage, row, fmt.Errorf("Error building request body: %w", err))
+					continue
+				}
 
-			log.Println("Sending data row:", res.Status)
+				if tgt.maxBytes > 0 && len(rows) > 0 && size+len(buffer)+1 > tgt.maxBytes {
+					if !flush() {
+						break loop
+					}
+				}
 
-			counter += 1
+				rows = append(rows, row)
+				items = append(items, buffer)
+				size += len(buffer) + 1
+				if len(rows) == 1 && tgt.flushInterval > 0 {
+					timer.Reset(tgt.flushInterval)
+				}
+
+				if !tgt.batched || len(rows) >= tgt.batchSize {
+					if !flush() {
+						break loop
+					}
+				}
+			case <-timer.C:
+				if !flush() {
+					break loop
+				}
+			}
+		}
+
+		if ctx.Err() == nil {
+			flush()
 		}
 
 		log.Printf("Requested %d row(s) to the target service", counter)
@@ -160,40 +279,78 @@ func (tgt *HttpRequestTarget) Run(wg *sync.WaitGroup, in <-chan core.RowMap) {
 	log.Printf("HttpTarget target for task %s started successfully", tgt.task)
 }
 
-// `GetJWTokenFromAuthzServer` request and return a JWToken for the target endpoint.
-func (tgt *HttpRequestTarget) GetJWTokenFromAuthzServer() string {
-	url, err := url.Parse(tgt.authzURL)
+// `send` sends a request with the given items to the given route, as a
+// single object or as a batch. It returns an error for the whole request, or the error
+// of each item, if any, from the per-item results of the response.
+func (tgt *HttpRequestTarget) send(ctx context.Context, route *services.Route, items []json.RawMessage) ([]error, error) {
+	body, err := tgt.buildBody(items)
 	if err != nil {
-		log.Fatalf("Error parsing authz URI: %s", err.Error())
+		return nil, fmt.Errorf("Error marshalling request body: %w", err)
 	}
 
-	query := url.Query()
-	query.Set("client", tgt.authzClient)
-	query.Set("credential", tgt.authzCredential)
-	url.RawQuery = query.Encode()
-
-	req, err := http.NewRequest("GET", url.String(), nil)
+	res, err := tgt.endpoint.Exchange(ctx, route, body)
 	if err != nil {
-		log.Fatalf("Error creating request for authz: %s", err.Error())
+		return nil, err
+	}
+
+	// Only the method and the URL, since the headers and the body may
+	// carry credentials or personal data.
+	log.Printf("Sending %d data row(s) to %s %s: %s", len(items), route.Method, res.Request.URL.Redacted(), res.Status)
+	if err := res.Err(); err != nil {
+		return nil, err
+	}
+
+	if tgt.resultsPath == "" {
+		return nil, nil
+	}
+	return tgt.matchResults(res, len(items))
+}
+
+// `buildBody` returns the body of a request with the given items: the
+// item itself if the target isn't batched, or the array of items,
+// inside the envelope object if any.
+func (tgt *HttpRequestTarget) buildBody(items []json.RawMessage) ([]byte, error) {
+	if !tgt.batched {
+		return items[0], nil
 	}
 
-	log.Printf("Requesting authz token from: %s", tgt.authzURL)
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: tgt.trustcert},
+	array, err := json.Marshal(items)
+	if err != nil || tgt.envelope == "" {
+		return array, err
 	}
+	return json.Marshal(map[string]json.RawMessage{tgt.envelope: array})
+}
 
-	client := &http.Client{Transport: tr}
-	res, err := client.Do(req)
+// `matchResults` decodes the array of per-item results of a response,
+// in the order of the items sent, and returns the error of each item.
+// An item fails if its result has an error status code or message.
+func (tgt *HttpRequestTarget) matchResults(res *services.Response, count int) ([]error, error) {
+	response, err := res.JSON()
 	if err != nil {
-		log.Fatalf("Error requesting authz: %s", err.Error())
+		return nil, err
+	}
+
+	response, ok := services.LookupPath(response, tgt.resultsPath)
+	if !ok {
+		return nil, fmt.Errorf("Missing results '%s' in response", tgt.resultsPath)
 	}
-	defer res.Body.Close()
 
-	var jsonBody any
-	if err := json.NewDecoder(res.Body).Decode(&jsonBody); err != nil {
-		log.Fatalf("Error decoding authz response: %s", err.Error())
+	results, ok := response.([]any)
+	if !ok || len(results) != count {
+		return nil, fmt.Errorf("Expected %d result(s) at '%s' in response", count, tgt.resultsPath)
 	}
 
-	rawToken := jsonBody.(map[string]any)["token"]
-	return fmt.Sprint(rawToken)
+	errs := make([]error, count)
+	for i, result := range results {
+		fields, ok := result.(map[string]any)
+		if !ok {
+			continue
+		}
+		if message, ok := fields[tgt.resultError]; ok && message != nil && message != "" && message != false {
+			errs[i] = fmt.Errorf("Item rejected by the service: %v", message)
+		} else if status, ok := core.ToFloat(fields[tgt.resultStatus]); ok && (status < 200 || status > 299) {
+			errs[i] = fmt.Errorf("Item rejected by the service with status %v", fields[tgt.resultStatus])
+		}
+	}
+	return errs, nil
 }
@@ -0,0 +1,213 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package targets
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tnotstar/datacat/core"
+)
+
+// A `batchServer` is a test server which records the batches of items
+// received by its `/items` endpoint.
+type batchServer struct {
+	*httptest.Server
+	mutex   sync.Mutex
+	batches [][]map[string]any
+}
+
+// `newBatchServer` starts a batch server which answers each batch with
+// the response returned by the given handler.
+func newBatchServer(t *testing.T, handler func(batch []map[string]any) any) *batchServer {
+	t.Helper()
+	server := &batchServer{}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batch []map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		server.mutex.Lock()
+		server.batches = append(server.batches, batch)
+		server.mutex.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(handler(batch))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// `sizes` returns the number of items of each batch received so far.
+func (server *batchServer) sizes() []int {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	sizes := make([]int, len(server.batches))
+	for i, batch := range server.batches {
+		sizes[i] = len(batch)
+	}
+	return sizes
+}
+
+// `runHTTPTarget` runs an HTTP request target of the given server with
+// the given arguments and a dead-letter output. The `feed` function
+// sends the rows to the target, and it returns the result of the task
+// and the dead-lettered rows.
+func runHTTPTarget(t *testing.T, server *batchServer, args core.Arguments, feed func(in chan<- core.RowMap)) (*core.Result, []core.RowMap) {
+	t.Helper()
+	args["service"] = "api"
+	args["path"] = "/items"
+	cfg := &core.Config{
+		Services: map[string]core.ServiceConfig{"api": {BaseURL: server.URL}},
+		Tasks: map[string]core.TaskConfig{
+			"test": {Target: core.TargetConfig{Type: "http-request-target", Arguments: args}},
+		},
+	}
+	tgt, err := BuildTarget(0, cfg, "test")
+	if err != nil {
+		t.Fatalf("BuildTarget failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	trk := core.NewTracker("test", cancel)
+	deadLetter := make(chan core.RowMap, 100)
+	trk.SetDeadLetter(ctx, deadLetter, core.DeadLetterConfig{})
+
+	var wg sync.WaitGroup
+	in := make(chan core.RowMap)
+	tgt.Run(ctx, &wg, trk, in)
+	feed(in)
+	close(in)
+	wg.Wait()
+	close(deadLetter)
+
+	var failed []core.RowMap
+	for row := range deadLetter {
+		failed = append(failed, row)
+	}
+	return trk.Result(), failed
+}
+
+// `sendRows` returns a feed of rows with the ids in the given range.
+func sendRows(from, to int) func(in chan<- core.RowMap) {
+	return func(in chan<- core.RowMap) {
+		for id := from; id <= to; id++ {
+			in <- core.RowMap{"id": id}
+		}
+	}
+}
+
+func TestHTTPTargetPerItemResults(t *testing.T) {
+	server := newBatchServer(t, func(batch []map[string]any) any {
+		results := make([]any, len(batch))
+		for i, item := range batch {
+			switch item["id"] {
+			case 2.0:
+				results[i] = map[string]any{"status": 422, "error": "invalid id"}
+			case 4.0:
+				results[i] = map[string]any{"status": 500}
+			default:
+				results[i] = map[string]any{"status": 201, "error": nil}
+			}
+		}
+		return map[string]any{"data": map[string]any{"results": results}}
+	})
+
+	result, failed := runHTTPTarget(t, server, core.Arguments{"batchsize": 3, "resultspath": "data.results"}, sendRows(1, 5))
+	if result.Err != nil || result.Written != 3 || result.Failed != 2 {
+		t.Fatalf("Target result = %s, want 3 written and 2 failed", result)
+	}
+	if sizes := server.sizes(); !reflect.DeepEqual(sizes, []int{3, 2}) {
+		t.Errorf("Sent batches of %v rows, want [3 2]", sizes)
+	}
+
+	errs := map[any]any{}
+	for _, row := range failed {
+		errs[row["id"]] = row[core.DeadLetterError]
+	}
+	want := map[any]any{
+		2: "Item rejected by the service: invalid id",
+		4: "Item rejected by the service with status 500",
+	}
+	if !reflect.DeepEqual(errs, want) {
+		t.Errorf("Failed rows = %v, want %v", errs, want)
+	}
+}
+
+func TestHTTPTargetMissingResults(t *testing.T) {
+	server := newBatchServer(t, func(batch []map[string]any) any {
+		return []any{map[string]any{"status": 200}}
+	})
+
+	result, failed := runHTTPTarget(t, server, core.Arguments{"batchsize": 2, "resultspath": "."}, sendRows(1, 2))
+	if result.Err != nil || result.Written != 0 || len(failed) != 2 {
+		t.Errorf("Target result = %s with %d dead-lettered rows, want 2 failed", result, len(failed))
+	}
+}
+
+func TestHTTPTargetMaxBytes(t *testing.T) {
+	server := newBatchServer(t, func(batch []map[string]any) any { return nil })
+
+	// Each `{"id":N}` item takes 9 bytes with its separator.
+	for _, test := range []struct {
+		args  core.Arguments
+		sizes []int
+	}{
+		{core.Arguments{"maxbytes": 20}, []int{2, 2, 2, 1}},
+		{core.Arguments{"maxbytes": 30, "batchsize": 2}, []int{2, 2, 2, 1}},
+		{core.Arguments{"maxbytes": 30}, []int{3, 3, 1}},
+		{core.Arguments{"maxbytes": 5}, []int{1, 1, 1, 1, 1, 1, 1}},
+	} {
+		server.batches = nil
+		result, _ := runHTTPTarget(t, server, test.args, sendRows(1, 7))
+		if sizes := server.sizes(); result.Written != 7 || !reflect.DeepEqual(sizes, test.sizes) {
+			t.Errorf("Target with %v sent batches of %v rows (%s), want %v", test.args, sizes, result, test.sizes)
+		}
+	}
+}
+
+func TestHTTPTargetFlushInterval(t *testing.T) {
+	server := newBatchServer(t, func(batch []map[string]any) any { return nil })
+
+	result, _ := runHTTPTarget(t, server, core.Arguments{"batchsize": 10, "flushinterval": "20ms"}, func(in chan<- core.RowMap) {
+		sendRows(1, 2)(in)
+		deadline := time.Now().Add(5 * time.Second)
+		for len(server.sizes()) == 0 {
+			if time.Now().After(deadline) {
+				t.Error("Incomplete batch wasn't flushed after the flush interval")
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		sendRows(3, 3)(in)
+	})
+
+	if sizes := server.sizes(); result.Written != 3 || !reflect.DeepEqual(sizes, []int{2, 1}) {
+		t.Errorf("Target sent batches of %v rows (%s), want [2 1]", sizes, result)
+	}
+}
@@ -21,11 +21,14 @@
 package targets
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
-	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/tnotstar/datacat/core"
@@ -43,8 +46,15 @@ type JSONLinesTarget struct {
 	fileName string
 	// The `batchSize` of the batch to be written.
 	batchSize int
+	// The `compression` format of the file.
+	compression string
+	// The `level` of compression.
+	level int
 }
 
+// The default number of rows written between flushes of a file target.
+const defaultBatchSize = 1000
+
 // `IsaJSONLFileTarget` returns true if given target type
 // is a JSONLines.
 func IsaJSONLFileTarget(sourceType string) bool {
@@ -55,52 +65,124 @@ func IsaJSONLFileTarget(sourceType string) bool {
 //
 // The `cfg` is the global configuration object.
 // The `taskName` is the name of the task to be executed.
-func NewJSONLFileTarget(id int, cfg core.Configurator, taskName string) *JSONLinesTarget {
+func NewJSONLFileTarget(id int, cfg core.Configurator, taskName string) (core.Target, error) {
 	targetConfig, _ := cfg.GetTargetConfig(taskName)
 
-	fileName := fmt.Sprint(targetConfig.Arguments["filename"])
-	batchSize, _ := strconv.Atoi(fmt.Sprint(targetConfig.Arguments["batchsize"]))
+	fileName, err := targetConfig.Arguments.RequiredString("filename")
+	if err != nil {
+		return nil, err
+	}
 
-	return &JSONLinesTarget{
-		id:        id,
-		task:      taskName,
-		fileName:  fileName,
-		batchSize: batchSize,
+	if !strings.Contains(fileName, "%") && targetConfig.GetParallelism() > 1 {
+		return nil, fmt.Errorf("Filename '%s' needs a '%%d' pattern for parallel instances", fileName)
+	}
+
+	batchSize, err := targetConfig.Arguments.Int("batchsize", defaultBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	if batchSize < 1 {
+		batchSize = 1
 	}
+
+	compression, level, err := getCompression(targetConfig.Arguments, fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &JSONLinesTarget{
+		id:          id,
+		task:        taskName,
+		fileName:    fileName,
+		batchSize:   batchSize,
+		compression: compression,
+		level:       level,
+	}, nil
 }
 
 // `Run` creates a goroutine that reads data from the database and sends
 // it to an output channel. It returns a channel that will receive the
 // data read from the database.
-func (tgt *JSONLinesTarget) Run(wg *sync.WaitGroup, in <-chan core.RowMap) {
+func (tgt *JSONLinesTarget) Run(ctx context.Context, wg *sync.WaitGroup, trk *core.Tracker, in <-chan core.RowMap) {
 	log.Printf("* Creating instance #%d of JSONLines file target for task '%s'...", tgt.id, tgt.task)
+	stage := fmt.Sprintf("target#%d", tgt.id)
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 
-		fileName := fmt.Sprintf(tgt.fileName, tgt.id)
+		fileName := tgt.fileName
+		if strings.Contains(fileName, "%") {
+			fileName = fmt.Sprintf(tgt.fileName, tgt.id)
+		}
 		log.Printf(" - Creating JSONLines target file: '%s'...", fileName)
 
-		writer, err := os.Create(fileName)
+		file, err := createFile(fileName, trk)
 		if err != nil {
-			log.Fatalf("Error creating file %s: %s", fileName, err.Error())
+			trk.Abort(stage, fmt.Errorf("Error creating file %s: %w", fileName, err))
+			return
 		}
-		defer writer.Close()
+		compressor, err := core.NewCompressor(file, tgt.compression, tgt.level)
+		if err != nil {
+			file.Close()
+			trk.Abort(stage, fmt.Errorf("Error creating file %s: %w", fileName, err))
+			return
+		}
+
+		// Rows are acknowledged once they have been flushed to the file.
+		writer := bufio.NewWriter(compressor)
+		batch := make([]core.RowMap, 0, tgt.batchSize)
+		flush := func() error {
+			if err := writer.Flush(); err != nil {
+				return err
+			}
+			if err := compressor.Flush(); err != nil {
+				return err
+			}
+			size, err := file.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return err
+			}
+			trk.Flushed(batch, fileName, size)
+			batch = batch[:0]
+			return nil
+		}
+
+		defer func() {
+			if err := flush(); err != nil {
+				trk.Abort(stage, fmt.Errorf("Error flushing file %s: %w", fileName, err))
+			}
+			if err := compressor.Close(); err != nil {
+				trk.Abort(stage, fmt.Errorf("Error closing file %s: %w", fileName, err))
+			}
+			if err := file.Close(); err != nil {
+				trk.Abort(stage, fmt.Errorf("Error closing file %s: %w", fileName, err))
+			}
+		}()
 
 		counter := 0
 		for row := range in {
-			buffer, err := json.Marshal(row)
-			if err != nil {
-				log.Fatalf("Error marshalling data row: %s", err.Error())
+			if ctx.Err() != nil {
+				break
 			}
-			if _, err := writer.Write(buffer); err != nil {
-				log.Fatalf("Error writing data row: %s", err.Error())
+
+			buffer, err := json.Marshal(row.Data())
+			if err != nil {
+				trk.Fail(stage, row, fmt.Errorf("Error marshalling data row: %w", err))
+				continue
 			}
-			if _, err := writer.WriteString("\n"); err != nil {
-				log.Fatalf("Error writing line terminator: %s", err.Error())
+			if _, err := writer.Write(append(buffer, '\n')); err != nil {
+				trk.Abort(stage, fmt.Errorf("Error writing data row: %w", err))
+				return
 			}
 
+			batch = append(batch, row)
+			if len(batch) >= tgt.batchSize {
+				if err := flush(); err != nil {
+					trk.Abort(stage, fmt.Errorf("Error flushing file %s: %w", fileName, err))
+					return
+				}
+			}
 			counter++
 		}
 
@@ -109,3 +191,63 @@ func (tgt *JSONLinesTarget) Run(wg *sync.WaitGroup, in <-chan core.RowMap) {
 
 	log.Printf("* JSONLines target with filename pattern '%s' started successfully!", tgt.fileName)
 }
+
+// `getCompression` returns the compression format and level of a file
+// target, from its `compression` and `compressionlevel` arguments.
+func getCompression(args core.Arguments, fileName string) (string, int, error) {
+	compression, err := core.DetectCompression(fileName, args.String("compression", core.CompressionAuto))
+	if err != nil {
+		return "", 0, err
+	}
+	if compression == core.CompressionBzip2 {
+		return "", 0, fmt.Errorf("Compression format %s is read-only", compression)
+	}
+
+	level, err := args.Int("compressionlevel", 0)
+	if err != nil {
+		return "", 0, err
+	}
+	return compression, level, nil
+}
+
+// `createFile` creates or truncates the file with given name, and
+// records its size in the checkpoint of the task, if any. When the task
+// resumes a previous execution, the file is opened for appending, once
+// cut back to its size at the resumed checkpoint, which drops the rows
+// written after it and any incomplete compressed stream.
+func createFile(fileName string, trk *core.Tracker) (*os.File, error) {
+	if !trk.Resuming() {
+		file, err := os.Create(fileName)
+		if err == nil {
+			trk.Flushed(nil, fileName, 0)
+		}
+		return file, err
+	}
+
+	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if checkpointed, ok := trk.OutputSize(fileName); ok && checkpointed != size {
+		if checkpointed > size {
+			file.Close()
+			return nil, fmt.Errorf("File is shorter than at the last checkpoint (%d < %d bytes)", size, checkpointed)
+		}
+		log.Printf(" - Cutting file '%s' back to its %d byte(s) at the last checkpoint...", fileName, checkpointed)
+		if err := file.Truncate(checkpointed); err != nil {
+			file.Close()
+			return nil, err
+		}
+		if size, err = file.Seek(checkpointed, io.SeekStart); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	trk.Flushed(nil, fileName, size)
+	return file, nil
+}
@@ -0,0 +1,785 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package targets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"math/big"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	kpzstd "github.com/klauspost/compress/zstd"
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+	"github.com/parquet-go/parquet-go/compress/gzip"
+	"github.com/parquet-go/parquet-go/compress/zstd"
+	"github.com/tnotstar/datacat/core"
+)
+
+// The defaults of the Parquet file targets.
+const (
+	defaultInferRows    = 100
+	defaultRowGroupSize = 100000
+)
+
+// The types of the columns of a Parquet file.
+const (
+	parquetString    = "string"
+	parquetJSON      = "json"
+	parquetBytes     = "bytes"
+	parquetBoolean   = "boolean"
+	parquetInt32     = "int32"
+	parquetInt64     = "int64"
+	parquetFloat     = "float"
+	parquetDouble    = "double"
+	parquetTimestamp = "timestamp"
+	parquetDate      = "date"
+	parquetDecimal   = "decimal"
+)
+
+// The `maxDecimalPrecision` of the decimal columns, as in most engines.
+const maxDecimalPrecision = 38
+
+// `ParquetFileTarget` is the concrete implementation of the target
+// interface for Parquet files. It reads data from a given processing
+// channel and writes the rows to the row groups of a file, which is
+// completed when the task ends.
+type ParquetFileTarget struct {
+	// The `id` of the target.
+	id int
+	// The `task` of the task which is running into.
+	task string
+	// The `fileName` of the file to be created.
+	fileName string
+	// The `columns` of the configured schema, sorted by name. If empty,
+	// the schema is inferred from the first `inferRows` rows.
+	columns []*parquetColumn
+	// The number of `inferRows` to infer the schema from.
+	inferRows int
+	// The `rowGroupSize` is the number of rows of each row group.
+	rowGroupSize int
+	// The `codec` which compresses the pages of the columns.
+	codec compress.Codec
+}
+
+// `IsaParquetFileTarget` returns true if given target type
+// is a Parquet file.
+func IsaParquetFileTarget(targetType string) bool {
+	return targetType == "parquet-file-target"
+}
+
+// `NewParquetFileTarget` creates a new instance of the Parquet target endpoint.
+//
+// The `cfg` is the global configuration object.
+// The `taskName` is the name of the task to be executed.
+func NewParquetFileTarget(id int, cfg core.Configurator, taskName string) (core.Target, error) {
+	targetConfig, _ := cfg.GetTargetConfig(taskName)
+	args := targetConfig.Arguments
+
+	fileName, err := args.RequiredString("filename")
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.Contains(fileName, "%") && targetConfig.GetParallelism() > 1 {
+		return nil, fmt.Errorf("Filename '%s' needs a '%%d' pattern for parallel instances", fileName)
+	}
+
+	schema, err := args.Map("schema")
+	if err != nil {
+		return nil, err
+	}
+	columns := make([]*parquetColumn, 0, len(schema))
+	for name := range schema {
+		column, err := parseParquetType(name, schema.String(name, ""))
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+	sort.Slice(columns, func(i, j int) bool { return columns[i].name < columns[j].name })
+
+	inferRows, err := args.Int("inferrows", defaultInferRows)
+	if err != nil {
+		return nil, err
+	}
+	if inferRows < 1 {
+		return nil, fmt.Errorf("Invalid number of rows to infer the schema from: %d", inferRows)
+	}
+
+	rowGroupSize, err := args.Int("rowgroupsize", defaultRowGroupSize)
+	if err != nil {
+		return nil, err
+	}
+	if rowGroupSize < 1 {
+		return nil, fmt.Errorf("Invalid row group size: %d", rowGroupSize)
+	}
+
+	level, err := args.Int("compressionlevel", 0)
+	if err != nil {
+		return nil, err
+	}
+	codec, err := getParquetCodec(args.String("compression", "snappy"), level)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ParquetFileTarget{
+		id:           id,
+		task:         taskName,
+		fileName:     fileName,
+		columns:      columns,
+		inferRows:    inferRows,
+		rowGroupSize: rowGroupSize,
+		codec:        codec,
+	}, nil
+}
+
+// `getParquetCodec` returns the compression codec of the pages of a
+// Parquet file, by its name and level. A zero level is the default one.
+func getParquetCodec(name string, level int) (compress.Codec, error) {
+	switch strings.ToLower(name) {
+	case core.CompressionNone, "uncompressed":
+		return &parquet.Uncompressed, nil
+	case "snappy":
+		return &parquet.Snappy, nil
+	case "lz4":
+		return &parquet.Lz4Raw, nil
+	case "brotli":
+		return &parquet.Brotli, nil
+	case core.CompressionGzip:
+		if level == 0 {
+			return &parquet.Gzip, nil
+		}
+		if level < 1 || level > 9 {
+			return nil, fmt.Errorf("Invalid gzip compression level: %d", level)
+		}
+		return &gzip.Codec{Level: level}, nil
+	case core.CompressionZstd:
+		if level == 0 {
+			return &parquet.Zstd, nil
+		}
+		if level < 1 || level > 22 {
+			return nil, fmt.Errorf("Invalid zstd compression level: %d", level)
+		}
+		return &zstd.Codec{Level: kpzstd.EncoderLevelFromZstd(level)}, nil
+	}
+	return nil, fmt.Errorf("Invalid Parquet compression codec: %s", name)
+}
+
+// `Run` creates a goroutine that reads rows from the input channel and
+// writes them to the row groups of the file. The rows are acknowledged
+// once the file is completed, since it can't be read before.
+func (tgt *ParquetFileTarget) Run(ctx context.Context, wg *sync.WaitGroup, trk *core.Tracker, in <-chan core.RowMap) {
+	log.Printf("* Creating instance #%d of Parquet file target for task '%s'...", tgt.id, tgt.task)
+	stage := fmt.Sprintf("target#%d", tgt.id)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		fileName := tgt.fileName
+		if strings.Contains(fileName, "%") {
+			fileName = fmt.Sprintf(tgt.fileName, tgt.id)
+		}
+		log.Printf(" - Creating Parquet target file: '%s'...", fileName)
+
+		if trk.Resuming() {
+			trk.Abort(stage, fmt.Errorf("Parquet file %s can't be appended to by a resumed task", fileName))
+			return
+		}
+
+		file, err := os.Create(fileName)
+		if err != nil {
+			trk.Abort(stage, fmt.Errorf("Error creating file %s: %w", fileName, err))
+			return
+		}
+		completed := false
+		defer func() {
+			file.Close()
+			if !completed {
+				os.Remove(fileName)
+			}
+		}()
+
+		var writer *parquetWriter
+		var pending []core.RowMap
+		if len(tgt.columns) > 0 {
+			writer = tgt.newWriter(file, tgt.columns, true)
+		}
+		for row := range in {
+			if ctx.Err() != nil {
+				break
+			}
+
+			if writer == nil {
+				pending = append(pending, row)
+				if len(pending) < tgt.inferRows {
+					continue
+				}
+				if writer, err = tgt.inferWriter(file, pending); err != nil {
+					trk.Abort(stage, fmt.Errorf("Error inferring schema of file %s: %w", fileName, err))
+					return
+				}
+				for _, row := range pending {
+					writer.write(trk, stage, row)
+				}
+				pending = nil
+			} else {
+				writer.write(trk, stage, row)
+			}
+			if writer.err != nil {
+				trk.Abort(stage, fmt.Errorf("Error writing file %s: %w", fileName, writer.err))
+				return
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		if writer == nil {
+			if writer, err = tgt.inferWriter(file, pending); err != nil {
+				trk.Abort(stage, fmt.Errorf("Error inferring schema of file %s: %w", fileName, err))
+				return
+			}
+			for _, row := range pending {
+				writer.write(trk, stage, row)
+			}
+		}
+		if writer.err == nil {
+			writer.err = writer.Close()
+		}
+		if writer.err == nil {
+			writer.err = file.Close()
+		}
+		if writer.err != nil {
+			trk.Abort(stage, fmt.Errorf("Error writing file %s: %w", fileName, writer.err))
+			return
+		}
+		completed = true
+		trk.Flushed(writer.written, "", 0)
+
+		log.Printf(" - Written %d row(s) to the Parquet target file: '%s'...", len(writer.written), fileName)
+	}()
+
+	log.Printf("* Parquet target with filename pattern '%s' started successfully!", tgt.fileName)
+}
+
+// `inferWriter` returns the writer of the file with the schema inferred
+// from the given rows.
+func (tgt *ParquetFileTarget) inferWriter(file *os.File, rows []core.RowMap) (*parquetWriter, error) {
+	columns, err := inferParquetColumns(rows)
+	if err != nil {
+		return nil, err
+	}
+	return tgt.newWriter(file, columns, false), nil
+}
+
+// `newWriter` returns the writer of the file with the given columns.
+// The fields of the rows out of a configured schema are left out, but
+// they fail the rows with an inferred one.
+func (tgt *ParquetFileTarget) newWriter(file *os.File, columns []*parquetColumn, configured bool) *parquetWriter {
+	group := make(parquet.Group, len(columns))
+	for _, column := range columns {
+		group[column.name] = parquet.Optional(column.node())
+	}
+
+	return &parquetWriter{
+		Writer: parquet.NewWriter(file,
+			parquet.NewSchema(tgt.task, group),
+			parquet.Compression(tgt.codec),
+			parquet.CreatedBy("datacat", "", ""),
+		),
+		columns:      columns,
+		configured:   configured,
+		indexes:      make(map[string]int),
+		rowGroupSize: tgt.rowGroupSize,
+	}
+}
+
+// A `parquetWriter` writes the rows to a Parquet file.
+type parquetWriter struct {
+	*parquet.Writer
+	// The `columns` of the file, sorted by name as in its schema.
+	columns []*parquetColumn
+	// `configured` is true if the schema is configured.
+	configured bool
+	// The `indexes` of the columns by field name, or -1 for the fields
+	// out of the schema.
+	indexes map[string]int
+	// The `rowGroupSize` is the number of rows of each row group.
+	rowGroupSize int
+	// The `buffered` number of rows of the current row group.
+	buffered int
+	// The `written` rows, only with their sequence number, to be
+	// acknowledged once the file is completed.
+	written []core.RowMap
+	// The `err` which stops writing the file.
+	err error
+}
+
+// `write` writes the given row to the file, failing it if its values
+// don't fit the schema, and flushes the row group once it's full.
+func (w *parquetWriter) write(trk *core.Tracker, stage string, row core.RowMap) {
+	values, err := w.values(row)
+	if err != nil {
+		trk.Fail(stage, row, err)
+		return
+	}
+	if _, w.err = w.WriteRows([]parquet.Row{values}); w.err != nil {
+		return
+	}
+
+	receipt := core.RowMap{}
+	if seq, ok := row[core.SequenceField]; ok {
+		receipt[core.SequenceField] = seq
+	}
+	w.written = append(w.written, receipt)
+
+	w.buffered += 1
+	if w.buffered == w.rowGroupSize {
+		w.err = w.Flush()
+		w.buffered = 0
+	}
+}
+
+// `values` returns the values of the columns of the given row.
+func (w *parquetWriter) values(row core.RowMap) (parquet.Row, error) {
+	values := make(parquet.Row, len(w.columns))
+	for i := range values {
+		values[i] = parquet.NullValue().Level(0, 0, i)
+	}
+
+	for field, value := range row.Data() {
+		i, err := w.index(field)
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 || value == nil {
+			continue
+		}
+
+		column := w.columns[i]
+		converted, err := column.value(value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s value of field '%s': %w", column, field, err)
+		}
+		values[i] = converted.Level(0, 1, i)
+	}
+	return values, nil
+}
+
+// `index` returns the index of the column of the given field, matched
+// regardless of case as the names of a configured schema are read in
+// lowercase, or -1 if it's out of a configured schema.
+func (w *parquetWriter) index(field string) (int, error) {
+	i, ok := w.indexes[field]
+	if !ok {
+		i = sort.Search(len(w.columns), func(i int) bool { return w.columns[i].name >= field })
+		if i == len(w.columns) || w.columns[i].name != field {
+			i = -1
+			for j, column := range w.columns {
+				if strings.EqualFold(column.name, field) {
+					i = j
+					break
+				}
+			}
+		}
+		w.indexes[field] = i
+	}
+
+	if i < 0 && !w.configured {
+		return i, fmt.Errorf("Field '%s' isn't in the schema inferred from the first rows", field)
+	}
+	return i, nil
+}
+
+// A `parquetColumn` is a column of the schema of a Parquet file.
+type parquetColumn struct {
+	// The `name` of the column.
+	name string
+	// The `kind` of the values of the column.
+	kind string
+	// The `precision` and `scale` of a decimal column.
+	precision, scale int
+}
+
+// The `decimalType` pattern of the decimal types, like `decimal(18,2)`.
+var decimalType = regexp.MustCompile(`^decimal\(\s*(\d+)\s*(?:,\s*(\d+)\s*)?\)$`)
+
+// `parseParquetType` returns the column with the given name and type,
+// like `int64` or `decimal(18,2)`.
+func parseParquetType(name string, spec string) (*parquetColumn, error) {
+	kind := strings.ToLower(strings.TrimSpace(spec))
+	switch kind {
+	case parquetString, parquetJSON, parquetBytes, parquetBoolean, parquetInt32, parquetInt64,
+		parquetFloat, parquetDouble, parquetTimestamp, parquetDate:
+		return &parquetColumn{name: name, kind: kind}, nil
+	}
+
+	match := decimalType.FindStringSubmatch(kind)
+	if match == nil {
+		return nil, fmt.Errorf("Invalid Parquet type '%s' of column '%s'", spec, name)
+	}
+	precision, _ := strconv.Atoi(match[1])
+	scale := 0
+	if match[2] != "" {
+		scale, _ = strconv.Atoi(match[2])
+	}
+	if precision < 1 || precision > maxDecimalPrecision || scale > precision {
+		return nil, fmt.Errorf("Invalid Parquet type '%s' of column '%s'", spec, name)
+	}
+	return &parquetColumn{name: name, kind: parquetDecimal, precision: precision, scale: scale}, nil
+}
+
+// `String` returns the type of the column as configured.
+func (column *parquetColumn) String() string {
+	if column.kind == parquetDecimal {
+		return fmt.Sprintf("decimal(%d,%d)", column.precision, column.scale)
+	}
+	return column.kind
+}
+
+// `node` returns the node of the column in the schema of the file.
+func (column *parquetColumn) node() parquet.Node {
+	switch column.kind {
+	case parquetString:
+		return parquet.String()
+	case parquetJSON:
+		return parquet.JSON()
+	case parquetBoolean:
+		return parquet.Leaf(parquet.BooleanType)
+	case parquetInt32:
+		return parquet.Int(32)
+	case parquetInt64:
+		return parquet.Int(64)
+	case parquetFloat:
+		return parquet.Leaf(parquet.FloatType)
+	case parquetDouble:
+		return parquet.Leaf(parquet.DoubleType)
+	case parquetTimestamp:
+		return parquet.Timestamp(parquet.Microsecond)
+	case parquetDate:
+		return parquet.Date()
+	case parquetDecimal:
+		switch {
+		case column.precision <= 9:
+			return parquet.Decimal(column.scale, column.precision, parquet.Int32Type)
+		case column.precision <= 18:
+			return parquet.Decimal(column.scale, column.precision, parquet.Int64Type)
+		}
+		return parquet.Decimal(column.scale, column.precision, parquet.FixedLenByteArrayType(decimalSize(column.precision)))
+	}
+	return parquet.Leaf(parquet.ByteArrayType)
+}
+
+// `decimalSize` returns the number of bytes of the unscaled values of
+// decimals with the given precision, in two's complement.
+func decimalSize(precision int) int {
+	return int(math.Ceil((float64(precision)*math.Log2(10) + 1) / 8))
+}
+
+// `value` returns the Parquet value of the given non-null field value.
+func (column *parquetColumn) value(value any) (parquet.Value, error) {
+	switch column.kind {
+	case parquetString:
+		text, err := formatText(value)
+		return parquet.ByteArrayValue([]byte(text)), err
+	case parquetJSON:
+		buffer, err := json.Marshal(value)
+		return parquet.ByteArrayValue(buffer), err
+	case parquetBytes:
+		switch value := value.(type) {
+		case []byte:
+			return parquet.ByteArrayValue(value), nil
+		case string:
+			return parquet.ByteArrayValue([]byte(value)), nil
+		}
+	case parquetBoolean:
+		switch value := value.(type) {
+		case bool:
+			return parquet.BooleanValue(value), nil
+		case string:
+			flag, err := strconv.ParseBool(value)
+			return parquet.BooleanValue(flag), err
+		}
+	case parquetInt32:
+		number, err := toInt64(value)
+		if err == nil && (number < math.MinInt32 || number > math.MaxInt32) {
+			err = fmt.Errorf("%d is out of range", number)
+		}
+		return parquet.Int32Value(int32(number)), err
+	case parquetInt64:
+		number, err := toInt64(value)
+		return parquet.Int64Value(number), err
+	case parquetFloat:
+		number, err := toFloat64(value)
+		return parquet.FloatValue(float32(number)), err
+	case parquetDouble:
+		number, err := toFloat64(value)
+		return parquet.DoubleValue(number), err
+	case parquetTimestamp:
+		instant, err := toTime(value)
+		return parquet.Int64Value(instant.UnixMicro()), err
+	case parquetDate:
+		instant, err := toTime(value)
+		date := time.Date(instant.Year(), instant.Month(), instant.Day(), 0, 0, 0, 0, time.UTC)
+		return parquet.Int32Value(int32(date.Unix() / (24 * 60 * 60))), err
+	case parquetDecimal:
+		return column.decimalValue(value)
+	}
+	return parquet.Value{}, fmt.Errorf("unexpected %T value", value)
+}
+
+// `decimalValue` returns the unscaled value of the given decimal value,
+// which must fit the precision and scale of the column.
+func (column *parquetColumn) decimalValue(value any) (parquet.Value, error) {
+	var text string
+	switch value := value.(type) {
+	case json.Number:
+		text = value.String()
+	case string:
+		text = strings.TrimSpace(value)
+	case float32:
+		text = strconv.FormatFloat(float64(value), 'f', -1, 32)
+	case float64:
+		text = strconv.FormatFloat(value, 'f', -1, 64)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		text = fmt.Sprint(value)
+	default:
+		return parquet.Value{}, fmt.Errorf("unexpected %T value", value)
+	}
+
+	number, ok := new(big.Rat).SetString(text)
+	if !ok {
+		return parquet.Value{}, fmt.Errorf("'%s' isn't a number", text)
+	}
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(column.scale)), nil)
+	number.Mul(number, new(big.Rat).SetInt(scale))
+	if !number.IsInt() {
+		return parquet.Value{}, fmt.Errorf("%s has more than %d decimal(s)", text, column.scale)
+	}
+	unscaled := number.Num()
+	limit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(column.precision)), nil)
+	if new(big.Int).Abs(unscaled).Cmp(limit) >= 0 {
+		return parquet.Value{}, fmt.Errorf("%s has more than %d digit(s)", text, column.precision)
+	}
+
+	switch {
+	case column.precision <= 9:
+		return parquet.Int32Value(int32(unscaled.Int64())), nil
+	case column.precision <= 18:
+		return parquet.Int64Value(unscaled.Int64()), nil
+	}
+
+	// The unscaled value in big-endian two's complement.
+	size := decimalSize(column.precision)
+	if unscaled.Sign() < 0 {
+		unscaled.Add(unscaled, new(big.Int).Lsh(big.NewInt(1), uint(8*size)))
+	}
+	return parquet.FixedLenByteArrayValue(unscaled.FillBytes(make([]byte, size))), nil
+}
+
+// `formatText` returns the text of the given value for a string column.
+func formatText(value any) (string, error) {
+	switch value := value.(type) {
+	case string:
+		return value, nil
+	case []byte:
+		return string(value), nil
+	case time.Time:
+		return value.Format(time.RFC3339Nano), nil
+	case map[string]any, []any:
+		buffer, err := json.Marshal(value)
+		return string(buffer), err
+	}
+	return fmt.Sprint(value), nil
+}
+
+// `toInt64` returns the given integer value, or a number or a text of
+// an integer.
+func toInt64(value any) (int64, error) {
+	switch value := value.(type) {
+	case int:
+		return int64(value), nil
+	case int8:
+		return int64(value), nil
+	case int16:
+		return int64(value), nil
+	case int32:
+		return int64(value), nil
+	case int64:
+		return value, nil
+	case uint:
+		return toInt64(uint64(value))
+	case uint8:
+		return int64(value), nil
+	case uint16:
+		return int64(value), nil
+	case uint32:
+		return int64(value), nil
+	case uint64:
+		if value > math.MaxInt64 {
+			return 0, fmt.Errorf("%d is out of range", value)
+		}
+		return int64(value), nil
+	case float32:
+		return toInt64(float64(value))
+	case float64:
+		if value != math.Trunc(value) || math.Abs(value) >= 1<<63 {
+			return 0, fmt.Errorf("%v isn't an integer", value)
+		}
+		return int64(value), nil
+	case json.Number:
+		return value.Int64()
+	case string:
+		return strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	}
+	return 0, fmt.Errorf("unexpected %T value", value)
+}
+
+// `toFloat64` returns the given number value, or a text of a number.
+func toFloat64(value any) (float64, error) {
+	switch value := value.(type) {
+	case float32:
+		return float64(value), nil
+	case float64:
+		return value, nil
+	case json.Number:
+		return value.Float64()
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(value), 64)
+	}
+	number, err := toInt64(value)
+	return float64(number), err
+}
+
+// `toTime` returns the given time value, or an RFC 3339 text of a time
+// or a date.
+func toTime(value any) (time.Time, error) {
+	switch value := value.(type) {
+	case time.Time:
+		return value, nil
+	case string:
+		if instant, err := time.Parse(time.RFC3339Nano, value); err == nil {
+			return instant, nil
+		}
+		return time.Parse(time.DateOnly, value)
+	}
+	return time.Time{}, fmt.Errorf("unexpected %T value", value)
+}
+
+// `inferParquetColumns` returns the columns of the fields of the given
+// rows, sorted by name, with the types of their values. The fields
+// without values are strings.
+func inferParquetColumns(rows []core.RowMap) ([]*parquetColumn, error) {
+	types := make(map[string]*parquetColumn)
+	for _, row := range rows {
+		for field, value := range row.Data() {
+			column := inferParquetType(field, value)
+			if previous, ok := types[field]; ok && column != nil {
+				var err error
+				if column, err = mergeParquetTypes(previous, column); err != nil {
+					return nil, err
+				}
+			}
+			if column != nil || types[field] == nil {
+				types[field] = column
+			}
+		}
+	}
+
+	columns := make([]*parquetColumn, 0, len(types))
+	for field, column := range types {
+		if column == nil {
+			column = &parquetColumn{name: field, kind: parquetString}
+		}
+		columns = append(columns, column)
+	}
+	sort.Slice(columns, func(i, j int) bool { return columns[i].name < columns[j].name })
+	return columns, nil
+}
+
+// `inferParquetType` returns the column of the given field for the given
+// value, or nil if it's null. Exact numbers with decimals are decimals
+// with the maximum precision.
+func inferParquetType(field string, value any) *parquetColumn {
+	column := &parquetColumn{name: field, kind: parquetString}
+	switch value := value.(type) {
+	case nil:
+		return nil
+	case bool:
+		column.kind = parquetBoolean
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		column.kind = parquetInt64
+	case float32, float64:
+		column.kind = parquetDouble
+	case time.Time:
+		column.kind = parquetTimestamp
+	case []byte:
+		column.kind = parquetBytes
+	case map[string]any, []any:
+		column.kind = parquetJSON
+	case json.Number:
+		text := value.String()
+		if strings.ContainsAny(text, "eE") {
+			column.kind = parquetDouble
+		} else if _, err := value.Int64(); err == nil {
+			column.kind = parquetInt64
+		} else {
+			column.kind = parquetDecimal
+			column.precision = maxDecimalPrecision
+			if _, decimals, ok := strings.Cut(text, "."); ok {
+				column.scale = min(len(decimals), maxDecimalPrecision)
+			}
+		}
+	}
+	return column
+}
+
+// `mergeParquetTypes` returns the column of a field with values of both
+// given types. Numbers widen to decimals or doubles.
+func mergeParquetTypes(first *parquetColumn, second *parquetColumn) (*parquetColumn, error) {
+	if first.kind == second.kind {
+		if first.scale < second.scale {
+			return second, nil
+		}
+		return first, nil
+	}
+
+	kinds := map[string]*parquetColumn{first.kind: first, second.kind: second}
+	switch {
+	case kinds[parquetDouble] != nil && (kinds[parquetInt64] != nil || kinds[parquetDecimal] != nil):
+		return kinds[parquetDouble], nil
+	case kinds[parquetDecimal] != nil && kinds[parquetInt64] != nil:
+		return kinds[parquetDecimal], nil
+	}
+	return nil, fmt.Errorf("Field '%s' has %s and %s values; set its type in the schema", first.name, first.kind, second.kind)
+}
@@ -0,0 +1,288 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package targets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/format"
+	"github.com/tnotstar/datacat/core"
+)
+
+// `writeParquet` writes the given rows with a Parquet file target with
+// the given arguments, and returns the name of the file and the error
+// of the task.
+func writeParquet(t *testing.T, args core.Arguments, rows ...core.RowMap) (string, error) {
+	t.Helper()
+	fileName := filepath.Join(t.TempDir(), "output.parquet")
+	args["filename"] = fileName
+	cfg := &core.Config{
+		Tasks: map[string]core.TaskConfig{
+			"test": {Target: core.TargetConfig{Type: "parquet-file-target", Arguments: args}},
+		},
+	}
+	tgt, err := BuildTarget(0, cfg, "test")
+	if err != nil {
+		t.Fatalf("BuildTarget failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	trk := core.NewTracker("test", cancel)
+
+	var wg sync.WaitGroup
+	in := make(chan core.RowMap)
+	tgt.Run(ctx, &wg, trk, in)
+	for _, row := range rows {
+		if !core.Send(ctx, in, row) {
+			break
+		}
+	}
+	close(in)
+	wg.Wait()
+	return fileName, trk.Err()
+}
+
+// `openParquet` opens the Parquet file with the given name.
+func openParquet(t *testing.T, fileName string) *parquet.File {
+	t.Helper()
+	file, err := os.Open(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { file.Close() })
+	info, err := file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parquetFile, err := parquet.OpenFile(file, info.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parquetFile
+}
+
+// `readParquetRows` returns the rows of the given file as maps of their
+// physical values.
+func readParquetRows(t *testing.T, file *parquet.File) []map[string]any {
+	t.Helper()
+	reader := parquet.NewReader(file)
+	defer reader.Close()
+
+	var rows []map[string]any
+	for {
+		row := map[string]any{}
+		if err := reader.Read(&row); err != nil {
+			break
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// `logicalTypes` returns the logical types of the columns of the given
+// file by name.
+func logicalTypes(file *parquet.File) map[string]string {
+	types := make(map[string]string)
+	for _, field := range file.Schema().Fields() {
+		types[field.Name()] = field.Type().String()
+	}
+	return types
+}
+
+func TestParquetInfersSchema(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	fileName, err := writeParquet(t, core.Arguments{"inferrows": 2},
+		core.RowMap{"id": int64(1), "name": "ann", "amount": json.Number("12.5"), "created": created, "note": nil},
+		core.RowMap{"id": json.Number("2"), "name": "bob", "amount": json.Number("-0.25"), "created": created, "score": 1.5},
+		core.RowMap{"id": 3, "name": nil, "amount": json.Number("7"), "created": nil, "score": 2},
+	)
+	if err != nil {
+		t.Fatalf("Target failed: %v", err)
+	}
+
+	file := openParquet(t, fileName)
+	want := map[string]string{
+		"amount":  "DECIMAL(38,2)",
+		"created": "TIMESTAMP(isAdjustedToUTC=true,unit=MICROS)",
+		"id":      "INT(64,true)",
+		"name":    "STRING",
+		"note":    "STRING",
+		"score":   "DOUBLE",
+	}
+	got := logicalTypes(file)
+	for column, typ := range want {
+		if got[column] != typ {
+			t.Errorf("type of column %s = %s, want %s", column, got[column], typ)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("columns = %v, want %v", got, want)
+	}
+
+	rows := readParquetRows(t, file)
+	if len(rows) != 3 {
+		t.Fatalf("read %d rows, want 3", len(rows))
+	}
+	if rows[0]["id"] != int64(1) || rows[2]["id"] != int64(3) || rows[1]["name"] != "bob" || rows[2]["name"] != nil {
+		t.Errorf("rows = %v", rows)
+	}
+	if rows[0]["created"] != created.UnixMicro() || rows[2]["created"] != nil {
+		t.Errorf("timestamps = %v, %v", rows[0]["created"], rows[2]["created"])
+	}
+	if rows[2]["score"] != 2.0 || rows[0]["score"] != nil {
+		t.Errorf("scores = %v, %v", rows[0]["score"], rows[2]["score"])
+	}
+}
+
+func TestParquetInferredSchemaFailsNewFields(t *testing.T) {
+	fileName, err := writeParquet(t, core.Arguments{"inferrows": 1},
+		core.RowMap{"id": 1},
+		core.RowMap{"id": 2, "extra": "x"},
+	)
+	if err == nil || !strings.Contains(err.Error(), "Field 'extra' isn't in the schema") {
+		t.Errorf("error of a new field = %v", err)
+	}
+	// The incomplete file of an aborted task isn't left behind.
+	if _, err := os.Stat(fileName); !os.IsNotExist(err) {
+		t.Errorf("file of an aborted task = %v", err)
+	}
+
+	_, err = writeParquet(t, core.Arguments{}, core.RowMap{"id": 1}, core.RowMap{"id": "one"})
+	if err == nil || !strings.Contains(err.Error(), "set its type in the schema") {
+		t.Errorf("error of mixed types = %v", err)
+	}
+}
+
+func TestParquetConfiguredSchema(t *testing.T) {
+	day := time.Date(2024, 2, 29, 23, 0, 0, 0, time.FixedZone("CET", 3600))
+	fileName, err := writeParquet(t, core.Arguments{
+		"schema": map[string]any{
+			"id":     "int32",
+			"amount": "decimal(20,4)",
+			"price":  "decimal(9,2)",
+			"day":    "date",
+			"tags":   "json",
+			"ratio":  "float",
+			"active": "boolean",
+		}},
+		// The fields are matched regardless of case, the others left out.
+		core.RowMap{"ID": 1, "amount": json.Number("-12345678901234.5678"), "price": "19.99", "day": day,
+			"tags": []any{"a", "b"}, "ratio": 0.5, "active": true, "ignored": "x"},
+		core.RowMap{"id": int64(2), "amount": 3, "price": json.Number("0.1"), "day": "2024-03-01", "active": "false"},
+	)
+	if err != nil {
+		t.Fatalf("Target failed: %v", err)
+	}
+
+	file := openParquet(t, fileName)
+	types := logicalTypes(file)
+	if types["amount"] != "DECIMAL(20,4)" || types["day"] != "DATE" || types["tags"] != "JSON" || types["id"] != "INT(32,true)" {
+		t.Errorf("types = %v", types)
+	}
+	if _, ok := types["ignored"]; ok {
+		t.Error("field out of the schema written")
+	}
+
+	rows := readParquetRows(t, file)
+	if len(rows) != 2 {
+		t.Fatalf("read %d rows, want 2", len(rows))
+	}
+	if rows[0]["id"] != int32(1) || rows[0]["price"] != int32(1999) || rows[1]["price"] != int32(10) {
+		t.Errorf("rows = %v", rows)
+	}
+	// The date of a time is the one of its own time zone.
+	if rows[0]["day"] != int32(19782) || rows[1]["day"] != int32(19783) {
+		t.Errorf("days = %v, %v", rows[0]["day"], rows[1]["day"])
+	}
+	if fmt.Sprint(rows[0]["tags"]) != "[a b]" || rows[1]["active"] != false {
+		t.Errorf("rows = %v", rows)
+	}
+}
+
+func TestParquetDecimalOutOfScale(t *testing.T) {
+	_, err := writeParquet(t, core.Arguments{"schema": map[string]any{"amount": "decimal(5,2)"}},
+		core.RowMap{"amount": json.Number("1.234")},
+	)
+	if err == nil || !strings.Contains(err.Error(), "more than 2 decimal(s)") {
+		t.Errorf("error of too many decimals = %v", err)
+	}
+
+	_, err = writeParquet(t, core.Arguments{"schema": map[string]any{"amount": "decimal(5,2)"}},
+		core.RowMap{"amount": json.Number("1234.5")},
+	)
+	if err == nil || !strings.Contains(err.Error(), "more than 5 digit(s)") {
+		t.Errorf("error of too many digits = %v", err)
+	}
+}
+
+func TestParquetRowGroupsAndCompression(t *testing.T) {
+	rows := make([]core.RowMap, 10)
+	for i := range rows {
+		rows[i] = core.RowMap{"id": i}
+	}
+	fileName, err := writeParquet(t, core.Arguments{"rowgroupsize": 4, "compression": "zstd", "compressionlevel": 3}, rows...)
+	if err != nil {
+		t.Fatalf("Target failed: %v", err)
+	}
+
+	file := openParquet(t, fileName)
+	var sizes []int64
+	for _, rowGroup := range file.Metadata().RowGroups {
+		sizes = append(sizes, rowGroup.NumRows)
+		if codec := rowGroup.Columns[0].MetaData.Codec; codec != format.Zstd {
+			t.Errorf("codec = %v, want %v", codec, format.Zstd)
+		}
+	}
+	if len(sizes) != 3 || sizes[0] != 4 || sizes[1] != 4 || sizes[2] != 2 {
+		t.Errorf("row groups = %v, want [4 4 2]", sizes)
+	}
+}
+
+func TestParquetInvalidArguments(t *testing.T) {
+	for _, args := range []core.Arguments{
+		{"schema": map[string]any{"id": "integer"}},
+		{"schema": map[string]any{"amount": "decimal(40,2)"}},
+		{"schema": map[string]any{"amount": "decimal(4,6)"}},
+		{"compression": "lzo"},
+		{"compression": "gzip", "compressionlevel": 12},
+		{"rowgroupsize": 0},
+	} {
+		args["filename"] = "output.parquet"
+		cfg := &core.Config{
+			Tasks: map[string]core.TaskConfig{
+				"test": {Target: core.TargetConfig{Type: "parquet-file-target", Arguments: args}},
+			},
+		}
+		if _, err := BuildTarget(0, cfg, "test"); err == nil {
+			t.Errorf("BuildTarget succeeded with %v", args)
+		}
+	}
+}
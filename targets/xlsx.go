@@ -0,0 +1,388 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package targets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/tnotstar/datacat/core"
+	"github.com/xuri/excelize/v2"
+)
+
+// The bounds of the automatic widths of the columns of a sheet.
+const (
+	minColumnWidth = 8
+	maxColumnWidth = 80
+)
+
+// `XLSXFileTarget` is the concrete implementation of the target interface
+// for Excel workbooks. It reads data from a given processing channel and
+// writes each row to a sheet of the workbook, which is saved at the end.
+type XLSXFileTarget struct {
+	// The `id` of the target.
+	id int
+	// The `task` of the task which is running into.
+	task string
+	// The `fileName` of the workbook to be created.
+	fileName string
+	// The `sheet` name of the rows.
+	sheet string
+	// The `sheetField` of the rows with the name of their sheet, if any.
+	sheetField string
+	// The `columns` of the sheets, in order. If empty, they are taken
+	// from the fields of the first row of each sheet, sorted by name.
+	columns []string
+	// `header` is true if the column names are written as first row.
+	header bool
+	// The `headerStyle` of the header cells.
+	headerStyle *excelize.Style
+	// The `dateFormat` of the date cells, as an Excel number format.
+	dateFormat string
+	// The `numberFormat` of the number cells, as an Excel number format.
+	numberFormat string
+	// `autoWidth` fits the width of the columns to their contents.
+	autoWidth bool
+}
+
+// The `xlsxSheet` state of a sheet being written.
+type xlsxSheet struct {
+	// The `name` of the sheet.
+	name string
+	// The `columns` of the sheet.
+	columns []string
+	// The `line` number of the last written row.
+	line int
+	// The `widths` of the contents of the columns.
+	widths []int
+}
+
+// `IsaXLSXFileTarget` returns true if given target type
+// is an Excel workbook.
+func IsaXLSXFileTarget(targetType string) bool {
+	return targetType == "xlsx-file-target"
+}
+
+// `NewXLSXFileTarget` creates a new instance of the XLSX target endpoint.
+//
+// The `cfg` is the global configuration object.
+// The `taskName` is the name of the task to be executed.
+func NewXLSXFileTarget(id int, cfg core.Configurator, taskName string) (core.Target, error) {
+	targetConfig, _ := cfg.GetTargetConfig(taskName)
+	args := targetConfig.Arguments
+
+	fileName, err := args.RequiredString("filename")
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.Contains(fileName, "%") && targetConfig.GetParallelism() > 1 {
+		return nil, fmt.Errorf("Filename '%s' needs a '%%d' pattern for parallel instances", fileName)
+	}
+
+	columns, err := args.Strings("columns")
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := args.Bool("header", true)
+	if err != nil {
+		return nil, err
+	}
+
+	styleArgs, err := args.Map("headerstyle")
+	if err != nil {
+		return nil, err
+	}
+	bold, err := styleArgs.Bool("bold", true)
+	if err != nil {
+		return nil, err
+	}
+	headerStyle := &excelize.Style{Font: &excelize.Font{Bold: bold, Color: styleArgs.String("color", "")}}
+	if fill := styleArgs.String("fill", ""); fill != "" {
+		headerStyle.Fill = excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{fill}}
+	}
+
+	autoWidth, err := args.Bool("autowidth", true)
+	if err != nil {
+		return nil, err
+	}
+
+	return &XLSXFileTarget{
+		id:           id,
+		task:         taskName,
+		fileName:     fileName,
+		sheet:        args.String("sheet", "Sheet1"),
+		sheetField:   args.String("sheetfield", ""),
+		columns:      columns,
+		header:       header,
+		headerStyle:  headerStyle,
+		dateFormat:   args.String("dateformat", "yyyy-mm-dd hh:mm:ss"),
+		numberFormat: args.String("numberformat", ""),
+		autoWidth:    autoWidth,
+	}, nil
+}
+
+// `Run` creates a goroutine that reads rows from the input channel and
+// writes them to the sheets of the workbook. The rows are acknowledged
+// once the workbook has been saved.
+func (tgt *XLSXFileTarget) Run(ctx context.Context, wg *sync.WaitGroup, trk *core.Tracker, in <-chan core.RowMap) {
+	log.Printf("* Creating instance #%d of XLSX file target for task '%s'...", tgt.id, tgt.task)
+	stage := fmt.Sprintf("target#%d", tgt.id)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		fileName := tgt.fileName
+		if strings.Contains(fileName, "%") {
+			fileName = fmt.Sprintf(tgt.fileName, tgt.id)
+		}
+		log.Printf(" - Creating XLSX target file: '%s'...", fileName)
+
+		if trk.Resuming() {
+			trk.Abort(stage, fmt.Errorf("XLSX file %s can't be appended to by a resumed task", fileName))
+			return
+		}
+
+		file := excelize.NewFile()
+		defer file.Close()
+
+		styles, err := tgt.newStyles(file)
+		if err != nil {
+			trk.Abort(stage, fmt.Errorf("Error creating styles of file %s: %w", fileName, err))
+			return
+		}
+
+		sheets := make(map[string]*xlsxSheet)
+		var order []*xlsxSheet
+		var written []core.RowMap
+		for row := range in {
+			if ctx.Err() != nil {
+				break
+			}
+
+			name := tgt.sheet
+			if value, ok := row[tgt.sheetField]; ok && value != nil && tgt.sheetField != "" {
+				name = fmt.Sprint(value)
+			}
+
+			sheet, ok := sheets[name]
+			if !ok {
+				sheet, err = tgt.newSheet(file, name, len(order) == 0, styles, row)
+				if err != nil {
+					trk.Fail(stage, row, fmt.Errorf("Error creating sheet '%s': %w", name, err))
+					continue
+				}
+				sheets[name] = sheet
+				order = append(order, sheet)
+			}
+
+			if err := tgt.writeRow(file, sheet, styles, row); err != nil {
+				trk.Fail(stage, row, err)
+				continue
+			}
+			written = append(written, row)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		if len(order) == 0 {
+			if _, err := tgt.newSheet(file, tgt.sheet, true, styles, nil); err != nil {
+				trk.Abort(stage, fmt.Errorf("Error creating sheet '%s': %w", tgt.sheet, err))
+				return
+			}
+		}
+		if tgt.autoWidth {
+			for _, sheet := range order {
+				if err := sheet.fitWidths(file); err != nil {
+					trk.Abort(stage, fmt.Errorf("Error sizing columns of sheet '%s': %w", sheet.name, err))
+					return
+				}
+			}
+		}
+
+		if err := file.SaveAs(fileName); err != nil {
+			trk.Abort(stage, fmt.Errorf("Error saving file %s: %w", fileName, err))
+			return
+		}
+		trk.Flushed(written, "", 0)
+
+		log.Printf(" - Written %d row(s) to the XLSX target file: '%s'...", len(written), fileName)
+	}()
+
+	log.Printf("* XLSX target with filename pattern '%s' started successfully!", tgt.fileName)
+}
+
+// The `xlsxStyles` of the cells of a workbook.
+type xlsxStyles struct {
+	header int
+	date   int
+	number int
+}
+
+// `newStyles` creates the styles of the cells in the given workbook.
+func (tgt *XLSXFileTarget) newStyles(file *excelize.File) (*xlsxStyles, error) {
+	styles := &xlsxStyles{}
+
+	var err error
+	if styles.header, err = file.NewStyle(tgt.headerStyle); err != nil {
+		return nil, err
+	}
+	if styles.date, err = file.NewStyle(&excelize.Style{CustomNumFmt: &tgt.dateFormat}); err != nil {
+		return nil, err
+	}
+	if tgt.numberFormat != "" {
+		if styles.number, err = file.NewStyle(&excelize.Style{CustomNumFmt: &tgt.numberFormat}); err != nil {
+			return nil, err
+		}
+	}
+	return styles, nil
+}
+
+// `newSheet` creates the sheet with the given name, which replaces the
+// default sheet of the workbook if it's the first one, and writes its
+// header. The columns are taken from the given row if not configured.
+func (tgt *XLSXFileTarget) newSheet(file *excelize.File, name string, first bool, styles *xlsxStyles, row core.RowMap) (*xlsxSheet, error) {
+	if first {
+		if err := file.SetSheetName(file.GetSheetName(0), name); err != nil {
+			return nil, err
+		}
+	} else if _, err := file.NewSheet(name); err != nil {
+		return nil, err
+	}
+	if index, err := file.GetSheetIndex(name); err != nil || index < 0 {
+		return nil, errors.Join(errors.New("Invalid sheet name"), err)
+	}
+
+	columns := tgt.columns
+	if len(columns) == 0 {
+		columns = sortedKeys(row)
+		if tgt.sheetField != "" {
+			columns = removeColumn(columns, tgt.sheetField)
+		}
+	}
+
+	sheet := &xlsxSheet{name: name, columns: columns, widths: make([]int, len(columns))}
+	if !tgt.header || len(columns) == 0 {
+		return sheet, nil
+	}
+
+	sheet.line = 1
+	for i, column := range columns {
+		cell, _ := excelize.CoordinatesToCellName(i+1, sheet.line)
+		if err := file.SetCellValue(name, cell, column); err != nil {
+			return nil, err
+		}
+		sheet.widths[i] = utf8.RuneCountInString(column)
+	}
+	from, _ := excelize.CoordinatesToCellName(1, sheet.line)
+	to, _ := excelize.CoordinatesToCellName(len(columns), sheet.line)
+	return sheet, file.SetCellStyle(name, from, to, styles.header)
+}
+
+// `writeRow` writes the given row to the next row of the given sheet,
+// with typed cells.
+func (tgt *XLSXFileTarget) writeRow(file *excelize.File, sheet *xlsxSheet, styles *xlsxStyles, row core.RowMap) error {
+	line := sheet.line + 1
+	for i, column := range sheet.columns {
+		value, style, width, err := tgt.cellValue(row[column], styles)
+		if err != nil {
+			return fmt.Errorf("Error formatting field '%s': %w", column, err)
+		}
+		if value == nil {
+			continue
+		}
+
+		cell, _ := excelize.CoordinatesToCellName(i+1, line)
+		if err := file.SetCellValue(sheet.name, cell, value); err != nil {
+			return fmt.Errorf("Error writing field '%s': %w", column, err)
+		}
+		if style != 0 {
+			if err := file.SetCellStyle(sheet.name, cell, cell, style); err != nil {
+				return fmt.Errorf("Error writing field '%s': %w", column, err)
+			}
+		}
+		sheet.widths[i] = max(sheet.widths[i], width)
+	}
+	sheet.line = line
+	return nil
+}
+
+// `cellValue` returns the cell value of the given field value, with its
+// style and the width of its contents.
+func (tgt *XLSXFileTarget) cellValue(value any, styles *xlsxStyles) (any, int, int, error) {
+	switch value := value.(type) {
+	case nil:
+		return nil, 0, 0, nil
+	case time.Time:
+		return value, styles.date, len(tgt.dateFormat), nil
+	case json.Number:
+		if number, err := value.Int64(); err == nil {
+			return number, styles.number, len(value), nil
+		}
+		number, err := value.Float64()
+		return number, styles.number, len(value), err
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return value, styles.number, len(fmt.Sprint(value)), nil
+	case bool:
+		return value, 0, len(fmt.Sprint(value)), nil
+	case []byte:
+		return string(value), 0, utf8.RuneCount(value), nil
+	case map[string]any, []any:
+		buffer, err := json.Marshal(value)
+		return string(buffer), 0, utf8.RuneCount(buffer), err
+	}
+	text := fmt.Sprint(value)
+	return text, 0, utf8.RuneCountInString(text), nil
+}
+
+// `fitWidths` sets the width of the columns of the sheet to fit their
+// contents.
+func (sheet *xlsxSheet) fitWidths(file *excelize.File) error {
+	for i, width := range sheet.widths {
+		column, _ := excelize.ColumnNumberToName(i + 1)
+		width := min(max(width+2, minColumnWidth), maxColumnWidth)
+		if err := file.SetColWidth(sheet.name, column, column, float64(width)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// `removeColumn` returns the given columns without the given one.
+func removeColumn(columns []string, column string) []string {
+	kept := make([]string, 0, len(columns))
+	for _, name := range columns {
+		if name != column {
+			kept = append(kept, name)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,95 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tasks
+
+import (
+	"errors"
+	"log"
+
+	"github.com/tnotstar/datacat/core"
+)
+
+// `startCheckpoint` sets up the checkpointing of the task, if it's
+// configured, and returns its checkpointer.
+//
+// When `resume` is true the task continues from its last checkpoint:
+// a resumable source with a checkpoint key restarts after the last
+// processed key, otherwise the rows already processed are skipped.
+func startCheckpoint(cfg core.Configurator, taskName string, taskConfig *core.TaskConfig, sourceList []core.Source, trk *core.Tracker, resume bool) (*core.Checkpointer, error) {
+	if taskConfig.Checkpoint == nil {
+		if resume {
+			return nil, errors.New("Can't resume a task without checkpoint configuration")
+		}
+		return nil, nil
+	}
+
+	// The rows of parallel sources are merged in no particular order.
+	if len(sourceList) > 1 {
+		return nil, errors.New("Can't checkpoint a task with a partitioned source")
+	}
+	source := sourceList[0]
+
+	store := core.OpenStateStore(cfg, taskName)
+	var last *core.Checkpoint
+	if resume {
+		state, err := store.Load()
+		if err != nil {
+			return nil, err
+		}
+
+		last = state.Checkpoint
+		if last == nil || last.Completed {
+			log.Printf("> No pending checkpoint for task '%s', starting over...", taskName)
+			last = nil
+		} else {
+			log.Printf("> Resuming task '%s' after %d processed row(s)...", taskName, last.Offset)
+		}
+	}
+
+	var skip int64
+	if last != nil {
+		skip = last.Offset
+	}
+
+	key := taskConfig.Checkpoint.Key
+	if resumable, ok := source.(core.Resumable); ok && key != "" {
+		var value any
+		if last != nil {
+			value = last.Key
+		}
+		if err := resumable.ResumeAfter(key, value); err != nil {
+			return nil, err
+		}
+		if value != nil {
+			skip = 0
+		}
+	}
+
+	cp := core.NewCheckpointer(store, taskConfig.Checkpoint, last, skip)
+	trk.SetCheckpointer(cp, last != nil)
+	if last == nil {
+		if err := cp.Commit(false); err != nil {
+			return nil, err
+		}
+	}
+
+	return cp, nil
+}
@@ -0,0 +1,223 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tasks
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tnotstar/datacat/core"
+)
+
+func TestCheckpointedTaskCompletes(t *testing.T) {
+	db := newSQLiteDatabase(t,
+		"CREATE TABLE src (id INTEGER PRIMARY KEY)",
+		"CREATE TABLE dst (id INTEGER)",
+		"INSERT INTO src VALUES (1), (2), (3)",
+	)
+	cfg := &core.Config{
+		StateDir:  t.TempDir(),
+		Databases: map[string]core.DatabaseConfig{"db": db},
+		Tasks: map[string]core.TaskConfig{
+			"copy": {
+				Checkpoint: &core.CheckpointConfig{Interval: 1},
+				Source: core.SourceConfig{Type: "database-query-source", Arguments: core.Arguments{
+					"database": "db",
+					"query":    "SELECT id FROM src",
+				}},
+				Target: core.TargetConfig{Type: "database-table-target", Arguments: core.Arguments{
+					"database": "db",
+					"table":    "dst",
+				}},
+			},
+		},
+	}
+
+	runTask(t, cfg, "copy")
+	got := queryInts(t, db, "SELECT id FROM dst ORDER BY id")
+	if want := []int64{1, 2, 3}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Table = %v, want %v", got, want)
+	}
+
+	state, err := core.OpenStateStore(cfg, "copy").Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checkpoint := state.Checkpoint; checkpoint == nil || checkpoint.Offset != 3 || !checkpoint.Completed {
+		t.Errorf("Checkpoint = %+v, want offset 3 and completed", checkpoint)
+	}
+}
+
+// `readLines` returns the lines of the given file.
+func readLines(t *testing.T, fileName string) []string {
+	t.Helper()
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(content)), "\n")
+}
+
+func TestCheckpointedTaskWithNullLine(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.jsonl")
+	if err := os.WriteFile(input, []byte("{\"a\":1}\nnull\n{\"a\":2}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "output.jsonl")
+	rejected := filepath.Join(dir, "rejected.jsonl")
+	cfg := &core.Config{
+		Tasks: map[string]core.TaskConfig{
+			"copy": {
+				Checkpoint: &core.CheckpointConfig{Interval: 1},
+				Source: core.SourceConfig{Type: "jsonl-file-source", Arguments: core.Arguments{
+					"filename": input,
+				}},
+				Target: core.TargetConfig{Type: "jsonl-file-target", Arguments: core.Arguments{
+					"filename": output,
+				}},
+				DeadLetter: &core.DeadLetterConfig{
+					Target: core.TargetConfig{Type: "jsonl-file-target", Arguments: core.Arguments{
+						"filename": rejected,
+					}},
+				},
+			},
+		},
+	}
+
+	runTask(t, cfg, "copy")
+	if got, want := readLines(t, output), []string{`{"a":1}`, `{"a":2}`}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Output = %v, want %v", got, want)
+	}
+	if got := readLines(t, rejected); len(got) != 1 || !strings.Contains(got[0], "line 2") {
+		t.Errorf("Dead-letter output = %v, want the line 2", got)
+	}
+}
+
+// `readCompressedLines` returns the lines of the given compressed file.
+func readCompressedLines(t *testing.T, fileName string, compression string) []string {
+	t.Helper()
+	file, err := os.Open(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	reader, err := core.NewDecompressor(file, compression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("Error reading %s: %v", fileName, err)
+	}
+	return strings.Split(strings.TrimSpace(string(content)), "\n")
+}
+
+func TestCheckpointedTaskResumesAfterCrash(t *testing.T) {
+	for _, compression := range []string{core.CompressionNone, core.CompressionGzip, core.CompressionZstd} {
+		dir := t.TempDir()
+		input := filepath.Join(dir, "input.jsonl")
+		output := filepath.Join(dir, "output.jsonl")
+		cfg := &core.Config{
+			StateDir: dir,
+			Tasks: map[string]core.TaskConfig{
+				"copy": {
+					Checkpoint: &core.CheckpointConfig{Interval: 1000},
+					Source: core.SourceConfig{Type: "jsonl-file-source", Arguments: core.Arguments{
+						"filename": input,
+					}},
+					Target: core.TargetConfig{Type: "jsonl-file-target", Arguments: core.Arguments{
+						"filename":    output,
+						"compression": compression,
+						"batchsize":   2,
+					}},
+				},
+			},
+		}
+
+		// The first execution records the size of the output file as its
+		// batches are flushed.
+		if err := os.WriteFile(input, []byte("{\"id\":1}\n{\"id\":2}\n{\"id\":3}\n{\"id\":4}\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		runTask(t, cfg, "copy")
+		store := core.OpenStateStore(cfg, "copy")
+		state, err := store.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if checkpoint := state.Checkpoint; checkpoint.Offset != 4 || checkpoint.Outputs[output] != info.Size() {
+			t.Fatalf("Checkpoint with %s = %+v, want offset 4 and the size %d of the output", compression, checkpoint, info.Size())
+		}
+
+		// A crash after the second batch was flushed but before it was
+		// committed leaves the checkpoint after the first batch, and a
+		// batch cut in the middle of its compressed stream at the end of
+		// the file.
+		content, err := os.ReadFile(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var firstBatch bytes.Buffer
+		compressor, err := core.NewCompressor(&firstBatch, compression, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		compressor.Write([]byte("{\"id\":1}\n{\"id\":2}\n"))
+		compressor.Close()
+		if !bytes.HasPrefix(content, firstBatch.Bytes()) {
+			t.Fatalf("Output with %s doesn't start with the stream of the first batch", compression)
+		}
+		crashed := content[:firstBatch.Len()+(len(content)-firstBatch.Len())/2]
+		if err := os.WriteFile(output, crashed, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		err = store.Update(func(state *core.TaskState) {
+			state.Checkpoint.Offset = 2
+			state.Checkpoint.Acknowledged = 2
+			state.Checkpoint.Outputs[output] = int64(firstBatch.Len())
+			state.Checkpoint.Completed = false
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result := RunTask(context.Background(), cfg, "copy", Options{Resume: true})
+		if result.Err != nil || result.Read != 2 || result.Written != 2 {
+			t.Fatalf("Resumed task with %s = %s, want 2 rows read and written", compression, result)
+		}
+		want := []string{`{"id":1}`, `{"id":2}`, `{"id":3}`, `{"id":4}`}
+		if got := readCompressedLines(t, output, compression); !reflect.DeepEqual(got, want) {
+			t.Errorf("Output with %s after resume = %v, want %v", compression, got, want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tasks
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tnotstar/datacat/core"
+)
+
+func TestConversionErrorsGoToDeadLetter(t *testing.T) {
+	db := newSQLiteDatabase(t,
+		"CREATE TABLE src (id INTEGER PRIMARY KEY, amount TEXT)",
+		"CREATE TABLE dst (id INTEGER, amount INTEGER)",
+		"INSERT INTO src VALUES (1, '10'), (2, 'ten'), (3, '30')",
+	)
+	rejected := filepath.Join(t.TempDir(), "rejected.jsonl")
+	cfg := &core.Config{
+		Databases: map[string]core.DatabaseConfig{"db": db},
+		Tasks: map[string]core.TaskConfig{
+			"copy": {
+				Source: core.SourceConfig{Type: "database-query-source", Arguments: core.Arguments{
+					"database": "db",
+					"query":    "SELECT id, amount FROM src ORDER BY id",
+					"types":    core.Arguments{"amount": "integer"},
+				}},
+				Target: core.TargetConfig{Type: "database-table-target", Arguments: core.Arguments{
+					"database": "db",
+					"table":    "dst",
+				}},
+				DeadLetter: &core.DeadLetterConfig{
+					Target: core.TargetConfig{Type: "jsonl-file-target", Arguments: core.Arguments{
+						"filename": rejected,
+					}},
+				},
+			},
+		},
+	}
+
+	runTask(t, cfg, "copy")
+	got := queryInts(t, db, "SELECT id FROM dst ORDER BY id")
+	if want := []int64{1, 3}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Table = %v, want %v", got, want)
+	}
+
+	content, err := os.ReadFile(rejected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(content)), "\n"); len(lines) != 1 || !strings.Contains(lines[0], `"id":2`) {
+		t.Errorf("Dead-letter output = %q, want the row with id 2", content)
+	}
+}
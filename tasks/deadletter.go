@@ -0,0 +1,103 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tasks
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/tnotstar/datacat/core"
+	"github.com/tnotstar/datacat/targets"
+)
+
+// `deadLetterConfigurator` wraps the global configuration object to
+// replace the target of a task by its dead-letter target, so that any
+// kind of target endpoint can be used as dead-letter output.
+type deadLetterConfigurator struct {
+	core.Configurator
+	// The `target` configuration of the dead-letter output.
+	target *core.TargetConfig
+}
+
+// `GetTargetConfig` returns the configuration of the dead-letter target.
+func (cfg *deadLetterConfigurator) GetTargetConfig(name string) (*core.TargetConfig, error) {
+	return cfg.target, nil
+}
+
+// `deadLetter` is a running dead-letter target of a task.
+type deadLetter struct {
+	// The `out` channel receives the failed rows.
+	out chan core.RowMap
+	// The `trk` tracks the rows written to the dead-letter target.
+	trk *core.Tracker
+	// The `wg` waits for the dead-letter target to finish.
+	wg sync.WaitGroup
+}
+
+// `startDeadLetter` builds and runs the dead-letter target of the task,
+// and routes the failed rows reported to `trk` to it. It returns nil if
+// the task has no dead-letter configuration.
+func startDeadLetter(cfg core.Configurator, taskName string, taskConfig *core.TaskConfig, trk *core.Tracker, cancel context.CancelFunc) (*deadLetter, error) {
+	if taskConfig.DeadLetter == nil {
+		return nil, nil
+	}
+
+	dlqCfg := &deadLetterConfigurator{Configurator: cfg, target: &taskConfig.DeadLetter.Target}
+	target, err := targets.BuildTarget(0, dlqCfg, taskName)
+	if err != nil {
+		return nil, err
+	}
+
+	// The dead-letter target stops the whole task if it fails, but it
+	// isn't stopped by the task, so it can record the failures of an
+	// aborted task.
+	ctx, cancelDeadLetter := context.WithCancel(context.Background())
+	dlq := &deadLetter{out: make(chan core.RowMap)}
+	dlq.trk = core.NewTracker(taskName, func() {
+		cancelDeadLetter()
+		cancel()
+	})
+	dlq.trk.SetCheckpointer(nil, trk.Resuming())
+
+	log.Printf("> Starting dead-letter target for task '%s'...", taskName)
+	target.Run(ctx, &dlq.wg, dlq.trk, dlq.out)
+	trk.SetDeadLetter(ctx, dlq.out, *taskConfig.DeadLetter)
+	return dlq, nil
+}
+
+// `stop` closes the dead-letter output after the pipeline of the task
+// has finished, waits for the dead-letter target, and reports its
+// counters and errors to `trk`.
+func (dlq *deadLetter) stop(trk *core.Tracker) {
+	if dlq == nil {
+		return
+	}
+
+	close(dlq.out)
+	dlq.wg.Wait()
+
+	result := dlq.trk.Result()
+	trk.DeadLettered(result.Written)
+	if result.Err != nil {
+		trk.Abort("deadletter", result.Err)
+	}
+}
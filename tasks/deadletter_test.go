@@ -0,0 +1,135 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tnotstar/datacat/core"
+)
+
+// `newDeadLetterTask` returns a configuration with a `copy` task of the
+// given JSONLines lines, where the lines which aren't objects fail, and
+// a dead-letter output with the given budget. It returns the names of
+// the output and dead-letter files too.
+func newDeadLetterTask(t *testing.T, lines []string, budget core.DeadLetterConfig) (*core.Config, string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.jsonl")
+	if err := os.WriteFile(input, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "output.jsonl")
+	rejected := filepath.Join(dir, "rejected.jsonl")
+	budget.Target = core.TargetConfig{Type: "jsonl-file-target", Arguments: core.Arguments{"filename": rejected}}
+
+	cfg := &core.Config{
+		StateDir: dir,
+		Tasks: map[string]core.TaskConfig{
+			"copy": {
+				Source:     core.SourceConfig{Type: "jsonl-file-source", Arguments: core.Arguments{"filename": input}},
+				Target:     core.TargetConfig{Type: "jsonl-file-target", Arguments: core.Arguments{"filename": output}},
+				DeadLetter: &budget,
+			},
+		},
+	}
+	return cfg, output, rejected
+}
+
+// `jsonLines` returns the given number of lines, which are valid objects
+// but for the lines with the given numbers, counted from 1.
+func jsonLines(count int, invalid ...int) []string {
+	lines := make([]string, count)
+	for i := range lines {
+		lines[i] = fmt.Sprintf(`{"id":%d}`, i+1)
+	}
+	for _, number := range invalid {
+		lines[number-1] = "not json"
+	}
+	return lines
+}
+
+func TestDeadLetterRecordsFailedRows(t *testing.T) {
+	cfg, output, rejected := newDeadLetterTask(t, jsonLines(5, 2, 4), core.DeadLetterConfig{MaxErrors: 2})
+
+	result := runTask(t, cfg, "copy")
+	if result.Read != 5 || result.Written != 3 || result.Failed != 2 || result.DeadLettered != 2 {
+		t.Errorf("Result = %s, want 5 read, 3 written, 2 failed and 2 dead-lettered", result)
+	}
+	if lines := readLines(t, output); len(lines) != 3 {
+		t.Errorf("Output = %v, want 3 rows", lines)
+	}
+
+	for _, line := range readLines(t, rejected) {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+		if record[core.DeadLetterStage] != "source" || record[core.DeadLetterError] == nil || record[core.DeadLetterTimestamp] == nil {
+			t.Errorf("Dead-letter record = %v, want its stage, error and timestamp", record)
+		}
+	}
+}
+
+func TestDeadLetterBudget(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		lines    []string
+		budget   core.DeadLetterConfig
+		exceeded bool
+	}{
+		{"errors within maxerrors", jsonLines(10, 3, 6), core.DeadLetterConfig{MaxErrors: 2}, false},
+		{"errors over maxerrors", jsonLines(10, 3, 6, 9), core.DeadLetterConfig{MaxErrors: 2}, true},
+		{"ratio within maxratio", jsonLines(10, 3, 6), core.DeadLetterConfig{MaxRatio: 0.2}, false},
+		{"ratio over maxratio at the end", jsonLines(10, 3, 6, 9), core.DeadLetterConfig{MaxRatio: 0.2}, true},
+		// Early failures don't exceed the ratio before `minrows` rows.
+		{"ratio before minrows", jsonLines(10, 1, 2), core.DeadLetterConfig{MaxRatio: 0.2, MinRows: 5}, false},
+		{"ratio after minrows", jsonLines(10, 1, 2), core.DeadLetterConfig{MaxRatio: 0.2, MinRows: 1}, true},
+	} {
+		cfg, _, _ := newDeadLetterTask(t, test.lines, test.budget)
+		result := RunTask(context.Background(), cfg, "copy", Options{})
+		if exceeded := errors.Is(result.Err, core.ErrBudgetExceeded); exceeded != test.exceeded {
+			t.Errorf("Task with %s = %s, want budget exceeded %v", test.name, result, test.exceeded)
+		}
+		if !test.exceeded && result.Err != nil {
+			t.Errorf("Task with %s failed: %v", test.name, result.Err)
+		}
+	}
+}
+
+func TestDeadLetterBudgetStopsEarly(t *testing.T) {
+	cfg, _, rejected := newDeadLetterTask(t, jsonLines(2000, 1, 2, 3), core.DeadLetterConfig{MaxErrors: 2})
+
+	result := RunTask(context.Background(), cfg, "copy", Options{})
+	if !errors.Is(result.Err, core.ErrBudgetExceeded) || result.Read >= 2000 {
+		t.Errorf("Result = %s, want the budget exceeded before the end", result)
+	}
+	if lines := readLines(t, rejected); len(lines) != 3 {
+		t.Errorf("Dead-letter output = %v, want the 3 failed rows", lines)
+	}
+}
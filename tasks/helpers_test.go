@@ -0,0 +1,88 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tasks
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/tnotstar/datacat/core"
+)
+
+// `newSQLiteDatabase` creates a SQLite database in a temporary folder
+// with the given statements, and returns its configuration.
+func newSQLiteDatabase(t *testing.T, statements ...string) core.DatabaseConfig {
+	t.Helper()
+	config := core.DatabaseConfig{
+		Driver:     "sqlite3",
+		Path:       filepath.Join(t.TempDir(), "test.db"),
+		Parameters: map[string]string{"_journal_mode": "WAL", "_busy_timeout": "5000"},
+	}
+	execSQL(t, config, statements...)
+	return config
+}
+
+// `execSQL` executes the given statements on the given database.
+func execSQL(t *testing.T, config core.DatabaseConfig, statements ...string) {
+	t.Helper()
+	db, err := sqlx.Open(config.Driver, config.GetDataSourceName())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("Error executing '%s': %v", statement, err)
+		}
+	}
+}
+
+// `queryInts` returns the integers of the first column of the rows of
+// the given query.
+func queryInts(t *testing.T, config core.DatabaseConfig, query string) []int64 {
+	t.Helper()
+	db, err := sqlx.Open(config.Driver, config.GetDataSourceName())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var values []int64
+	if err := db.Select(&values, query); err != nil {
+		t.Fatalf("Error querying '%s': %v", query, err)
+	}
+	return values
+}
+
+// `runTask` runs the given task, which must succeed, and returns its
+// result.
+func runTask(t *testing.T, cfg *core.Config, taskName string) *core.Result {
+	t.Helper()
+	if cfg.StateDir == "" {
+		cfg.StateDir = t.TempDir()
+	}
+	result := RunTask(context.Background(), cfg, taskName, Options{})
+	if result.Err != nil {
+		t.Fatalf("Task '%s' failed: %v", taskName, result.Err)
+	}
+	return result
+}
@@ -0,0 +1,141 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/tnotstar/datacat/core"
+)
+
+// `newOrderingTask` returns a configuration with a `copy` task of 200
+// rows, which upper-cases their names with the given number of adapter
+// instances, and writes them with the given number of target instances
+// to the `out-%d.jsonl` files of the returned directory.
+func newOrderingTask(t *testing.T, ordered bool, adapters int, targets int) (*core.Config, string) {
+	t.Helper()
+	dir := t.TempDir()
+	var lines []string
+	for id := 1; id <= 200; id++ {
+		lines = append(lines, fmt.Sprintf(`{"id":%d,"name":"row"}`, id))
+	}
+	input := filepath.Join(dir, "input.jsonl")
+	if err := os.WriteFile(input, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &core.Config{
+		StateDir: dir,
+		Tasks: map[string]core.TaskConfig{
+			"copy": {
+				Ordered: ordered,
+				Source:  core.SourceConfig{Type: "jsonl-file-source", Arguments: core.Arguments{"filename": input}},
+				Adapters: map[string]core.AdapterConfig{
+					"upper": {Type: "case-conversion-adapter", Parallelism: adapters, Arguments: core.Arguments{
+						"fields":   []any{"name"},
+						"handling": "upper",
+					}},
+				},
+				Target: core.TargetConfig{Type: "jsonl-file-target", Parallelism: targets, Arguments: core.Arguments{
+					"filename": filepath.Join(dir, "out-%d.jsonl"),
+				}},
+			},
+		},
+	}
+	return cfg, dir
+}
+
+// `expectedLines` returns the output lines of the ordering task.
+func expectedLines() []string {
+	var lines []string
+	for id := 1; id <= 200; id++ {
+		lines = append(lines, fmt.Sprintf(`{"id":%d,"name":"ROW"}`, id))
+	}
+	return lines
+}
+
+func TestOrderedTaskKeepsSourceOrder(t *testing.T) {
+	cfg, dir := newOrderingTask(t, true, 1, 1)
+	runTask(t, cfg, "copy")
+	if got := readLines(t, filepath.Join(dir, "out-0.jsonl")); !reflect.DeepEqual(got, expectedLines()) {
+		t.Errorf("Output isn't in the order of the source: %v", got)
+	}
+}
+
+func TestParallelInstancesProcessEveryRow(t *testing.T) {
+	cfg, dir := newOrderingTask(t, false, 4, 3)
+	runTask(t, cfg, "copy")
+
+	var got []string
+	for id := 0; id < 3; id++ {
+		got = append(got, readLines(t, filepath.Join(dir, fmt.Sprintf("out-%d.jsonl", id)))...)
+	}
+	want := expectedLines()
+	sort.Strings(got)
+	sort.Strings(want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Outputs of parallel targets have %d row(s), want each of the %d rows once", len(got), len(want))
+	}
+}
+
+func TestOrderedTaskRejectsParallelInstances(t *testing.T) {
+	for _, test := range []struct {
+		adapters, targets int
+	}{
+		{2, 1},
+		{1, 2},
+	} {
+		cfg, _ := newOrderingTask(t, true, test.adapters, test.targets)
+		if result := RunTask(context.Background(), cfg, "copy", Options{}); result.Err == nil || !strings.Contains(result.Err.Error(), "Ordered task") {
+			t.Errorf("Ordered task with %d adapter(s) and %d target(s) = %v, want it rejected", test.adapters, test.targets, result.Err)
+		}
+	}
+
+	db := newSQLiteDatabase(t, "CREATE TABLE src (id INTEGER)", "INSERT INTO src VALUES (1), (2)")
+	cfg := &core.Config{
+		StateDir:  t.TempDir(),
+		Databases: map[string]core.DatabaseConfig{"db": db},
+		Tasks: map[string]core.TaskConfig{
+			"copy": {
+				Ordered: true,
+				Source: core.SourceConfig{Type: "database-query-source", Arguments: core.Arguments{
+					"database":  "db",
+					"query":     "SELECT id FROM src",
+					"partition": core.Arguments{"column": "id", "count": 2},
+				}},
+				Target: core.TargetConfig{Type: "database-table-target", Arguments: core.Arguments{
+					"database": "db",
+					"table":    "src",
+				}},
+			},
+		},
+	}
+	if result := RunTask(context.Background(), cfg, "copy", Options{}); result.Err == nil || !strings.Contains(result.Err.Error(), "Ordered task") {
+		t.Errorf("Ordered task with a partitioned source = %v, want it rejected", result.Err)
+	}
+}
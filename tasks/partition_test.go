@@ -0,0 +1,111 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tasks
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/tnotstar/datacat/core"
+)
+
+func TestPartitionedSourceIsPlannedOnEveryRun(t *testing.T) {
+	db := newSQLiteDatabase(t, "CREATE TABLE dst (id INTEGER PRIMARY KEY)")
+	cfg := &core.Config{
+		Databases: map[string]core.DatabaseConfig{"db": db},
+		Tasks: map[string]core.TaskConfig{
+			"copy": {
+				Source: core.SourceConfig{Type: "database-query-source", Arguments: core.Arguments{
+					"database":  "db",
+					"query":     "SELECT id FROM src",
+					"partition": map[string]any{"column": "id", "count": 2},
+				}},
+				Target: core.TargetConfig{Type: "database-table-target", Arguments: core.Arguments{
+					"database": "db",
+					"table":    "dst",
+					"columns":  []any{"id"},
+				}},
+			},
+		},
+	}
+
+	// The first run can't plan the partitions of a missing table.
+	if result := RunTask(context.Background(), cfg, "copy", Options{}); result.Err == nil {
+		t.Fatal("First run on a missing table didn't fail")
+	}
+
+	execSQL(t, db,
+		"CREATE TABLE src (id INTEGER PRIMARY KEY)",
+		"INSERT INTO src VALUES (1), (2), (3), (4)",
+	)
+	if result := runTask(t, cfg, "copy"); result.Written != 4 {
+		t.Fatalf("Second run wrote %d rows, want 4", result.Written)
+	}
+	got := queryInts(t, db, "SELECT id FROM dst ORDER BY id")
+	if want := []int64{1, 2, 3, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Copied ids = %v, want %v", got, want)
+	}
+}
+
+func TestExplicitPartitionRangesReadNulls(t *testing.T) {
+	for _, ranges := range [][]any{
+		{map[string]any{"to": 10}, map[string]any{"from": 10}},
+		{map[string]any{"to": 10}, map[string]any{"from": 10, "nulls": true}},
+	} {
+		db := newSQLiteDatabase(t,
+			"CREATE TABLE src (id INTEGER PRIMARY KEY, k INTEGER)",
+			"CREATE TABLE dst (id INTEGER PRIMARY KEY, part INTEGER)",
+			"INSERT INTO src VALUES (1, 5), (2, NULL), (3, 15)",
+		)
+		cfg := &core.Config{
+			Databases: map[string]core.DatabaseConfig{"db": db},
+			Tasks: map[string]core.TaskConfig{
+				"copy": {
+					Source: core.SourceConfig{Type: "database-query-source", Arguments: core.Arguments{
+						"database":  "db",
+						"query":     "SELECT id, k FROM src",
+						"partition": map[string]any{"column": "k", "ranges": ranges},
+					}},
+					Target: core.TargetConfig{Type: "database-table-target", Arguments: core.Arguments{
+						"database": "db",
+						"table":    "dst",
+						"mapping":  map[string]any{"id": "id", "part": "_partition"},
+					}},
+				},
+			},
+		}
+
+		runTask(t, cfg, "copy")
+		got := queryInts(t, db, "SELECT id FROM dst ORDER BY id")
+		if want := []int64{1, 2, 3}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("Copied ids = %v, want %v", got, want)
+		}
+		nulls := ranges[1].(map[string]any)["nulls"] == true
+		want := []int64{0}
+		if nulls {
+			want = []int64{1}
+		}
+		if got := queryInts(t, db, "SELECT part FROM dst WHERE id = 2"); !reflect.DeepEqual(got, want) {
+			t.Errorf("Partition of the null row = %v, want %v", got, want)
+		}
+	}
+}
@@ -21,6 +21,9 @@
 package tasks
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"sync"
 	"time"
@@ -31,34 +34,244 @@ import (
 	"github.com/tnotstar/datacat/targets"
 )
 
-// ExecuteFetch executes the fetch task with given name.
+// `Options` are the execution options of a task.
+type Options struct {
+	// `Resume` continues the task from its last checkpoint.
+	Resume bool
+	// `ResetWatermark` discards the stored watermark of the task.
+	ResetWatermark bool
+	// `Watermark` replaces the stored watermark value of the task.
+	Watermark string
+	// `Params` are the values of the query parameters of the source.
+	Params map[string]string
+}
+
+// RunTask executes the task with given name and returns a summary of
+// its execution. The first error reported by any stage, if any, is
+// available in the `Err` field of the result.
 //
+// When `ctx` is cancelled the source endpoint stops reading rows, and
+// the rows already read are drained to the target or discarded, as
+// specified by the `shutdown` section of the task configuration.
+//
+// The `ctx` is the context to interrupt the task.
+// The `cfg` is the configuration object.
 // The `taskName` is the name of the task to be executed.
-func RunTask(taskName string) {
-	log.Printf("Running taskz '%s'...", taskName)
-	log.Print("RunTask: ************** HOOOOOLLLLLLLAAAAAA*********", taskName)
-	start := time.Now()
-	cfg := core.GetConfig()
+// The `opts` are the execution options.
+func RunTask(ctx context.Context, cfg core.Configurator, taskName string, opts Options) *core.Result {
+	log.Printf("Running task '%s'...", taskName)
+	pipeCtx, cancelPipe := context.WithCancel(context.Background())
+	defer cancelPipe()
+	readCtx, cancelRead := context.WithCancel(pipeCtx)
+	defer cancelRead()
+
+	trk := core.NewTracker(taskName, cancelPipe)
 	var wg sync.WaitGroup
 	var pipe <-chan core.RowMap
 
-	log.Printf("> Starting source for task '%s'...", taskName)
-	source := sources.BuildSource(0, cfg, taskName)
-	pipe = source.Run(&wg)
+	taskConfig, err := cfg.GetTaskConfig(taskName)
+	if err != nil {
+		return setupFailure(trk, "task", err)
+	}
 
-	for _, adapterName := range cfg.GetAdapterNames(taskName) {
-		log.Printf("> Starting adapter '%s' for task '%s'...", adapterName, taskName)
-		adapter := adapters.BuildAdapter(0, cfg, taskName, adapterName)
-		pipe = adapter.Run(&wg, pipe)
+	shutdown := taskConfig.Shutdown
+	if shutdown.Mode == "" {
+		shutdown.Mode = core.ShutdownDrain
+	}
+	if shutdown.Mode != core.ShutdownDrain && shutdown.Mode != core.ShutdownDiscard {
+		return setupFailure(trk, "task", fmt.Errorf("Invalid shutdown mode: %s", shutdown.Mode))
+	}
+
+	partitions, err := sources.CountPartitions(cfg, taskName)
+	if err != nil {
+		return setupFailure(trk, "source", err)
+	}
+
+	if err := checkOrdering(cfg, taskName, taskConfig, partitions); err != nil {
+		return setupFailure(trk, "task", err)
+	}
+
+	if err := overrideWatermark(cfg, taskName, opts); err != nil {
+		return setupFailure(trk, "watermark", err)
+	}
+
+	sourceList := make([]core.Source, partitions)
+	for i := range sourceList {
+		sourceList[i], err = sources.BuildSource(i, cfg, taskName)
+		if err != nil {
+			return setupFailure(trk, "source", err)
+		}
+
+		if parameterized, ok := sourceList[i].(core.Parameterized); ok {
+			if err := parameterized.SetParameters(opts.Params); err != nil {
+				return setupFailure(trk, "source", err)
+			}
+		} else if len(opts.Params) > 0 {
+			return setupFailure(trk, "source", errors.New("The source of the task doesn't take parameters"))
+		}
+	}
+
+	adapterNames := cfg.GetAdapterNames(taskName)
+	adapterList := make([][]core.Adapter, len(adapterNames))
+	for i, adapterName := range adapterNames {
+		adapterConfig, _ := cfg.GetAdapterConfig(taskName, adapterName)
+		adapterList[i] = make([]core.Adapter, adapterConfig.GetParallelism())
+		for j := range adapterList[i] {
+			adapterList[i][j], err = adapters.BuildAdapter(j, cfg, taskName, adapterName)
+			if err != nil {
+				return setupFailure(trk, adapterName, err)
+			}
+		}
+	}
+
+	targetList := make([]core.Target, taskConfig.Target.GetParallelism())
+	for i := range targetList {
+		targetList[i], err = targets.BuildTarget(i, cfg, taskName)
+		if err != nil {
+			return setupFailure(trk, fmt.Sprintf("target#%d", i), err)
+		}
+	}
+
+	cp, err := startCheckpoint(cfg, taskName, taskConfig, sourceList, trk, opts.Resume)
+	if err != nil {
+		return setupFailure(trk, "checkpoint", err)
+	}
+
+	dlq, err := startDeadLetter(cfg, taskName, taskConfig, trk, cancelPipe)
+	if err != nil {
+		return setupFailure(trk, "deadletter", err)
+	}
+
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-finished:
+			return
+		}
+
+		log.Printf("Interrupting task '%s' (shutdown mode: %s)...", taskName, shutdown.Mode)
+		trk.Interrupt()
+		cancelRead()
+		if shutdown.Mode == core.ShutdownDiscard {
+			cancelPipe()
+		} else if shutdown.Timeout > 0 {
+			select {
+			case <-time.After(shutdown.Timeout):
+				log.Printf("Discarding pending rows of task '%s' after %s", taskName, shutdown.Timeout)
+				cancelPipe()
+			case <-finished:
+			}
+		}
+	}()
+
+	log.Printf("> Starting %d instance(s) of source for task '%s'...", len(sourceList), taskName)
+	outs := make([]<-chan core.RowMap, len(sourceList))
+	for i, source := range sourceList {
+		outs[i] = source.Run(readCtx, &wg, trk)
+	}
+	pipe = merge(pipeCtx, &wg, outs)
+
+	for i, instances := range adapterList {
+		log.Printf("> Starting %d instance(s) of adapter '%s' for task '%s'...", len(instances), adapterNames[i], taskName)
+		outs := make([]<-chan core.RowMap, len(instances))
+		for j, adapter := range instances {
+			outs[j] = adapter.Run(pipeCtx, &wg, trk, pipe)
+		}
+		pipe = merge(pipeCtx, &wg, outs)
 	}
 
-	for i := 0; i < 2; i++ {
+	for i, target := range targetList {
 		log.Printf("> Starting instance #%d of target for task '%s'...", i, taskName)
-		target := targets.BuildTarget(i, cfg, taskName)
-		target.Run(&wg, pipe)
+		target.Run(pipeCtx, &wg, trk, pipe)
 	}
 
 	wg.Wait()
-	elapsed := time.Since(start)
-	log.Printf("Task '%s' finished! (%s elapsed)", taskName, elapsed)
+	dlq.stop(trk)
+	trk.CheckBudget()
+	if cp != nil {
+		if err := cp.Commit(trk.Err() == nil); err != nil {
+			trk.Abort("checkpoint", err)
+		}
+	}
+	if trk.Err() == nil {
+		if err := saveWatermark(cfg, taskName, sourceList); err != nil {
+			trk.Abort("watermark", err)
+		}
+	}
+	result := trk.Result()
+	if result.Ok() {
+		log.Printf("Task '%s' finished! (%s elapsed)", taskName, result.Elapsed)
+	} else {
+		log.Printf("Task '%s' failed! (%s elapsed): %s", taskName, result.Elapsed, result.Err)
+	}
+	return result
+}
+
+// `checkOrdering` verifies that a task asking for ordered rows runs a
+// single instance of each stage. Channels are FIFO queues, so a chain of
+// single instances delivers the rows in the order of the source, while
+// parallel instances may reorder them.
+func checkOrdering(cfg core.Configurator, taskName string, taskConfig *core.TaskConfig, partitions int) error {
+	if !taskConfig.Ordered {
+		return nil
+	}
+
+	if partitions > 1 {
+		return fmt.Errorf("Ordered task can't run source with %d partitions", partitions)
+	}
+
+	for _, adapterName := range cfg.GetAdapterNames(taskName) {
+		adapterConfig, _ := cfg.GetAdapterConfig(taskName, adapterName)
+		if adapterConfig.GetParallelism() > 1 {
+			return fmt.Errorf("Ordered task can't run adapter '%s' with parallelism %d", adapterName, adapterConfig.Parallelism)
+		}
+	}
+
+	if taskConfig.Target.GetParallelism() > 1 {
+		return fmt.Errorf("Ordered task can't run target with parallelism %d", taskConfig.Target.Parallelism)
+	}
+
+	return nil
+}
+
+// `merge` returns a channel which receives the rows from all the given
+// channels. It's closed when all of them have been closed.
+func merge(ctx context.Context, wg *sync.WaitGroup, ins []<-chan core.RowMap) <-chan core.RowMap {
+	if len(ins) == 1 {
+		return ins[0]
+	}
+
+	out := make(chan core.RowMap)
+	var pending sync.WaitGroup
+	for _, in := range ins {
+		pending.Add(1)
+		wg.Add(1)
+		go func(in <-chan core.RowMap) {
+			defer wg.Done()
+			defer pending.Done()
+
+			for row := range in {
+				if !core.Send(ctx, out, row) {
+					return
+				}
+			}
+		}(in)
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		pending.Wait()
+		close(out)
+	}()
+
+	return out
+}
+
+// `setupFailure` returns the result of a task which couldn't be built.
+func setupFailure(trk *core.Tracker, stage string, err error) *core.Result {
+	trk.Abort(stage, fmt.Errorf("%w: %w", core.ErrSetup, err))
+	return trk.Result()
 }
@@ -0,0 +1,142 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tnotstar/datacat/core"
+)
+
+// `runInterruptedTask` runs a task which sends 10 rows, one per request,
+// to a service which holds the first request until the task has been
+// interrupted, and for the given `hold` time after it. It returns the
+// result of the task.
+func runInterruptedTask(t *testing.T, shutdown core.ShutdownConfig, hold time.Duration) *core.Result {
+	t.Helper()
+	started := make(chan struct{}, 1)
+	interrupted := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The closing of the connection is only noticed once the body
+		// has been read.
+		io.ReadAll(r.Body)
+		select {
+		case started <- struct{}{}:
+			<-interrupted
+			select {
+			case <-time.After(hold):
+			case <-r.Context().Done():
+			}
+		default:
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.jsonl")
+	var lines []string
+	for id := 1; id <= 10; id++ {
+		lines = append(lines, fmt.Sprintf(`{"id":%d}`, id))
+	}
+	if err := os.WriteFile(input, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &core.Config{
+		StateDir: dir,
+		Services: map[string]core.ServiceConfig{"api": {BaseURL: server.URL}},
+		Tasks: map[string]core.TaskConfig{
+			"send": {
+				Shutdown: shutdown,
+				Source:   core.SourceConfig{Type: "jsonl-file-source", Arguments: core.Arguments{"filename": input}},
+				Target:   core.TargetConfig{Type: "http-request-target", Arguments: core.Arguments{"service": "api", "path": "/items"}},
+			},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	results := make(chan *core.Result)
+	go func() {
+		results <- RunTask(ctx, cfg, "send", Options{})
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The service didn't receive any request")
+	}
+	cancel()
+	close(interrupted)
+
+	select {
+	case result := <-results:
+		return result
+	case <-time.After(5 * time.Second):
+		t.Fatal("The interrupted task didn't stop")
+		return nil
+	}
+}
+
+func TestInterruptedTaskDrainsRows(t *testing.T) {
+	result := runInterruptedTask(t, core.ShutdownConfig{Mode: core.ShutdownDrain}, 50*time.Millisecond)
+	if !errors.Is(result.Err, core.ErrInterrupted) || result.Written != 1 || result.Read >= 10 {
+		t.Errorf("Result = %s, want interrupted with the in-flight row written", result)
+	}
+}
+
+func TestInterruptedTaskDiscardsRows(t *testing.T) {
+	result := runInterruptedTask(t, core.ShutdownConfig{Mode: core.ShutdownDiscard}, time.Minute)
+	if !errors.Is(result.Err, core.ErrInterrupted) || result.Written != 0 || result.Read >= 10 {
+		t.Errorf("Result = %s, want interrupted without rows written", result)
+	}
+}
+
+func TestInterruptedTaskDiscardsRowsAfterTimeout(t *testing.T) {
+	start := time.Now()
+	result := runInterruptedTask(t, core.ShutdownConfig{Mode: core.ShutdownDrain, Timeout: 50 * time.Millisecond}, time.Minute)
+	if !errors.Is(result.Err, core.ErrInterrupted) || result.Written != 0 {
+		t.Errorf("Result = %s, want interrupted without rows written", result)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Task stopped after %s, want the drain timeout", elapsed)
+	}
+}
+
+func TestInvalidShutdownMode(t *testing.T) {
+	cfg := &core.Config{
+		Tasks: map[string]core.TaskConfig{
+			"send": {Shutdown: core.ShutdownConfig{Mode: "abandon"}},
+		},
+	}
+	if result := RunTask(context.Background(), cfg, "send", Options{}); result.Err == nil {
+		t.Error("Task with an invalid shutdown mode succeeded")
+	}
+}
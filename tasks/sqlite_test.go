@@ -0,0 +1,104 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tasks
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/tnotstar/datacat/core"
+)
+
+// A `employee` row of the target table of the end-to-end test.
+type employee struct {
+	ID     int64           `db:"EMPLOYEE_ID"`
+	Name   string          `db:"FULL_NAME"`
+	Salary sql.NullFloat64 `db:"SALARY"`
+	Hired  sql.NullString  `db:"HIRED"`
+}
+
+func TestSQLiteSourceToSQLiteTarget(t *testing.T) {
+	source := newSQLiteDatabase(t,
+		"CREATE TABLE employees (id INTEGER PRIMARY KEY, name TEXT, salary DECIMAL(10,2), hired DATE)",
+		"INSERT INTO employees VALUES (1, 'Ada', 1200.50, '2024-01-15'), (2, 'Grace', NULL, NULL), (3, 'Linus', 980, '2023-06-01')",
+	)
+	target := newSQLiteDatabase(t,
+		"CREATE TABLE staff (EMPLOYEE_ID INTEGER PRIMARY KEY, FULL_NAME TEXT, SALARY REAL, HIRED TEXT)",
+		"INSERT INTO staff VALUES (1, 'Old name', 1, NULL)",
+	)
+	cfg := &core.Config{
+		Databases: map[string]core.DatabaseConfig{"source": source, "target": target},
+		Tasks: map[string]core.TaskConfig{
+			"copy": {
+				Source: core.SourceConfig{Type: "database-query-source", Arguments: core.Arguments{
+					"database": "source",
+					"query":    "SELECT id, name, salary, hired FROM employees WHERE id > :minid",
+					"parameters": core.Arguments{
+						"minid": 0,
+					},
+					"types": core.Arguments{"hired": "date"},
+				}},
+				Target: core.TargetConfig{Type: "database-table-target", Arguments: core.Arguments{
+					"database":  "target",
+					"table":     "staff",
+					"mode":      "upsert",
+					"keys":      []any{"EMPLOYEE_ID"},
+					"batchsize": 2,
+					"mapping": core.Arguments{
+						"EMPLOYEE_ID": "id",
+						"FULL_NAME":   "name",
+						"SALARY":      "salary",
+						"HIRED":       "hired",
+					},
+				}},
+			},
+		},
+	}
+
+	want := []employee{
+		{ID: 1, Name: "Ada", Salary: sql.NullFloat64{Float64: 1200.5, Valid: true}, Hired: sql.NullString{String: "2024-01-15", Valid: true}},
+		{ID: 2, Name: "Grace"},
+		{ID: 3, Name: "Linus", Salary: sql.NullFloat64{Float64: 980, Valid: true}, Hired: sql.NullString{String: "2023-06-01", Valid: true}},
+	}
+	// A second run updates the same rows.
+	for run := 1; run <= 2; run++ {
+		result := runTask(t, cfg, "copy")
+		if result.Read != 3 || result.Written != 3 {
+			t.Fatalf("Run #%d read %d and wrote %d rows, want 3 and 3", run, result.Read, result.Written)
+		}
+
+		db, err := sqlx.Open(target.Driver, target.GetDataSourceName())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []employee
+		err = db.Select(&got, "SELECT EMPLOYEE_ID, FULL_NAME, SALARY, HIRED FROM staff ORDER BY EMPLOYEE_ID")
+		db.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("Table after run #%d = %+v, want %+v", run, got, want)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tasks
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tnotstar/datacat/core"
+)
+
+func TestTruncatingTargetOnEveryRun(t *testing.T) {
+	db := newSQLiteDatabase(t,
+		"CREATE TABLE src (id INTEGER PRIMARY KEY)",
+		"CREATE TABLE dst (id INTEGER)",
+		"INSERT INTO src VALUES (1), (2)",
+	)
+	cfg := &core.Config{
+		Databases: map[string]core.DatabaseConfig{"db": db},
+		Tasks: map[string]core.TaskConfig{
+			"reload": {
+				Source: core.SourceConfig{Type: "database-query-source", Arguments: core.Arguments{
+					"database": "db",
+					"query":    "SELECT id FROM src",
+				}},
+				Target: core.TargetConfig{Type: "database-table-target", Parallelism: 2, Arguments: core.Arguments{
+					"database": "db",
+					"table":    "dst",
+					"truncate": true,
+				}},
+			},
+		},
+	}
+
+	for run := 1; run <= 2; run++ {
+		runTask(t, cfg, "reload")
+		got := queryInts(t, db, "SELECT id FROM dst ORDER BY id")
+		if want := []int64{1, 2}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("Table after run #%d = %v, want %v", run, got, want)
+		}
+	}
+}
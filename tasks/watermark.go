@@ -0,0 +1,101 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tasks
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/tnotstar/datacat/core"
+)
+
+// `overrideWatermark` applies the watermark options given in the command
+// line to the state of the task, before its source is built.
+//
+// A reset removes the stored watermark, so the task reads all the rows
+// again. An explicit value replaces the stored one.
+func overrideWatermark(cfg core.Configurator, taskName string, opts Options) error {
+	if !opts.ResetWatermark && opts.Watermark == "" {
+		return nil
+	}
+
+	sourceConfig, err := cfg.GetSourceConfig(taskName)
+	if err != nil {
+		return err
+	}
+
+	column := sourceConfig.Arguments.String("watermark", "")
+	if column == "" {
+		return errors.New("Can't override the watermark of a task without watermark column")
+	}
+
+	return core.OpenStateStore(cfg, taskName).Update(func(state *core.TaskState) {
+		if opts.ResetWatermark {
+			log.Printf("> Resetting watermark of task '%s'...", taskName)
+			state.Watermark = nil
+			return
+		}
+
+		log.Printf("> Setting watermark of task '%s' to '%s'...", taskName, opts.Watermark)
+		var value any = opts.Watermark
+		if _, err := strconv.ParseFloat(opts.Watermark, 64); err == nil {
+			value = json.Number(opts.Watermark)
+		}
+		state.Watermark = &core.Watermark{
+			Column:  column,
+			Value:   value,
+			Updated: time.Now(),
+		}
+	})
+}
+
+// `saveWatermark` stores the highest watermark value read by the source
+// instances which are `core.Watermarker`, if they have read any row.
+func saveWatermark(cfg core.Configurator, taskName string, sourceList []core.Source) error {
+	var column string
+	var value any
+	for _, source := range sourceList {
+		watermarker, ok := source.(core.Watermarker)
+		if !ok {
+			continue
+		}
+
+		name, max := watermarker.Watermark()
+		if max != nil && (value == nil || core.CompareValues(max, value) > 0) {
+			column, value = name, max
+		}
+	}
+	if column == "" || value == nil {
+		return nil
+	}
+
+	log.Printf("> Saving watermark of task '%s': %s = %v", taskName, column, value)
+	return core.OpenStateStore(cfg, taskName).Update(func(state *core.TaskState) {
+		state.Watermark = &core.Watermark{
+			Column:  column,
+			Value:   value,
+			Updated: time.Now(),
+		}
+	})
+}
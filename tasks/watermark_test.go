@@ -0,0 +1,149 @@
+// Copyright 2023, Antonio Alvarado Hernández <tnotstar@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/tnotstar/datacat/core"
+)
+
+// `newWatermarkTask` returns a configuration with a `copy` task from the
+// `src` to the `dst` table of the given database, with the `id` column
+// as watermark.
+func newWatermarkTask(t *testing.T, db core.DatabaseConfig) *core.Config {
+	t.Helper()
+	return &core.Config{
+		StateDir:  t.TempDir(),
+		Databases: map[string]core.DatabaseConfig{"db": db},
+		Tasks: map[string]core.TaskConfig{
+			"copy": {
+				Source: core.SourceConfig{Type: "database-query-source", Arguments: core.Arguments{
+					"database":  "db",
+					"query":     "SELECT id FROM src",
+					"watermark": "id",
+				}},
+				Target: core.TargetConfig{Type: "database-table-target", Arguments: core.Arguments{
+					"database": "db",
+					"table":    "dst",
+				}},
+			},
+		},
+	}
+}
+
+// `storedWatermark` returns the text of the watermark value stored in
+// the state of the given task, or an empty string if there isn't any.
+func storedWatermark(t *testing.T, cfg *core.Config, taskName string) string {
+	t.Helper()
+	state, err := core.OpenStateStore(cfg, taskName).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Watermark == nil {
+		return ""
+	}
+	return fmt.Sprint(state.Watermark.Value)
+}
+
+func TestWatermarkReadsNewRows(t *testing.T) {
+	db := newSQLiteDatabase(t,
+		"CREATE TABLE src (id INTEGER)",
+		"CREATE TABLE dst (id INTEGER)",
+		"INSERT INTO src VALUES (1), (2), (3)",
+	)
+	cfg := newWatermarkTask(t, db)
+
+	runTask(t, cfg, "copy")
+	if value := storedWatermark(t, cfg, "copy"); value != "3" {
+		t.Fatalf("Watermark after the first run = %q, want 3", value)
+	}
+
+	execSQL(t, db, "INSERT INTO src VALUES (4), (5)")
+	if result := runTask(t, cfg, "copy"); result.Read != 2 {
+		t.Errorf("Second run read %d row(s), want 2", result.Read)
+	}
+	if got, want := queryInts(t, db, "SELECT id FROM dst ORDER BY id"), []int64{1, 2, 3, 4, 5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Table = %v, want %v", got, want)
+	}
+
+	// A run without new rows keeps the watermark.
+	if result := runTask(t, cfg, "copy"); result.Read != 0 || storedWatermark(t, cfg, "copy") != "5" {
+		t.Errorf("Run without new rows read %d row(s) and left the watermark at %s", result.Read, storedWatermark(t, cfg, "copy"))
+	}
+}
+
+func TestWatermarkIsKeptAfterFailedRun(t *testing.T) {
+	db := newSQLiteDatabase(t,
+		"CREATE TABLE src (id INTEGER)",
+		"CREATE TABLE dst (id INTEGER)",
+		"INSERT INTO src VALUES (1), (2)",
+	)
+	cfg := newWatermarkTask(t, db)
+	runTask(t, cfg, "copy")
+
+	execSQL(t, db, "INSERT INTO src VALUES (3)", "DROP TABLE dst")
+	if result := RunTask(context.Background(), cfg, "copy", Options{}); result.Err == nil {
+		t.Fatal("Run without target table succeeded")
+	}
+	if value := storedWatermark(t, cfg, "copy"); value != "2" {
+		t.Fatalf("Watermark after a failed run = %q, want 2", value)
+	}
+
+	execSQL(t, db, "CREATE TABLE dst (id INTEGER)")
+	runTask(t, cfg, "copy")
+	if got, want := queryInts(t, db, "SELECT id FROM dst ORDER BY id"), []int64{3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Table after the failed run = %v, want %v", got, want)
+	}
+}
+
+func TestWatermarkOverrides(t *testing.T) {
+	db := newSQLiteDatabase(t,
+		"CREATE TABLE src (id INTEGER)",
+		"CREATE TABLE dst (id INTEGER)",
+		"INSERT INTO src VALUES (1), (2), (3)",
+	)
+	cfg := newWatermarkTask(t, db)
+	runTask(t, cfg, "copy")
+
+	for _, test := range []struct {
+		opts Options
+		read int64
+	}{
+		{Options{ResetWatermark: true}, 3},
+		{Options{Watermark: "1"}, 2},
+		{Options{Watermark: "3"}, 0},
+	} {
+		result := RunTask(context.Background(), cfg, "copy", test.opts)
+		if result.Err != nil || result.Read != test.read {
+			t.Errorf("Run with %+v = %s, want %d row(s) read", test.opts, result, test.read)
+		}
+	}
+
+	task := cfg.Tasks["copy"]
+	delete(task.Source.Arguments, "watermark")
+	if result := RunTask(context.Background(), cfg, "copy", Options{ResetWatermark: true}); result.Err == nil {
+		t.Error("Reset of the watermark of a task without watermark column succeeded")
+	}
+}